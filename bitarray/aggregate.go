@@ -0,0 +1,282 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"container/heap"
+	"math/bits"
+)
+
+// blockCursor tracks the current non-empty block of an iterator.
+type blockCursor struct {
+	iter  Iterator
+	index uint64
+	block block
+}
+
+// next advances the cursor to the next non-empty block, returning
+// false when the iterator is exhausted.
+func (bc *blockCursor) next() bool {
+	for bc.iter.Next() {
+		if bc.index, bc.block = bc.iter.Value(); bc.block != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// cursors is a min heap of block cursors ordered by block index.
+type cursors []*blockCursor
+
+func (c cursors) Len() int {
+	return len(c)
+}
+
+func (c cursors) Less(i, j int) bool {
+	return c[i].index < c[j].index
+}
+
+func (c cursors) Swap(i, j int) {
+	c[i], c[j] = c[j], c[i]
+}
+
+func (c *cursors) Push(x interface{}) {
+	*c = append(*c, x.(*blockCursor))
+}
+
+func (c *cursors) Pop() interface{} {
+	old := *c
+	bc := old[len(old)-1]
+	old[len(old)-1] = nil
+	*c = old[:len(old)-1]
+	return bc
+}
+
+// aggregate merges the blocks of every bit array in a single pass.
+// combine is called once per block index with the non-empty blocks
+// found at that index.  The result is dense if any of the inputs are
+// dense and sparse otherwise, unless a dense result would be larger
+// than MaxDenseCapacity.
+func aggregate(arrays []BitArray, combine func(group blocks) block) BitArray {
+	c := make(cursors, 0, len(arrays))
+	dense, capacity := false, uint64(0)
+	for _, ba := range arrays {
+		if !isSparse(ba) {
+			dense = true
+			capacity = maxUint64(capacity, ba.Capacity())
+		}
+
+		bc := &blockCursor{iter: ba.Blocks()}
+		if bc.next() {
+			c = append(c, bc)
+		}
+	}
+	heap.Init(&c)
+
+	result := newSparseBitArray()
+	group := make(blocks, 0, len(arrays))
+	for len(c) > 0 {
+		index := c[0].index
+		group = group[:0]
+		for len(c) > 0 && c[0].index == index {
+			bc := c[0]
+			group = append(group, bc.block)
+			if bc.next() {
+				heap.Fix(&c, 0)
+			} else {
+				heap.Pop(&c)
+			}
+		}
+
+		if b := combine(group); b != 0 {
+			result.indices = append(result.indices, index)
+			result.blocks = append(result.blocks, b)
+		}
+	}
+
+	if !dense {
+		return result
+	}
+
+	ba, err := toDense(result)
+	if err != nil {
+		return result
+	}
+	if ba.Capacity() < capacity {
+		ba.Resize(capacity)
+	}
+
+	return ba
+}
+
+// denseArrays returns the provided bit arrays as dense bit arrays
+// along with the largest capacity among them.  The returned bool is
+// false if there are no bit arrays or any of them are not dense.
+func denseArrays(arrays []BitArray) ([]*bitArray, uint64, bool) {
+	if len(arrays) == 0 {
+		return nil, 0, false
+	}
+
+	dense := make([]*bitArray, 0, len(arrays))
+	capacity := uint64(0)
+	for _, ba := range arrays {
+		dba, ok := ba.(*bitArray)
+		if !ok {
+			return nil, 0, false
+		}
+		dense = append(dense, dba)
+		capacity = maxUint64(capacity, dba.Capacity())
+	}
+
+	return dense, capacity, true
+}
+
+// OrAll will bitwise or every provided bit array in a single pass and
+// return a new bit array representing the result.  The result is dense
+// if any of the inputs are dense and sparse otherwise.
+func OrAll(arrays ...BitArray) BitArray {
+	// dense arrays line up block for block so skip the merge
+	if dense, capacity, ok := denseArrays(arrays); ok {
+		result := newBitArray(capacity)
+		for _, ba := range dense {
+			orBlocks(result.blocks[:len(ba.blocks)], result.blocks, ba.blocks)
+		}
+
+		result.setLowest()
+		result.setHighest()
+		return result
+	}
+
+	return aggregate(arrays, func(group blocks) block {
+		result := block(0)
+		for _, b := range group {
+			result |= b
+		}
+		return result
+	})
+}
+
+// AndAll will bitwise and every provided bit array in a single pass
+// and return a new bit array representing the result.  The result is
+// dense if any of the inputs are dense and sparse otherwise.
+func AndAll(arrays ...BitArray) BitArray {
+	if dense, capacity, ok := denseArrays(arrays); ok {
+		n := len(dense[0].blocks)
+		for _, ba := range dense {
+			if len(ba.blocks) < n {
+				n = len(ba.blocks)
+			}
+		}
+
+		result := newBitArray(capacity)
+		copy(result.blocks, dense[0].blocks[:n])
+		for _, ba := range dense[1:] {
+			andBlocks(result.blocks[:n], result.blocks, ba.blocks)
+		}
+
+		result.setLowest()
+		result.setHighest()
+		return result
+	}
+
+	return aggregate(arrays, func(group blocks) block {
+		// a missing block is empty, so nothing is set in all arrays
+		if len(group) < len(arrays) {
+			return 0
+		}
+
+		result := ^block(0)
+		for _, b := range group {
+			result &= b
+		}
+		return result
+	})
+}
+
+// Threshold returns a new bit array with the bits that are set in at
+// least k of the provided bit arrays, computed in a single pass.  A
+// threshold of zero is treated as one.  The result is dense if any of
+// the inputs are dense and sparse otherwise.
+func Threshold(k uint64, arrays ...BitArray) BitArray {
+	if k == 0 {
+		k = 1
+	}
+
+	var counts [s]uint64
+	return aggregate(arrays, func(group blocks) block {
+		if uint64(len(group)) < k {
+			return 0
+		}
+
+		counts = [s]uint64{}
+		for _, b := range group {
+			for b != 0 {
+				counts[bits.TrailingZeros64(uint64(b))]++
+				b &= b - 1
+			}
+		}
+
+		result := block(0)
+		for i, count := range counts {
+			if count >= k {
+				result = result.insert(uint64(i))
+			}
+		}
+		return result
+	})
+}
+
+// AndNot will bitwise and ba with the complement of other in a single
+// pass and return a new bit array representing the result, which holds
+// the bits set in ba that are not set in other.  The result is dense
+// if ba is dense and sparse otherwise.
+func AndNot(ba, other BitArray) BitArray {
+	result := newSparseBitArray()
+	self := &blockCursor{iter: ba.Blocks()}
+	others := &blockCursor{iter: other.Blocks()}
+	otherOk := others.next()
+	for self.next() {
+		for otherOk && others.index < self.index {
+			otherOk = others.next()
+		}
+
+		b := self.block
+		if otherOk && others.index == self.index {
+			b &^= others.block
+		}
+
+		if b != 0 {
+			result.indices = append(result.indices, self.index)
+			result.blocks = append(result.blocks, b)
+		}
+	}
+
+	if isSparse(ba) {
+		return result
+	}
+
+	dba, err := toDense(result)
+	if err != nil {
+		return result
+	}
+	if dba.Capacity() < ba.Capacity() {
+		dba.Resize(ba.Capacity())
+	}
+
+	return dba
+}
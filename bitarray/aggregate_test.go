@@ -0,0 +1,192 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestOrAll(t *testing.T) {
+	assert.Empty(t, OrAll().ToNums())
+
+	a := newSparseBitArray()
+	b := newSparseBitArray()
+	c := newSparseBitArray()
+	a.SetBit(1)
+	b.SetBit(s * 5)
+	c.SetBit(1)
+	c.SetBit(s * 2)
+
+	result := OrAll(a, b, c)
+	assert.IsType(t, &sparseBitArray{}, result)
+	assert.Equal(t, []uint64{1, s * 2, s * 5}, result.ToNums())
+
+	d := newBitArray(s * 8)
+	d.SetBit(s * 3)
+	result = OrAll(a, b, c, d)
+	assert.IsType(t, &bitArray{}, result)
+	assert.Equal(t, s*8, result.Capacity())
+	assert.Equal(t, []uint64{1, s * 2, s * 3, s * 5}, result.ToNums())
+}
+
+func TestAndAll(t *testing.T) {
+	a := newSparseBitArray()
+	b := newBitArray(s * 4)
+	c := newSparseBitArray()
+	a.SetRange(0, s*3)
+	b.SetRange(s, s*4-1)
+	c.SetBit(s + 3)
+	c.SetBit(s * 3)
+
+	result := AndAll(a, b, c)
+	assert.IsType(t, &bitArray{}, result)
+	assert.Equal(t, []uint64{s + 3, s * 3}, result.ToNums())
+
+	result = AndAll(a, c)
+	assert.IsType(t, &sparseBitArray{}, result)
+	assert.Equal(t, []uint64{s + 3, s * 3}, result.ToNums())
+
+	assert.Empty(t, AndAll(a, newSparseBitArray()).ToNums())
+}
+
+func TestThreshold(t *testing.T) {
+	a := newSparseBitArray()
+	b := newSparseBitArray()
+	c := newSparseBitArray()
+	a.SetBit(1)
+	a.SetBit(2)
+	b.SetBit(2)
+	b.SetBit(s * 4)
+	c.SetBit(1)
+	c.SetBit(2)
+	c.SetBit(s * 9)
+
+	assert.Equal(t, []uint64{2}, Threshold(3, a, b, c).ToNums())
+	assert.Equal(t, []uint64{1, 2}, Threshold(2, a, b, c).ToNums())
+	assert.Equal(t, OrAll(a, b, c).ToNums(), Threshold(1, a, b, c).ToNums())
+	assert.Equal(t, OrAll(a, b, c).ToNums(), Threshold(0, a, b, c).ToNums())
+	assert.Empty(t, Threshold(4, a, b, c).ToNums())
+}
+
+func BenchmarkOrAll(b *testing.B) {
+	numItems := uint64(160000)
+	arrays := make([]BitArray, 0, 8)
+	for i := uint64(0); i < 8; i++ {
+		var ba BitArray
+		if i%2 == 0 {
+			ba = newBitArray(numItems)
+		} else {
+			ba = newSparseBitArray()
+		}
+		for j := i; j < numItems; j += 97 {
+			ba.SetBit(j)
+		}
+		arrays = append(arrays, ba)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		OrAll(arrays...)
+	}
+}
+
+func TestAndNot(t *testing.T) {
+	a := newSparseBitArray()
+	b := newBitArray(s * 4)
+	a.SetRange(0, s*3)
+	b.SetRange(s, s*2)
+	b.SetBit(s*4 - 1)
+
+	result := AndNot(a, b)
+	assert.IsType(t, &sparseBitArray{}, result)
+	assert.Equal(t, s*2, result.CountRange(0, s*4))
+	ok, _ := result.GetBit(s)
+	assert.False(t, ok)
+	ok, _ = result.GetBit(s*2 + 1)
+	assert.True(t, ok)
+
+	result = AndNot(b, a)
+	assert.IsType(t, &bitArray{}, result)
+	assert.Equal(t, s*4, result.Capacity())
+	assert.Equal(t, []uint64{s*4 - 1}, result.ToNums())
+}
+
+func TestAndNotEmpty(t *testing.T) {
+	a := newBitArray(s * 2)
+	a.SetBit(3)
+	a.SetBit(s + 1)
+
+	result := AndNot(a, newSparseBitArray())
+	assert.True(t, result.Equals(a))
+	assert.Equal(t, s*2, result.Capacity())
+
+	// the result is a copy
+	result.SetBit(4)
+	assert.Equal(t, []uint64{3, s + 1}, a.ToNums())
+
+	result = AndNot(newSparseBitArray(), a)
+	assert.IsType(t, &sparseBitArray{}, result)
+	assert.Len(t, result.ToNums(), 0)
+
+	result = AndNot(a, a)
+	assert.Equal(t, uint64(0), result.CountRange(0, s*2))
+}
+
+func TestAndNotMatchesAnd(t *testing.T) {
+	a := newSparseBitArray()
+	b := NewHybridBitArray()
+	for i := uint64(0); i < s*20; i += 3 {
+		a.SetBit(i)
+	}
+	for i := uint64(0); i < s*30; i += 5 {
+		b.SetBit(i)
+	}
+
+	expected := make([]uint64, 0)
+	for _, k := range a.ToNums() {
+		if k%5 != 0 {
+			expected = append(expected, k)
+		}
+	}
+
+	assert.Equal(t, expected, AndNot(a, b).ToNums())
+
+	c := newConcurrentSparseBitArray(4)
+	for _, k := range a.ToNums() {
+		c.SetBit(k)
+	}
+	assert.Equal(t, expected, AndNot(c, b).ToNums())
+}
+
+func BenchmarkAndNot(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+	other := newSparseBitArray()
+	for i := uint64(0); i < numItems; i += 3 {
+		ba.SetBit(i)
+	}
+	for i := uint64(0); i < numItems; i += 97 {
+		other.SetBit(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		AndNot(ba, other)
+	}
+}
@@ -28,6 +28,9 @@ type bitArray struct {
 	lowest  uint64
 	highest uint64
 	anyset  bool
+	// growable bit arrays extend their blocks instead of
+	// returning an OutOfRangeError.
+	growable bool
 }
 
 func getIndexAndRemainder(k uint64) (uint64, uint64) {
@@ -83,9 +86,15 @@ func (ba *bitArray) ToNums() []uint64 {
 	return nums
 }
 
+// ToNumsBetween converts this bit array to the list of numbers
+// contained within it from start to stop, inclusive.
+func (ba *bitArray) ToNumsBetween(start, stop uint64) []uint64 {
+	return toNumsBetween(ba, start, stop)
+}
+
 // SetBit sets a bit at the given index to true.
 func (ba *bitArray) SetBit(k uint64) error {
-	if k > ba.Capacity() {
+	if !ba.fits(k) {
 		return OutOfRangeError(k)
 	}
 
@@ -109,7 +118,10 @@ func (ba *bitArray) SetBit(k uint64) error {
 // GetBit returns a bool indicating if the value at the given
 // index has been set.
 func (ba *bitArray) GetBit(k uint64) (bool, error) {
-	if k > ba.Capacity() {
+	if k >= ba.Capacity() {
+		if ba.growable {
+			return false, nil
+		}
 		return false, OutOfRangeError(k)
 	}
 
@@ -120,7 +132,10 @@ func (ba *bitArray) GetBit(k uint64) (bool, error) {
 
 //ClearBit will unset a bit at the given index if it is set.
 func (ba *bitArray) ClearBit(k uint64) error {
-	if k > ba.Capacity() {
+	if k >= ba.Capacity() {
+		if ba.growable {
+			return nil
+		}
 		return OutOfRangeError(k)
 	}
 
@@ -139,14 +154,172 @@ func (ba *bitArray) ClearBit(k uint64) error {
 	return nil
 }
 
+// applyRange calls op with each block touched by the provided range
+// and the mask of positions in that block falling inside the range.
+func (ba *bitArray) applyRange(start, stop uint64, op func(b, mask block) block) error {
+	if !ba.fits(stop) {
+		return OutOfRangeError(stop)
+	}
+
+	if start > stop {
+		return nil
+	}
+
+	startIndex, _ := getIndexAndRemainder(start)
+	stopIndex, _ := getIndexAndRemainder(stop)
+	for i := startIndex; i <= stopIndex; i++ {
+		ba.blocks[i] = op(ba.blocks[i], blockRangeMask(i, start, stop))
+	}
+
+	return nil
+}
+
+// SetRange sets every bit from start to stop, inclusive.
+func (ba *bitArray) SetRange(start, stop uint64) error {
+	err := ba.applyRange(start, stop, func(b, mask block) block {
+		return b | mask
+	})
+	if err != nil || start > stop {
+		return err
+	}
+
+	if !ba.anyset {
+		ba.lowest = start
+		ba.highest = stop
+	} else {
+		if start < ba.lowest {
+			ba.lowest = start
+		}
+		if stop > ba.highest {
+			ba.highest = stop
+		}
+	}
+	ba.anyset = true
+
+	return nil
+}
+
+// ClearRange clears every bit from start to stop, inclusive.
+func (ba *bitArray) ClearRange(start, stop uint64) error {
+	if ba.growable && stop >= ba.Capacity() {
+		// nothing past the end of a growable array is set
+		if start >= ba.Capacity() {
+			return nil
+		}
+		stop = ba.Capacity() - 1
+	}
+
+	err := ba.applyRange(start, stop, func(b, mask block) block {
+		return b &^ mask
+	})
+	if err != nil || start > stop || !ba.anyset {
+		return err
+	}
+
+	if ba.lowest >= start && ba.lowest <= stop {
+		ba.setLowest()
+	}
+	if ba.anyset && ba.highest >= start && ba.highest <= stop {
+		ba.setHighest()
+	}
+
+	return nil
+}
+
+// FlipRange flips every bit from start to stop, inclusive.
+func (ba *bitArray) FlipRange(start, stop uint64) error {
+	err := ba.applyRange(start, stop, func(b, mask block) block {
+		return b ^ mask
+	})
+	if err != nil || start > stop {
+		return err
+	}
+
+	ba.setLowest()
+	if ba.anyset {
+		ba.setHighest()
+	}
+
+	return nil
+}
+
+// CountRange returns the number of set bits from start to stop,
+// inclusive.  Positions beyond the capacity of this bit array are
+// treated as unset.
+func (ba *bitArray) CountRange(start, stop uint64) uint64 {
+	if !ba.anyset || start > stop || start >= ba.Capacity() {
+		return 0
+	}
+
+	if stop >= ba.Capacity() {
+		stop = ba.Capacity() - 1
+	}
+
+	startIndex, _ := getIndexAndRemainder(start)
+	stopIndex, _ := getIndexAndRemainder(stop)
+	if startIndex == stopIndex {
+		return (ba.blocks[startIndex] & blockRangeMask(startIndex, start, stop)).count()
+	}
+
+	count := (ba.blocks[startIndex] & blockRangeMask(startIndex, start, stop)).count()
+	count += popcountBlocks(ba.blocks[startIndex+1 : stopIndex])
+	count += (ba.blocks[stopIndex] & blockRangeMask(stopIndex, start, stop)).count()
+	return count
+}
+
+// ShiftLeft moves every bit n positions higher.  Bits moved past the
+// capacity of this bit array are dropped unless it is growable.
+func (ba *bitArray) ShiftLeft(n uint64) {
+	ba.InsertBits(0, n)
+}
+
+// ShiftRight moves every bit n positions lower, dropping the bits
+// below n.
+func (ba *bitArray) ShiftRight(n uint64) {
+	ba.DeleteBits(0, n)
+}
+
+// InsertBits moves every bit at or above the provided position count
+// positions higher, leaving the inserted positions unset.  Bits moved
+// past the capacity of this bit array are dropped unless it is
+// growable, in which case it grows to hold them.
+func (ba *bitArray) InsertBits(at, count uint64) {
+	if !ba.anyset || ba.highest < at || count == 0 {
+		return
+	}
+
+	if ba.growable && ba.highest+count > ba.highest {
+		ba.fits(ba.highest + count)
+	}
+
+	insertBits(ba.blocks, at, count)
+	ba.setLowest()
+	ba.setHighest()
+}
+
+// DeleteBits removes the count bits starting at the provided position
+// and moves every bit above them count positions lower.
+func (ba *bitArray) DeleteBits(at, count uint64) {
+	if !ba.anyset || ba.highest < at || count == 0 {
+		return
+	}
+
+	deleteBits(ba.blocks, at, count)
+	ba.setLowest()
+	ba.setHighest()
+}
+
 // Or will bitwise or two bit arrays and return a new bit array
 // representing the result.
 func (ba *bitArray) Or(other BitArray) BitArray {
-	if dba, ok := other.(*bitArray); ok {
-		return orDenseWithDenseBitArray(ba, dba)
+	switch cba := concrete(other).(type) {
+	case *bitArray:
+		return orDenseWithDenseBitArray(ba, cba)
+	case *sparseBitArray:
+		return orSparseWithDenseBitArray(cba, ba)
 	}
 
-	return orSparseWithDenseBitArray(other.(*sparseBitArray), ba)
+	return OrAll(ba, other)
 }
 
 // Reset clears out the bit array.
@@ -159,6 +332,16 @@ func (ba *bitArray) Reset() {
 
 // Equals returns a bool indicating if these two bit arrays are equal.
 func (ba *bitArray) Equals(other BitArray) bool {
+	if dba, ok := other.(*bitArray); ok {
+		return ba.equalsDenseBitArray(dba)
+	}
+
+	if _, ok := other.(*sparseBitArray); !ok {
+		// other implementations compare themselves block by block,
+		// so this does the same to agree with them
+		return sameBits(ba, other)
+	}
+
 	if other.Capacity() == 0 && ba.highest > 0 {
 		return false
 	}
@@ -170,6 +353,13 @@ func (ba *bitArray) Equals(other BitArray) bool {
 	var selfIndex uint64
 	for iter := other.Blocks(); iter.Next(); {
 		toIndex, otherBlock := iter.Value()
+		if toIndex >= uint64(len(ba.blocks)) {
+			if otherBlock > 0 {
+				return false
+			}
+			continue
+		}
+
 		if toIndex > selfIndex {
 			for i := selfIndex; i < toIndex; i++ {
 				if ba.blocks[i] > 0 {
@@ -202,11 +392,28 @@ func (ba *bitArray) Intersects(other BitArray) bool {
 		return false
 	}
 
-	if sba, ok := other.(*sparseBitArray); ok {
-		return ba.intersectsSparseBitArray(sba)
+	switch cba := concrete(other).(type) {
+	case *sparseBitArray:
+		return ba.intersectsSparseBitArray(cba)
+	case *bitArray:
+		return ba.intersectsDenseBitArray(cba)
 	}
 
-	return ba.intersectsDenseBitArray(other.(*bitArray))
+	return IsSubsetOf(other, ba)
+}
+
+// IntersectsBetween returns a bool indicating if every bit set in the
+// provided bit array from start to stop, inclusive, is also set in
+// this bit array.
+func (ba *bitArray) IntersectsBetween(other BitArray, start, stop uint64) bool {
+	return intersectsBetween(ba, other, start, stop)
+}
+
+// EqualsBetween returns a bool indicating if this bit array and the
+// provided bit array have the same bits set from start to stop,
+// inclusive.
+func (ba *bitArray) EqualsBetween(other BitArray, start, stop uint64) bool {
+	return equalsBetween(ba, other, start, stop)
 }
 
 // Blocks will return an iterator over this bit array.
@@ -214,6 +421,64 @@ func (ba *bitArray) Blocks() Iterator {
 	return newBitArrayIterator(ba)
 }
 
+// Bits will return an iterator over the set bits in this bit array.
+func (ba *bitArray) Bits() BitIterator {
+	return newBitIterator(ba.Blocks())
+}
+
+// NextSetBit returns the position of the first set bit at or after
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (ba *bitArray) NextSetBit(from uint64) (uint64, bool) {
+	if !ba.anyset || from > ba.highest {
+		return 0, false
+	}
+
+	if from <= ba.lowest {
+		return ba.lowest, true
+	}
+
+	i, pos := getIndexAndRemainder(from)
+	if pos = ba.blocks[i].nextSetPosition(pos); pos < s {
+		return i*s + pos, true
+	}
+
+	for i++; i < uint64(len(ba.blocks)); i++ {
+		if ba.blocks[i] != 0 {
+			return i*s + ba.blocks[i].findRightPosition(), true
+		}
+	}
+
+	return 0, false
+}
+
+// PrevSetBit returns the position of the last set bit at or before
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (ba *bitArray) PrevSetBit(from uint64) (uint64, bool) {
+	if !ba.anyset || from < ba.lowest {
+		return 0, false
+	}
+
+	if from >= ba.highest {
+		return ba.highest, true
+	}
+
+	i, pos := getIndexAndRemainder(from)
+	if pos = ba.blocks[i].prevSetPosition(pos); pos < s {
+		return i*s + pos, true
+	}
+
+	for i > 0 {
+		i--
+		if ba.blocks[i] != 0 {
+			return i*s + ba.blocks[i].findLeftPosition(), true
+		}
+	}
+
+	return 0, false
+}
+
 // complement flips all bits in this array.
 func (ba *bitArray) complement() {
 	for i := uint64(0); i < uint64(len(ba.blocks)); i++ {
@@ -228,6 +493,10 @@ func (ba *bitArray) complement() {
 
 func (ba *bitArray) intersectsSparseBitArray(other *sparseBitArray) bool {
 	for i, index := range other.indices {
+		if index >= uint64(len(ba.blocks)) {
+			return false
+		}
+
 		if !ba.blocks[index].intersects(other.blocks[i]) {
 			return false
 		}
@@ -237,8 +506,16 @@ func (ba *bitArray) intersectsSparseBitArray(other *sparseBitArray) bool {
 }
 
 func (ba *bitArray) intersectsDenseBitArray(other *bitArray) bool {
-	for i, block := range other.blocks {
-		if !ba.blocks[i].intersects(block) {
+	// and a chunk at a time so the kernels can run without allocating
+	var and [64]block
+	for i := 0; i < len(other.blocks); i += len(and) {
+		chunk := other.blocks[i:]
+		if len(chunk) > len(and) {
+			chunk = chunk[:len(and)]
+		}
+
+		andBlocks(and[:len(chunk)], ba.blocks[i:], chunk)
+		if !equalBlocks(and[:len(chunk)], chunk) {
 			return false
 		}
 	}
@@ -246,14 +523,91 @@ func (ba *bitArray) intersectsDenseBitArray(other *bitArray) bool {
 	return true
 }
 
+func (ba *bitArray) equalsDenseBitArray(other *bitArray) bool {
+	n := len(ba.blocks)
+	if len(other.blocks) < n {
+		n = len(other.blocks)
+	}
+
+	if !equalBlocks(ba.blocks[:n], other.blocks[:n]) {
+		return false
+	}
+
+	// whatever is past the end of the shorter array must be empty
+	return popcountBlocks(ba.blocks[n:]) == 0 && popcountBlocks(other.blocks[n:]) == 0
+}
+
+// fits returns a bool indicating if the given position is within the
+// capacity of this bit array, first growing a growable bit array to
+// hold it.
+func (ba *bitArray) fits(k uint64) bool {
+	if k < ba.Capacity() {
+		return true
+	}
+
+	if !ba.growable {
+		return false
+	}
+
+	i, _ := getIndexAndRemainder(k)
+	ba.grow(i + 1)
+	return true
+}
+
+// Resize changes the capacity of this bit array.  Capacity is rounded
+// up to a whole number of blocks as in NewBitArray.  Any bits at or past
+// the new capacity are cleared.
+func (ba *bitArray) Resize(capacity uint64) {
+	i, r := getIndexAndRemainder(capacity)
+	if r > 0 {
+		i++
+	}
+
+	if i > uint64(len(ba.blocks)) {
+		ba.grow(i)
+		return
+	}
+
+	blocks := make(blocks, i)
+	copy(blocks, ba.blocks)
+	if r > 0 {
+		blocks[i-1] &= rangeMask(0, r-1)
+	}
+	ba.blocks = blocks
+
+	if !ba.anyset || ba.highest < capacity {
+		return
+	}
+
+	if ba.lowest >= capacity {
+		ba.anyset = false
+		ba.lowest = 0
+		ba.highest = 0
+		return
+	}
+
+	ba.setHighest()
+}
+
+// grow extends this bit array to hold at least the provided number
+// of blocks.
+func (ba *bitArray) grow(numBlocks uint64) {
+	if numBlocks <= uint64(len(ba.blocks)) {
+		return
+	}
+
+	ba.blocks = append(ba.blocks, make(blocks, numBlocks-uint64(len(ba.blocks)))...)
+}
+
 func (ba *bitArray) copy() BitArray {
 	blocks := make(blocks, len(ba.blocks))
 	copy(blocks, ba.blocks)
 	return &bitArray{
-		blocks:  blocks,
-		lowest:  ba.lowest,
-		highest: ba.highest,
-		anyset:  ba.anyset,
+		blocks:   blocks,
+		lowest:   ba.lowest,
+		highest:  ba.highest,
+		anyset:   ba.anyset,
+		growable: ba.growable,
 	}
 }
 
@@ -290,3 +644,12 @@ func newBitArray(size uint64, args ...bool) *bitArray {
 func NewBitArray(size uint64, args ...bool) BitArray {
 	return newBitArray(size, args...)
 }
+
+// NewGrowableBitArray returns a new dense BitArray at the specified
+// size that grows as bits past its capacity are set instead of
+// returning an OutOfRangeError.
+func NewGrowableBitArray(size uint64) ResizableBitArray {
+	ba := newBitArray(size)
+	ba.growable = true
+	return ba
+}
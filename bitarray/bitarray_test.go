@@ -454,3 +454,329 @@ func BenchmarkBitArrayToNums(b *testing.B) {
 		ba.ToNums()
 	}
 }
+
+func TestBitArrayNextSetBit(t *testing.T) {
+	ba := newBitArray(s * 4)
+
+	_, ok := ba.NextSetBit(0)
+	assert.False(t, ok)
+
+	ba.SetBit(5)
+	ba.SetBit(s + 1)
+	ba.SetBit(s * 3)
+
+	result, ok := ba.NextSetBit(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), result)
+
+	result, ok = ba.NextSetBit(5)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), result)
+
+	result, ok = ba.NextSetBit(6)
+	assert.True(t, ok)
+	assert.Equal(t, s+1, result)
+
+	result, ok = ba.NextSetBit(s + 2)
+	assert.True(t, ok)
+	assert.Equal(t, s*3, result)
+
+	_, ok = ba.NextSetBit(s*3 + 1)
+	assert.False(t, ok)
+}
+
+func TestBitArrayPrevSetBit(t *testing.T) {
+	ba := newBitArray(s * 4)
+
+	_, ok := ba.PrevSetBit(s)
+	assert.False(t, ok)
+
+	ba.SetBit(5)
+	ba.SetBit(s + 1)
+	ba.SetBit(s * 3)
+
+	result, ok := ba.PrevSetBit(s * 4)
+	assert.True(t, ok)
+	assert.Equal(t, s*3, result)
+
+	result, ok = ba.PrevSetBit(s*3 - 1)
+	assert.True(t, ok)
+	assert.Equal(t, s+1, result)
+
+	result, ok = ba.PrevSetBit(s)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), result)
+
+	_, ok = ba.PrevSetBit(4)
+	assert.False(t, ok)
+}
+
+func TestBitArrayBits(t *testing.T) {
+	ba := newBitArray(s * 4)
+	ba.SetBit(0)
+	ba.SetBit(s - 1)
+	ba.SetBit(s * 2)
+	ba.SetBit(s*4 - 1)
+
+	result := make([]uint64, 0, 4)
+	for iter := ba.Bits(); iter.Next(); {
+		result = append(result, iter.Value())
+	}
+
+	assert.Equal(t, ba.ToNums(), result)
+
+	ba.Reset()
+	assert.False(t, ba.Bits().Next())
+	assert.False(t, newBitArray(0).Bits().Next())
+}
+
+func BenchmarkBitArrayNextSetBit(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+
+	for i := uint64(0); i < numItems; i += s / 2 {
+		ba.SetBit(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j, ok := ba.NextSetBit(0); ok; j, ok = ba.NextSetBit(j + 1) {
+		}
+	}
+}
+
+func TestBitArraySetRange(t *testing.T) {
+	ba := newBitArray(s * 4)
+
+	err := ba.SetRange(s-2, s*2+1)
+	assert.Nil(t, err)
+	assert.Equal(t, s-2, ba.lowest)
+	assert.Equal(t, s*2+1, ba.highest)
+	assert.Equal(t, s+4, ba.CountRange(0, s*4-1))
+
+	ok, _ := ba.GetBit(s - 3)
+	assert.False(t, ok)
+	ok, _ = ba.GetBit(s + 5)
+	assert.True(t, ok)
+	ok, _ = ba.GetBit(s*2 + 2)
+	assert.False(t, ok)
+
+	err = ba.SetRange(0, s*4)
+	assert.IsType(t, OutOfRangeError(0), err)
+}
+
+func TestBitArrayClearRange(t *testing.T) {
+	ba := newBitArray(s*4, true)
+
+	err := ba.ClearRange(0, s)
+	assert.Nil(t, err)
+	assert.Equal(t, s+1, ba.lowest)
+	assert.Equal(t, s*4-1, ba.highest)
+	assert.Equal(t, s*3-1, ba.CountRange(0, s*4-1))
+
+	ba.ClearRange(s*2, s*4-1)
+	assert.Equal(t, s+1, ba.lowest)
+	assert.Equal(t, s*2-1, ba.highest)
+
+	ba.ClearRange(0, s*4-1)
+	assert.False(t, ba.anyset)
+	assert.Equal(t, uint64(0), ba.CountRange(0, s*4-1))
+}
+
+func TestBitArrayFlipRange(t *testing.T) {
+	ba := newBitArray(s * 2)
+	ba.SetBit(3)
+
+	err := ba.FlipRange(2, s)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(2), ba.lowest)
+	assert.Equal(t, s, ba.highest)
+	assert.Equal(t, s-2, ba.CountRange(0, s*2-1))
+
+	ok, _ := ba.GetBit(3)
+	assert.False(t, ok)
+
+	ba.FlipRange(2, s)
+	assert.Equal(t, []uint64{3}, ba.ToNums())
+	assert.Equal(t, uint64(3), ba.lowest)
+	assert.Equal(t, uint64(3), ba.highest)
+}
+
+func TestBitArrayCountRange(t *testing.T) {
+	ba := newBitArray(s * 2)
+	ba.SetBit(1)
+	ba.SetBit(s)
+	ba.SetBit(s + 3)
+
+	assert.Equal(t, uint64(3), ba.CountRange(0, s*10))
+	assert.Equal(t, uint64(2), ba.CountRange(2, s+3))
+	assert.Equal(t, uint64(1), ba.CountRange(s+1, s+3))
+	assert.Equal(t, uint64(0), ba.CountRange(s+3, s))
+}
+
+func BenchmarkBitArraySetRange(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ba.SetRange(1, numItems-2)
+	}
+}
+
+func TestBitArrayComparesPastCapacity(t *testing.T) {
+	ba := newBitArray(s * 2)
+	sba := newSparseBitArray()
+	sba.SetBit(s * 5)
+
+	assert.False(t, ba.Equals(sba))
+	assert.False(t, ba.Intersects(sba))
+}
+
+func TestSetBitAtCapacity(t *testing.T) {
+	ba := newBitArray(s)
+
+	err := ba.SetBit(s)
+	assert.IsType(t, OutOfRangeError(0), err)
+}
+
+func TestGrowableBitArray(t *testing.T) {
+	ba := NewGrowableBitArray(s).(*bitArray)
+
+	err := ba.SetBit(s*3 + 1)
+	assert.Nil(t, err)
+	assert.Equal(t, s*4, ba.Capacity())
+	assert.Equal(t, s*3+1, ba.lowest)
+	assert.Equal(t, s*3+1, ba.highest)
+
+	ok, err := ba.GetBit(s * 10)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+	assert.Nil(t, ba.ClearBit(s*10))
+	assert.Equal(t, s*4, ba.Capacity())
+
+	err = ba.SetRange(s*5, s*6)
+	assert.Nil(t, err)
+	assert.Equal(t, s*7, ba.Capacity())
+	assert.Equal(t, s*6, ba.highest)
+
+	assert.Nil(t, ba.ClearRange(s*6, s*20))
+	assert.Equal(t, s*6-1, ba.highest)
+	assert.Equal(t, s*7, ba.Capacity())
+}
+
+func TestResizeBitArray(t *testing.T) {
+	ba := newBitArray(s * 4)
+	ba.SetBit(1)
+	ba.SetBit(s + 10)
+	ba.SetBit(s * 3)
+
+	ba.Resize(s * 8)
+	assert.Equal(t, s*8, ba.Capacity())
+	assert.Equal(t, []uint64{1, s + 10, s * 3}, ba.ToNums())
+	assert.Nil(t, ba.SetBit(s*7))
+
+	ba.Resize(s + 5)
+	assert.Equal(t, s*2, ba.Capacity())
+	assert.Equal(t, []uint64{1}, ba.ToNums())
+	assert.Equal(t, uint64(1), ba.lowest)
+	assert.Equal(t, uint64(1), ba.highest)
+	assert.True(t, ba.anyset)
+
+	ba.Resize(1)
+	assert.Equal(t, s, ba.Capacity())
+	assert.False(t, ba.anyset)
+	assert.Empty(t, ba.ToNums())
+
+	var resizable ResizableBitArray = newBitArray(10)
+	resizable.Resize(s * 2)
+	assert.Equal(t, s*2, resizable.Capacity())
+}
+
+func BenchmarkGrowableSetBit(b *testing.B) {
+	numItems := uint64(160000)
+
+	for i := 0; i < b.N; i++ {
+		ba := NewGrowableBitArray(0)
+		for j := uint64(0); j < numItems; j++ {
+			ba.SetBit(j)
+		}
+	}
+}
+
+func TestBitArrayIntersectsBetween(t *testing.T) {
+	ba := newBitArray(s * 4)
+	other := newBitArray(s * 4)
+
+	ba.SetBit(5)
+	ba.SetBit(s + 10)
+	other.SetBit(5)
+	other.SetBit(s + 11)
+	other.SetBit(s * 3)
+
+	assert.True(t, ba.IntersectsBetween(other, 0, s+10))
+	assert.False(t, ba.IntersectsBetween(other, 0, s+11))
+	assert.False(t, ba.IntersectsBetween(other, s*2, s*3))
+	assert.True(t, ba.IntersectsBetween(other, s*3+1, s*10))
+	assert.True(t, ba.IntersectsBetween(other, 10, 5))
+	assert.True(t, other.IntersectsBetween(ba, 0, s))
+
+	sba := newSparseBitArray()
+	sba.SetBit(s + 10)
+	sba.SetBit(s * 8)
+	assert.True(t, ba.IntersectsBetween(sba, s, s*2))
+	assert.False(t, ba.IntersectsBetween(sba, s, s*8))
+}
+
+func TestBitArrayEqualsBetween(t *testing.T) {
+	ba := newBitArray(s * 4)
+	other := newBitArray(s * 2)
+
+	ba.SetBit(5)
+	ba.SetBit(s + 10)
+	ba.SetBit(s * 3)
+	other.SetBit(5)
+	other.SetBit(s + 10)
+	other.SetBit(s + 11)
+
+	assert.True(t, ba.EqualsBetween(other, 0, s+10))
+	assert.False(t, ba.EqualsBetween(other, 0, s+11))
+	assert.True(t, ba.EqualsBetween(other, s+12, s*3-1))
+	assert.False(t, ba.EqualsBetween(other, s*2, s*3))
+	assert.True(t, ba.EqualsBetween(other, 10, 5))
+
+	sba := newSparseBitArray()
+	sba.SetBit(s * 3)
+	assert.True(t, ba.EqualsBetween(sba, s*2, s*5))
+	assert.False(t, ba.EqualsBetween(sba, 0, s*5))
+}
+
+func TestBitArrayToNumsBetween(t *testing.T) {
+	ba := newBitArray(s * 4)
+	ba.SetBit(5)
+	ba.SetBit(s - 1)
+	ba.SetBit(s + 10)
+	ba.SetBit(s * 3)
+
+	assert.Equal(t, []uint64{5, s - 1, s + 10}, ba.ToNumsBetween(0, s+10))
+	assert.Equal(t, []uint64{s - 1, s + 10}, ba.ToNumsBetween(6, s*3-1))
+	assert.Equal(t, []uint64{s * 3}, ba.ToNumsBetween(s*3, s*10))
+	assert.Empty(t, ba.ToNumsBetween(6, s-2))
+	assert.Empty(t, ba.ToNumsBetween(10, 5))
+}
+
+func BenchmarkBitArrayIntersectsBetween(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+	other := newBitArray(numItems)
+	for i := uint64(0); i < numItems; i += 3 {
+		ba.SetBit(i)
+		other.SetBit(i)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ba.IntersectsBetween(other, numItems/2, numItems/2+s*10)
+	}
+}
@@ -16,6 +16,8 @@ limitations under the License.
 
 package bitarray
 
+import "math/bits"
+
 // s denotes the size of any element in the block array.  Cannot use
 // unsafe.SizeOf here as you can't take the size of a type.
 const s = uint64(64)
@@ -25,33 +27,41 @@ const s = uint64(64)
 type block uint64
 
 func (b block) toNums(offset uint64, nums *[]uint64) {
-	for i := uint64(0); i < s; i++ {
-		if b&block(1<<i) > 0 {
-			*nums = append(*nums, i+offset)
-		}
+	for b != 0 {
+		*nums = append(*nums, uint64(bits.TrailingZeros64(uint64(b)))+offset)
+		b &= b - 1
 	}
 }
 
 func (b block) findLeftPosition() uint64 {
-	for i := s - 1; i < s; i-- {
-		test := block(1 << i)
-		if b&test == test {
-			return i
-		}
+	if b == 0 {
+		return s
 	}
 
-	return s
+	return uint64(bits.Len64(uint64(b))) - 1
 }
 
 func (b block) findRightPosition() uint64 {
-	for i := uint64(0); i < s; i++ {
-		test := block(1 << i)
-		if b&test == test {
-			return i
-		}
+	if b == 0 {
+		return s
 	}
 
-	return s
+	return uint64(bits.TrailingZeros64(uint64(b)))
+}
+
+// nextSetPosition returns the position of the first set bit in
+// this block at or after the provided position.  Returns s if
+// no such bit exists.
+func (b block) nextSetPosition(position uint64) uint64 {
+	return (b >> position << position).findRightPosition()
+}
+
+// prevSetPosition returns the position of the last set bit in
+// this block at or before the provided position.  Returns s if
+// no such bit exists.
+func (b block) prevSetPosition(position uint64) uint64 {
+	shift := s - 1 - position
+	return (b << shift >> shift).findLeftPosition()
 }
 
 func (b block) insert(position uint64) block {
@@ -77,3 +87,28 @@ func (b block) equals(other block) bool {
 func (b block) intersects(other block) bool {
 	return b&other == other
 }
+
+// rangeMask returns a block with every position from start to stop,
+// inclusive, set.
+func rangeMask(start, stop uint64) block {
+	return (^block(0) << start) & (^block(0) >> (s - 1 - stop))
+}
+
+// blockRangeMask returns the mask of positions in the block at index i
+// that fall between the provided bit positions, inclusive.
+func blockRangeMask(i, start, stop uint64) block {
+	startIndex, startPos := getIndexAndRemainder(start)
+	stopIndex, stopPos := getIndexAndRemainder(stop)
+	if i != startIndex {
+		startPos = 0
+	}
+	if i != stopIndex {
+		stopPos = s - 1
+	}
+
+	return rangeMask(startPos, stopPos)
+}
+
+func (b block) count() uint64 {
+	return uint64(bits.OnesCount64(uint64(b)))
+}
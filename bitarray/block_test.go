@@ -48,3 +48,34 @@ func BenchmarkBlockToNums(b *testing.B) {
 		block.toNums(0, &nums)
 	}
 }
+
+func TestBlockFindPositions(t *testing.T) {
+	b := block(0)
+
+	assert.Equal(t, s, b.findLeftPosition())
+	assert.Equal(t, s, b.findRightPosition())
+
+	b = b.insert(3)
+	b = b.insert(s - 1)
+
+	assert.Equal(t, s-1, b.findLeftPosition())
+	assert.Equal(t, uint64(3), b.findRightPosition())
+
+	assert.Equal(t, uint64(3), b.nextSetPosition(0))
+	assert.Equal(t, uint64(3), b.nextSetPosition(3))
+	assert.Equal(t, s-1, b.nextSetPosition(4))
+
+	assert.Equal(t, s-1, b.prevSetPosition(s-1))
+	assert.Equal(t, uint64(3), b.prevSetPosition(s-2))
+	assert.Equal(t, s, b.prevSetPosition(2))
+}
+
+func TestRangeMask(t *testing.T) {
+	assert.Equal(t, block(0xF0), rangeMask(4, 7))
+	assert.Equal(t, ^block(0), rangeMask(0, s-1))
+	assert.Equal(t, block(1), rangeMask(0, 0))
+
+	assert.Equal(t, ^block(0xF), blockRangeMask(0, 4, s*2))
+	assert.Equal(t, ^block(0), blockRangeMask(1, 4, s*2))
+	assert.Equal(t, block(1), blockRangeMask(2, 4, s*2))
+}
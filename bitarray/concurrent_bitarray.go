@@ -0,0 +1,428 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"encoding/binary"
+	"sync/atomic"
+)
+
+// concurrentBitArray is a dense bit array whose blocks are only ever
+// read and written atomically.  Single bit operations are lock free.
+// Operations over the whole array load each block once, in place, so
+// they are consistent per block but not across blocks.
+type concurrentBitArray struct {
+	blocks blocks
+}
+
+// concurrentBitArrayIterator walks the non-empty blocks of a
+// concurrent bit array, loading each block as it is reached.
+type concurrentBitArrayIterator struct {
+	index int64
+	cba   *concurrentBitArray
+	block block
+}
+
+// Next moves to the next non-empty block and returns a bool
+// indicating if one was found.
+func (iter *concurrentBitArrayIterator) Next() bool {
+	for iter.index++; iter.index < int64(len(iter.cba.blocks)); iter.index++ {
+		if iter.block = iter.cba.load(uint64(iter.index)); iter.block != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Value returns the index and the block loaded at this index.
+func (iter *concurrentBitArrayIterator) Value() (uint64, block) {
+	return uint64(iter.index), iter.block
+}
+
+func newConcurrentBitArrayIterator(cba *concurrentBitArray, from uint64) *concurrentBitArrayIterator {
+	return &concurrentBitArrayIterator{
+		cba:   cba,
+		index: int64(from) - 1,
+	}
+}
+
+func (cba *concurrentBitArray) load(i uint64) block {
+	return block(atomic.LoadUint64((*uint64)(&cba.blocks[i])))
+}
+
+func (cba *concurrentBitArray) store(i uint64, b block) {
+	atomic.StoreUint64((*uint64)(&cba.blocks[i]), uint64(b))
+}
+
+// concurrent returns this bit array.  Bit arrays embedding it use this
+// to be read in place by whole array operations.
+func (cba *concurrentBitArray) concurrent() *concurrentBitArray {
+	return cba
+}
+
+// update atomically replaces the block at the given index with the
+// result of op.
+func (cba *concurrentBitArray) update(i uint64, op func(block) block) {
+	addr := (*uint64)(&cba.blocks[i])
+	for {
+		old := atomic.LoadUint64(addr)
+		if atomic.CompareAndSwapUint64(addr, old, uint64(op(block(old)))) {
+			return
+		}
+	}
+}
+
+// Capacity returns the total capacity of the bit array.
+func (cba *concurrentBitArray) Capacity() uint64 {
+	return uint64(len(cba.blocks)) * s
+}
+
+// TestAndSetBit sets the bit at the given index and returns a bool
+// indicating if it was already set.
+func (cba *concurrentBitArray) TestAndSetBit(k uint64) (bool, error) {
+	if k >= cba.Capacity() {
+		return false, OutOfRangeError(k)
+	}
+
+	i, pos := getIndexAndRemainder(k)
+	mask := uint64(1) << pos
+	addr := (*uint64)(&cba.blocks[i])
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&mask != 0 {
+			return true, nil
+		}
+
+		if atomic.CompareAndSwapUint64(addr, old, old|mask) {
+			return false, nil
+		}
+	}
+}
+
+// TestAndClearBit clears the bit at the given index and returns a bool
+// indicating if it was set.
+func (cba *concurrentBitArray) TestAndClearBit(k uint64) (bool, error) {
+	if k >= cba.Capacity() {
+		return false, OutOfRangeError(k)
+	}
+
+	i, pos := getIndexAndRemainder(k)
+	mask := uint64(1) << pos
+	addr := (*uint64)(&cba.blocks[i])
+	for {
+		old := atomic.LoadUint64(addr)
+		if old&mask == 0 {
+			return false, nil
+		}
+
+		if atomic.CompareAndSwapUint64(addr, old, old&^mask) {
+			return true, nil
+		}
+	}
+}
+
+// SetBit sets a bit at the given index to true.
+func (cba *concurrentBitArray) SetBit(k uint64) error {
+	_, err := cba.TestAndSetBit(k)
+	return err
+}
+
+// GetBit returns a bool indicating if the value at the given
+// index has been set.
+func (cba *concurrentBitArray) GetBit(k uint64) (bool, error) {
+	if k >= cba.Capacity() {
+		return false, OutOfRangeError(k)
+	}
+
+	i, pos := getIndexAndRemainder(k)
+	return cba.load(i).get(pos), nil
+}
+
+// ClearBit will unset a bit at the given index if it is set.
+func (cba *concurrentBitArray) ClearBit(k uint64) error {
+	_, err := cba.TestAndClearBit(k)
+	return err
+}
+
+// applyRange atomically updates each block touched by the provided
+// range.  The range as a whole is not updated atomically.
+func (cba *concurrentBitArray) applyRange(start, stop uint64, op func(b, mask block) block) error {
+	if stop >= cba.Capacity() {
+		return OutOfRangeError(stop)
+	}
+
+	if start > stop {
+		return nil
+	}
+
+	startIndex, _ := getIndexAndRemainder(start)
+	stopIndex, _ := getIndexAndRemainder(stop)
+	for i := startIndex; i <= stopIndex; i++ {
+		mask := blockRangeMask(i, start, stop)
+		cba.update(i, func(b block) block {
+			return op(b, mask)
+		})
+	}
+
+	return nil
+}
+
+// SetRange sets every bit from start to stop, inclusive.
+func (cba *concurrentBitArray) SetRange(start, stop uint64) error {
+	return cba.applyRange(start, stop, func(b, mask block) block {
+		return b | mask
+	})
+}
+
+// ClearRange clears every bit from start to stop, inclusive.
+func (cba *concurrentBitArray) ClearRange(start, stop uint64) error {
+	return cba.applyRange(start, stop, func(b, mask block) block {
+		return b &^ mask
+	})
+}
+
+// FlipRange flips every bit from start to stop, inclusive.
+func (cba *concurrentBitArray) FlipRange(start, stop uint64) error {
+	return cba.applyRange(start, stop, func(b, mask block) block {
+		return b ^ mask
+	})
+}
+
+// CountRange returns the number of set bits from start to stop,
+// inclusive.  Positions beyond the capacity of this bit array are
+// treated as unset.
+func (cba *concurrentBitArray) CountRange(start, stop uint64) uint64 {
+	if start > stop || start >= cba.Capacity() {
+		return 0
+	}
+
+	if stop >= cba.Capacity() {
+		stop = cba.Capacity() - 1
+	}
+
+	startIndex, _ := getIndexAndRemainder(start)
+	stopIndex, _ := getIndexAndRemainder(stop)
+	count := uint64(0)
+	for i := startIndex; i <= stopIndex; i++ {
+		count += (cba.load(i) & blockRangeMask(i, start, stop)).count()
+	}
+
+	return count
+}
+
+// ShiftLeft moves every bit n positions higher, dropping the bits
+// moved past the capacity of this bit array.  This is not atomic with
+// respect to other writers.
+func (cba *concurrentBitArray) ShiftLeft(n uint64) {
+	cba.InsertBits(0, n)
+}
+
+// ShiftRight moves every bit n positions lower, dropping the bits
+// below n.  This is not atomic with respect to other writers.
+func (cba *concurrentBitArray) ShiftRight(n uint64) {
+	cba.DeleteBits(0, n)
+}
+
+// InsertBits moves every bit at or above the provided position count
+// positions higher, leaving the inserted positions unset and dropping
+// the bits moved past the capacity of this bit array.  This is not
+// atomic with respect to other writers.
+func (cba *concurrentBitArray) InsertBits(at, count uint64) {
+	insertBlocks(uint64(len(cba.blocks)), cba.load, cba.store, at, count)
+}
+
+// DeleteBits removes the count bits starting at the provided position
+// and moves every bit above them count positions lower.  This is not
+// atomic with respect to other writers.
+func (cba *concurrentBitArray) DeleteBits(at, count uint64) {
+	deleteBlocks(uint64(len(cba.blocks)), cba.load, cba.store, at, count)
+}
+
+// NextSetBit returns the position of the first set bit at or after
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (cba *concurrentBitArray) NextSetBit(from uint64) (uint64, bool) {
+	if from >= cba.Capacity() {
+		return 0, false
+	}
+
+	i, pos := getIndexAndRemainder(from)
+	if pos = cba.load(i).nextSetPosition(pos); pos < s {
+		return i*s + pos, true
+	}
+
+	for i++; i < uint64(len(cba.blocks)); i++ {
+		if b := cba.load(i); b != 0 {
+			return i*s + b.findRightPosition(), true
+		}
+	}
+
+	return 0, false
+}
+
+// PrevSetBit returns the position of the last set bit at or before
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (cba *concurrentBitArray) PrevSetBit(from uint64) (uint64, bool) {
+	if cba.Capacity() == 0 {
+		return 0, false
+	}
+
+	if from >= cba.Capacity() {
+		from = cba.Capacity() - 1
+	}
+
+	i, pos := getIndexAndRemainder(from)
+	if pos = cba.load(i).prevSetPosition(pos); pos < s {
+		return i*s + pos, true
+	}
+
+	for i > 0 {
+		i--
+		if b := cba.load(i); b != 0 {
+			return i*s + b.findLeftPosition(), true
+		}
+	}
+
+	return 0, false
+}
+
+// Reset clears out the bit array.
+func (cba *concurrentBitArray) Reset() {
+	for i := range cba.blocks {
+		cba.store(uint64(i), 0)
+	}
+}
+
+// Blocks returns an iterator over the non-empty blocks of this bit
+// array.  Each block is loaded as the iterator reaches it.
+func (cba *concurrentBitArray) Blocks() Iterator {
+	return newConcurrentBitArrayIterator(cba, 0)
+}
+
+// Bits returns an iterator over the set bits in this bit array.
+func (cba *concurrentBitArray) Bits() BitIterator {
+	return newBitIterator(cba.Blocks())
+}
+
+// Equals returns a bool indicating if this bit array and the provided
+// bit array have the same bits set.
+func (cba *concurrentBitArray) Equals(other BitArray) bool {
+	return sameBits(cba, other)
+}
+
+// Intersects returns a bool indicating if every bit set in the
+// provided bit array is also set in this bit array.
+func (cba *concurrentBitArray) Intersects(other BitArray) bool {
+	if other.Capacity() > cba.Capacity() {
+		return false
+	}
+
+	return IsSubsetOf(other, cba)
+}
+
+// IntersectsBetween returns a bool indicating if every bit set in the
+// provided bit array from start to stop, inclusive, is also set in
+// this bit array.
+func (cba *concurrentBitArray) IntersectsBetween(other BitArray, start, stop uint64) bool {
+	return intersectsBetween(cba, other, start, stop)
+}
+
+// EqualsBetween returns a bool indicating if this bit array and the
+// provided bit array have the same bits set from start to stop,
+// inclusive.
+func (cba *concurrentBitArray) EqualsBetween(other BitArray, start, stop uint64) bool {
+	return equalsBetween(cba, other, start, stop)
+}
+
+// Or will bitwise or this bit array with the provided bit array and
+// return a new, non-concurrent, bit array representing the result.
+func (cba *concurrentBitArray) Or(other BitArray) BitArray {
+	return OrAll(cba, other)
+}
+
+// ToNums converts this bit array to a list of numbers contained
+// within it.
+func (cba *concurrentBitArray) ToNums() []uint64 {
+	nums := make([]uint64, 0)
+	for iter := cba.Blocks(); iter.Next(); {
+		index, b := iter.Value()
+		b.toNums(index*s, &nums)
+	}
+
+	return nums
+}
+
+// ToNumsBetween converts this bit array to the list of numbers
+// contained within it from start to stop, inclusive.
+func (cba *concurrentBitArray) ToNumsBetween(start, stop uint64) []uint64 {
+	return toNumsBetween(cba, start, stop)
+}
+
+// MarshalBinary encodes this bit array using the dense encoding.
+func (cba *concurrentBitArray) MarshalBinary() ([]byte, error) {
+	output := newEncoding(denseKind, cba.Capacity(), len(cba.blocks), 0)
+	for i := range cba.blocks {
+		binary.LittleEndian.PutUint64(output[headerSize+i*wordSize:], uint64(cba.load(uint64(i))))
+	}
+
+	return output, nil
+}
+
+// UnmarshalBinary replaces the contents of this bit array with the
+// provided dense or sparse encoding.  The capacity of this bit array
+// does not change, so an OutOfRangeError is returned if the encoding
+// contains a bit past the end of this bit array.
+func (cba *concurrentBitArray) UnmarshalBinary(input []byte) error {
+	ba := newBitArray(0)
+	if err := ba.UnmarshalBinary(input); err != nil {
+		return err
+	}
+
+	if ba.anyset && ba.highest >= cba.Capacity() {
+		return OutOfRangeError(ba.highest)
+	}
+
+	for i := range cba.blocks {
+		var b block
+		if i < len(ba.blocks) {
+			b = ba.blocks[i]
+		}
+		cba.store(uint64(i), b)
+	}
+
+	return nil
+}
+
+func newConcurrentBitArray(size uint64) *concurrentBitArray {
+	i, r := getIndexAndRemainder(size)
+	if r > 0 {
+		i++
+	}
+
+	return &concurrentBitArray{
+		blocks: make(blocks, i),
+	}
+}
+
+// NewConcurrentBitArray returns a dense bit array at the specified size
+// that is safe for concurrent use.  Setting and clearing bits is lock
+// free.
+func NewConcurrentBitArray(size uint64) ConcurrentBitArray {
+	return newConcurrentBitArray(size)
+}
@@ -0,0 +1,217 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentTestAndSetBit(t *testing.T) {
+	cba := newConcurrentBitArray(s * 2)
+
+	result, err := cba.TestAndSetBit(5)
+	assert.Nil(t, err)
+	assert.False(t, result)
+
+	result, err = cba.TestAndSetBit(5)
+	assert.Nil(t, err)
+	assert.True(t, result)
+
+	result, err = cba.TestAndClearBit(5)
+	assert.Nil(t, err)
+	assert.True(t, result)
+
+	result, err = cba.TestAndClearBit(5)
+	assert.Nil(t, err)
+	assert.False(t, result)
+
+	_, err = cba.TestAndSetBit(s * 2)
+	assert.IsType(t, OutOfRangeError(0), err)
+	_, err = cba.GetBit(s * 2)
+	assert.IsType(t, OutOfRangeError(0), err)
+}
+
+func TestConcurrentSetBitInParallel(t *testing.T) {
+	numItems := uint64(1000)
+	numWorkers := 8
+	cba := newConcurrentBitArray(numItems)
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	firsts := uint64(0)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := uint64(0); j < numItems; j++ {
+				if ok, _ := cba.TestAndSetBit(j); !ok {
+					atomic.AddUint64(&firsts, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// every bit is claimed by exactly one worker
+	assert.Equal(t, numItems, firsts)
+	assert.Equal(t, numItems, cba.CountRange(0, numItems))
+}
+
+func TestConcurrentBitArrayOperations(t *testing.T) {
+	cba := newConcurrentBitArray(s * 4)
+	cba.SetBit(3)
+	cba.SetRange(s, s*2)
+
+	assert.Equal(t, s+2, cba.CountRange(0, s*4))
+
+	result, ok := cba.NextSetBit(4)
+	assert.True(t, ok)
+	assert.Equal(t, s, result)
+
+	result, ok = cba.PrevSetBit(s - 1)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(3), result)
+
+	ba := newBitArray(s * 4)
+	ba.SetBit(3)
+	ba.SetRange(s, s*2)
+	assert.True(t, cba.Equals(ba))
+	assert.True(t, ba.Equals(cba))
+	assert.True(t, ba.Intersects(cba))
+	assert.Equal(t, ba.ToNums(), cba.ToNums())
+
+	encoded, err := cba.MarshalBinary()
+	assert.Nil(t, err)
+	other := newConcurrentBitArray(s * 4)
+	assert.Nil(t, other.UnmarshalBinary(encoded))
+	assert.True(t, other.Equals(ba))
+
+	assert.IsType(t, OutOfRangeError(0), newConcurrentBitArray(s).UnmarshalBinary(encoded))
+
+	cba.ClearRange(0, s*4-1)
+	assert.Empty(t, cba.ToNums())
+}
+
+// allocated returns the number of bytes allocated while fn runs.
+func allocated(fn func()) uint64 {
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	fn()
+	runtime.ReadMemStats(&after)
+	return after.TotalAlloc - before.TotalAlloc
+}
+
+func TestConcurrentBitArrayReadsInPlace(t *testing.T) {
+	// 32MB of blocks, none of which should be copied to be read
+	size := uint64(1 << 28)
+	cba := newConcurrentBitArray(size)
+	cba.SetBit(3)
+	cba.SetBit(size - 1)
+	sba := newSparseBitArray()
+	sba.SetBit(3)
+	sba.SetBit(size - 1)
+
+	assert.True(t, allocated(func() {
+		count := 0
+		for iter := cba.Bits(); iter.Next(); {
+			count++
+		}
+		assert.Equal(t, 2, count)
+		assert.Equal(t, []uint64{3, size - 1}, cba.ToNums())
+		assert.True(t, cba.Equals(sba))
+		assert.True(t, sba.Equals(cba))
+		assert.True(t, cba.Intersects(sba))
+		assert.True(t, sba.EqualsBetween(cba, 0, size-1))
+	}) < size/s)
+
+	assert.True(t, allocated(func() {
+		cba.InsertBits(0, 1)
+		cba.DeleteBits(0, 1)
+	}) < size/s)
+	assert.Equal(t, []uint64{3}, cba.ToNums())
+}
+
+func TestConcurrentBitArrayEqualsEmpty(t *testing.T) {
+	empty := NewBitArray(0)
+	encoded, err := empty.MarshalBinary()
+	assert.Nil(t, err)
+	decoded, err := Unmarshal(encoded)
+	assert.Nil(t, err)
+
+	arrays := []BitArray{
+		NewConcurrentBitArray(1024),
+		NewConcurrentBitArray(0),
+		NewConcurrentSparseBitArray(4),
+		empty,
+		NewBitArray(1024),
+		NewSparseBitArray(),
+		NewHybridBitArray(),
+		decoded,
+	}
+
+	// empty bit arrays are equal whatever their kind or capacity
+	for i, ba := range arrays {
+		for j, other := range arrays {
+			assert.True(t, ba.Equals(other), `%d equals %d`, i, j)
+		}
+	}
+
+	cba := NewConcurrentBitArray(1024)
+	cba.SetBit(1000)
+	for i, ba := range arrays {
+		assert.False(t, ba.Equals(cba), `%d equals set`, i)
+		assert.False(t, cba.Equals(ba), `set equals %d`, i)
+	}
+}
+
+func BenchmarkConcurrentTestAndSetBit(b *testing.B) {
+	numItems := uint64(160000)
+	cba := newConcurrentBitArray(numItems)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		k := uint64(0)
+		for pb.Next() {
+			cba.TestAndSetBit(k % numItems)
+			k++
+		}
+	})
+}
+
+func TestConcurrentBetween(t *testing.T) {
+	cba := newConcurrentBitArray(s * 4)
+	csba := newConcurrentSparseBitArray(3)
+	hba := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+	for _, ba := range []BitArray{cba, csba, hba} {
+		ba.SetBit(5)
+		ba.SetBit(s + 10)
+	}
+
+	csba.SetBit(s * 3)
+	assert.True(t, cba.EqualsBetween(csba, 0, s*3-1))
+	assert.False(t, cba.EqualsBetween(csba, 0, s*3))
+	assert.True(t, csba.IntersectsBetween(cba, 0, s*4))
+	assert.False(t, cba.IntersectsBetween(csba, 0, s*4))
+	assert.True(t, hba.EqualsBetween(cba, 0, s*4))
+	assert.Equal(t, []uint64{s + 10, s * 3}, csba.ToNumsBetween(6, s*4))
+	assert.Equal(t, []uint64{5}, cba.ToNumsBetween(0, s))
+	assert.Equal(t, []uint64{5}, hba.ToNumsBetween(0, s))
+}
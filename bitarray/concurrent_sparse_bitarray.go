@@ -0,0 +1,391 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"sort"
+	"sync"
+)
+
+// indexedBlocks sorts parallel index and block slices by index.
+type indexedBlocks struct {
+	indices uintSlice
+	blocks  blocks
+}
+
+func (ib *indexedBlocks) Len() int {
+	return len(ib.indices)
+}
+
+func (ib *indexedBlocks) Swap(i, j int) {
+	ib.indices[i], ib.indices[j] = ib.indices[j], ib.indices[i]
+	ib.blocks[i], ib.blocks[j] = ib.blocks[j], ib.blocks[i]
+}
+
+func (ib *indexedBlocks) Less(i, j int) bool {
+	return ib.indices[i] < ib.indices[j]
+}
+
+type shard struct {
+	lock sync.RWMutex
+	sba  *sparseBitArray
+}
+
+// concurrentSparseBitArray spreads its blocks over a number of sparse
+// bit arrays, each guarded by its own lock, so goroutines touching
+// different blocks rarely contend.  The block at index i lives in
+// shard i % len(shards).  Operations over the whole array work against
+// a snapshot which is consistent per shard but not across shards.
+type concurrentSparseBitArray struct {
+	shards []*shard
+}
+
+func (csba *concurrentSparseBitArray) shardFor(k uint64) *shard {
+	index, _ := getIndexAndRemainder(k)
+	return csba.shards[index%uint64(len(csba.shards))]
+}
+
+// snapshot copies every shard into a single sparse bit array.
+func (csba *concurrentSparseBitArray) snapshot() *sparseBitArray {
+	ib := &indexedBlocks{}
+	for _, shard := range csba.shards {
+		shard.lock.RLock()
+		ib.indices = append(ib.indices, shard.sba.indices...)
+		ib.blocks = append(ib.blocks, shard.sba.blocks...)
+		shard.lock.RUnlock()
+	}
+
+	sort.Sort(ib)
+	return &sparseBitArray{
+		indices: ib.indices,
+		blocks:  ib.blocks,
+	}
+}
+
+// TestAndSetBit sets the bit at the given position and returns a bool
+// indicating if it was already set.
+func (csba *concurrentSparseBitArray) TestAndSetBit(k uint64) (bool, error) {
+	shard := csba.shardFor(k)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	result, _ := shard.sba.GetBit(k)
+	shard.sba.SetBit(k)
+	return result, nil
+}
+
+// TestAndClearBit clears the bit at the given position and returns a
+// bool indicating if it was set.
+func (csba *concurrentSparseBitArray) TestAndClearBit(k uint64) (bool, error) {
+	shard := csba.shardFor(k)
+	shard.lock.Lock()
+	defer shard.lock.Unlock()
+
+	result, _ := shard.sba.GetBit(k)
+	shard.sba.ClearBit(k)
+	return result, nil
+}
+
+// SetBit sets the bit at the given position.
+func (csba *concurrentSparseBitArray) SetBit(k uint64) error {
+	_, err := csba.TestAndSetBit(k)
+	return err
+}
+
+// GetBit gets the bit at the given position.
+func (csba *concurrentSparseBitArray) GetBit(k uint64) (bool, error) {
+	shard := csba.shardFor(k)
+	shard.lock.RLock()
+	defer shard.lock.RUnlock()
+
+	return shard.sba.GetBit(k)
+}
+
+// ClearBit clears the bit at the given position.
+func (csba *concurrentSparseBitArray) ClearBit(k uint64) error {
+	_, err := csba.TestAndClearBit(k)
+	return err
+}
+
+// applyRange applies the range operation to each shard in turn.  The
+// range as a whole is not updated atomically.
+func (csba *concurrentSparseBitArray) applyRange(start, stop uint64, op func(b, mask block) block) {
+	if start > stop {
+		return
+	}
+
+	startIndex, _ := getIndexAndRemainder(start)
+	numShards := uint64(len(csba.shards))
+	for i := uint64(0); i < numShards; i++ {
+		// the first index at or after the start of the range
+		// that lives in this shard
+		first := startIndex + (i+numShards-startIndex%numShards)%numShards
+		shard := csba.shards[i]
+		shard.lock.Lock()
+		shard.sba.applyStridedRange(start, stop, first, numShards, op)
+		shard.lock.Unlock()
+	}
+}
+
+// SetRange sets every bit from start to stop, inclusive.
+func (csba *concurrentSparseBitArray) SetRange(start, stop uint64) error {
+	csba.applyRange(start, stop, func(b, mask block) block {
+		return b | mask
+	})
+	return nil
+}
+
+// ClearRange clears every bit from start to stop, inclusive.
+func (csba *concurrentSparseBitArray) ClearRange(start, stop uint64) error {
+	csba.applyRange(start, stop, func(b, mask block) block {
+		return b &^ mask
+	})
+	return nil
+}
+
+// FlipRange flips every bit from start to stop, inclusive.
+func (csba *concurrentSparseBitArray) FlipRange(start, stop uint64) error {
+	csba.applyRange(start, stop, func(b, mask block) block {
+		return b ^ mask
+	})
+	return nil
+}
+
+// CountRange returns the number of set bits from start to stop,
+// inclusive.
+func (csba *concurrentSparseBitArray) CountRange(start, stop uint64) uint64 {
+	count := uint64(0)
+	for _, shard := range csba.shards {
+		shard.lock.RLock()
+		count += shard.sba.CountRange(start, stop)
+		shard.lock.RUnlock()
+	}
+
+	return count
+}
+
+// rewrite locks every shard, applies op to the combined contents of
+// the shards and spreads the result back over them.
+func (csba *concurrentSparseBitArray) rewrite(op func(sba *sparseBitArray)) {
+	for _, shard := range csba.shards {
+		shard.lock.Lock()
+		defer shard.lock.Unlock()
+	}
+
+	ib := &indexedBlocks{}
+	for _, shard := range csba.shards {
+		ib.indices = append(ib.indices, shard.sba.indices...)
+		ib.blocks = append(ib.blocks, shard.sba.blocks...)
+		shard.sba.Reset()
+	}
+	sort.Sort(ib)
+
+	sba := &sparseBitArray{indices: ib.indices, blocks: ib.blocks}
+	op(sba)
+
+	numShards := uint64(len(csba.shards))
+	for i, index := range sba.indices {
+		shard := csba.shards[index%numShards]
+		shard.sba.indices = append(shard.sba.indices, index)
+		shard.sba.blocks = append(shard.sba.blocks, sba.blocks[i])
+	}
+}
+
+// ShiftLeft moves every bit n positions higher.
+func (csba *concurrentSparseBitArray) ShiftLeft(n uint64) {
+	csba.InsertBits(0, n)
+}
+
+// ShiftRight moves every bit n positions lower, dropping the bits
+// below n.
+func (csba *concurrentSparseBitArray) ShiftRight(n uint64) {
+	csba.DeleteBits(0, n)
+}
+
+// InsertBits moves every bit at or above the provided position count
+// positions higher, leaving the inserted positions unset.  Every shard
+// is locked while the bits move.
+func (csba *concurrentSparseBitArray) InsertBits(at, count uint64) {
+	csba.rewrite(func(sba *sparseBitArray) {
+		sba.InsertBits(at, count)
+	})
+}
+
+// DeleteBits removes the count bits starting at the provided position
+// and moves every bit above them count positions lower.  Every shard
+// is locked while the bits move.
+func (csba *concurrentSparseBitArray) DeleteBits(at, count uint64) {
+	csba.rewrite(func(sba *sparseBitArray) {
+		sba.DeleteBits(at, count)
+	})
+}
+
+// NextSetBit returns the position of the first set bit at or after
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (csba *concurrentSparseBitArray) NextSetBit(from uint64) (uint64, bool) {
+	result, found := uint64(0), false
+	for _, shard := range csba.shards {
+		shard.lock.RLock()
+		k, ok := shard.sba.NextSetBit(from)
+		shard.lock.RUnlock()
+		if ok && (!found || k < result) {
+			result, found = k, true
+		}
+	}
+
+	return result, found
+}
+
+// PrevSetBit returns the position of the last set bit at or before
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (csba *concurrentSparseBitArray) PrevSetBit(from uint64) (uint64, bool) {
+	result, found := uint64(0), false
+	for _, shard := range csba.shards {
+		shard.lock.RLock()
+		k, ok := shard.sba.PrevSetBit(from)
+		shard.lock.RUnlock()
+		if ok && (!found || k > result) {
+			result, found = k, true
+		}
+	}
+
+	return result, found
+}
+
+// Reset erases all values from this bitarray.
+func (csba *concurrentSparseBitArray) Reset() {
+	for _, shard := range csba.shards {
+		shard.lock.Lock()
+		shard.sba.Reset()
+		shard.lock.Unlock()
+	}
+}
+
+// Capacity returns the value of the highest possible *seen* value
+// in this sparse bitarray.
+func (csba *concurrentSparseBitArray) Capacity() uint64 {
+	capacity := uint64(0)
+	for _, shard := range csba.shards {
+		shard.lock.RLock()
+		capacity = maxUint64(capacity, shard.sba.Capacity())
+		shard.lock.RUnlock()
+	}
+
+	return capacity
+}
+
+// Blocks returns an iterator over a snapshot of this bitarray.
+func (csba *concurrentSparseBitArray) Blocks() Iterator {
+	return csba.snapshot().Blocks()
+}
+
+// Bits returns an iterator over the set bits in a snapshot of this
+// bitarray.
+func (csba *concurrentSparseBitArray) Bits() BitIterator {
+	return csba.snapshot().Bits()
+}
+
+// Equals returns a bool indicating if a snapshot of this bitarray
+// equals the provided bitarray.
+func (csba *concurrentSparseBitArray) Equals(other BitArray) bool {
+	return csba.snapshot().Equals(other)
+}
+
+// Intersects returns a bool indicating if the provided bitarray
+// intersects a snapshot of this bitarray.
+func (csba *concurrentSparseBitArray) Intersects(other BitArray) bool {
+	return csba.snapshot().Intersects(other)
+}
+
+// IntersectsBetween returns a bool indicating if every bit set in the
+// provided bitarray from start to stop, inclusive, is also set in
+// a snapshot of this bitarray.
+func (csba *concurrentSparseBitArray) IntersectsBetween(other BitArray, start, stop uint64) bool {
+	return intersectsBetween(csba, other, start, stop)
+}
+
+// EqualsBetween returns a bool indicating if a snapshot of this
+// bitarray and the provided bitarray have the same bits set from start
+// to stop, inclusive.
+func (csba *concurrentSparseBitArray) EqualsBetween(other BitArray, start, stop uint64) bool {
+	return equalsBetween(csba, other, start, stop)
+}
+
+// Or will bitwise or a snapshot of this bitarray with the provided
+// bitarray and return a new, non-concurrent, bitarray representing
+// the result.
+func (csba *concurrentSparseBitArray) Or(other BitArray) BitArray {
+	return csba.snapshot().Or(other)
+}
+
+// ToNums converts a snapshot of this bitarray to a list of numbers
+// contained within it.
+func (csba *concurrentSparseBitArray) ToNums() []uint64 {
+	return csba.snapshot().ToNums()
+}
+
+// ToNumsBetween converts a snapshot of this bitarray to the list of numbers
+// contained within it from start to stop, inclusive.
+func (csba *concurrentSparseBitArray) ToNumsBetween(start, stop uint64) []uint64 {
+	return toNumsBetween(csba, start, stop)
+}
+
+// MarshalBinary encodes a snapshot of this bitarray using the sparse
+// encoding.
+func (csba *concurrentSparseBitArray) MarshalBinary() ([]byte, error) {
+	return csba.snapshot().MarshalBinary()
+}
+
+// UnmarshalBinary replaces the contents of this bitarray with the
+// provided dense or sparse encoding.
+func (csba *concurrentSparseBitArray) UnmarshalBinary(input []byte) error {
+	sba := newSparseBitArray()
+	if err := sba.UnmarshalBinary(input); err != nil {
+		return err
+	}
+
+	csba.rewrite(func(contents *sparseBitArray) {
+		*contents = *sba
+	})
+
+	return nil
+}
+
+func newConcurrentSparseBitArray(numShards uint64) *concurrentSparseBitArray {
+	if numShards < 1 {
+		numShards = 1
+	}
+
+	csba := &concurrentSparseBitArray{
+		shards: make([]*shard, numShards),
+	}
+	for i := range csba.shards {
+		csba.shards[i] = &shard{sba: newSparseBitArray()}
+	}
+
+	return csba
+}
+
+// NewConcurrentSparseBitArray returns a sparse bit array that is safe
+// for concurrent use.  Blocks are spread over the given number of
+// shards, each with its own lock, so more shards means less contention
+// at the cost of slower whole array operations.
+func NewConcurrentSparseBitArray(numShards uint64) ConcurrentBitArray {
+	return newConcurrentSparseBitArray(numShards)
+}
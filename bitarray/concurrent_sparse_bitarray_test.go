@@ -0,0 +1,130 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConcurrentSparseTestAndSetBit(t *testing.T) {
+	csba := newConcurrentSparseBitArray(4)
+
+	result, err := csba.TestAndSetBit(s * 100)
+	assert.Nil(t, err)
+	assert.False(t, result)
+
+	result, _ = csba.TestAndSetBit(s * 100)
+	assert.True(t, result)
+
+	result, _ = csba.TestAndClearBit(s * 100)
+	assert.True(t, result)
+
+	result, _ = csba.TestAndClearBit(s * 100)
+	assert.False(t, result)
+	assert.Equal(t, uint64(0), csba.Capacity())
+}
+
+func TestConcurrentSparseSetBitInParallel(t *testing.T) {
+	numItems := uint64(5000)
+	numWorkers := 8
+	csba := newConcurrentSparseBitArray(4)
+
+	var wg sync.WaitGroup
+	wg.Add(numWorkers)
+	firsts := uint64(0)
+	for i := 0; i < numWorkers; i++ {
+		go func() {
+			defer wg.Done()
+			for j := uint64(0); j < numItems; j += 3 {
+				if ok, _ := csba.TestAndSetBit(j); !ok {
+					atomic.AddUint64(&firsts, 1)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, numItems/3+1, firsts)
+	assert.Equal(t, numItems/3+1, uint64(len(csba.ToNums())))
+}
+
+func TestConcurrentSparseRanges(t *testing.T) {
+	csba := newConcurrentSparseBitArray(3)
+	sba := newSparseBitArray()
+
+	csba.SetRange(5, s*7+2)
+	sba.SetRange(5, s*7+2)
+	assert.True(t, csba.Equals(sba))
+	assert.Equal(t, sba.CountRange(0, s*10), csba.CountRange(0, s*10))
+
+	for i, shard := range csba.shards {
+		for _, index := range shard.sba.indices {
+			assert.Equal(t, uint64(i), index%3)
+		}
+	}
+
+	csba.FlipRange(s, s*3)
+	sba.FlipRange(s, s*3)
+	csba.ClearRange(s*5, s*6)
+	sba.ClearRange(s*5, s*6)
+	assert.Equal(t, sba.ToNums(), csba.ToNums())
+
+	result, ok := csba.NextSetBit(s)
+	assert.True(t, ok)
+	assert.Equal(t, s*3+1, result)
+
+	result, ok = csba.PrevSetBit(s * 3)
+	assert.True(t, ok)
+	assert.Equal(t, s-1, result)
+}
+
+func TestConcurrentSparseMarshal(t *testing.T) {
+	csba := newConcurrentSparseBitArray(3)
+	csba.SetBit(1)
+	csba.SetBit(s * 4)
+	csba.SetBit(s * 8)
+
+	encoded, err := csba.MarshalBinary()
+	assert.Nil(t, err)
+
+	other := newConcurrentSparseBitArray(2)
+	assert.Nil(t, other.UnmarshalBinary(encoded))
+	assert.Equal(t, []uint64{1, s * 4, s * 8}, other.ToNums())
+	assert.Equal(t, uintSlice{0, 4, 8}, other.shards[0].sba.indices)
+
+	ba := newBitArray(s * 10)
+	assert.Nil(t, ba.UnmarshalBinary(encoded))
+	assert.True(t, ba.Equals(csba))
+}
+
+func BenchmarkConcurrentSparseTestAndSetBit(b *testing.B) {
+	numItems := uint64(160000)
+	csba := newConcurrentSparseBitArray(16)
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		k := uint64(0)
+		for pb.Next() {
+			csba.TestAndSetBit(k % numItems)
+			k++
+		}
+	})
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// toSparse copies the provided bitarray into a new sparse bitarray.
+func toSparse(ba BitArray) *sparseBitArray {
+	if sba, ok := ba.(*sparseBitArray); ok {
+		return sba.copy()
+	}
+
+	sba := newSparseBitArray()
+	for iter := ba.Blocks(); iter.Next(); {
+		index, b := iter.Value()
+		if b == 0 {
+			continue
+		}
+		sba.indices = append(sba.indices, index)
+		sba.blocks = append(sba.blocks, b)
+	}
+
+	return sba
+}
+
+// toDense copies the provided bitarray into a new dense bitarray
+// just large enough to hold its highest set bit.  Dense bitarrays
+// keep their capacity.  An OutOfRangeError is returned if the dense
+// bitarray would be larger than MaxDenseCapacity.
+func toDense(ba BitArray) (*bitArray, error) {
+	if dba, ok := ba.(*bitArray); ok {
+		return dba.copy().(*bitArray), nil
+	}
+
+	sba := toSparse(ba)
+	if len(sba.indices) == 0 {
+		return newBitArray(0), nil
+	}
+
+	// comparing the index first keeps the size from overflowing
+	last := sba.indices[len(sba.indices)-1]
+	if last >= maxDenseBlocks {
+		return nil, OutOfRangeError(MaxDenseCapacity)
+	}
+
+	dba := newBitArray((last + 1) * s)
+	for i, index := range sba.indices {
+		dba.blocks[index] = sba.blocks[i]
+	}
+	dba.setLowest()
+	dba.setHighest()
+
+	return dba, nil
+}
+
+// concurrentDense is implemented by the dense bitarrays whose blocks
+// must be loaded atomically.  They are read in place rather than
+// copied.
+type concurrentDense interface {
+	concurrent() *concurrentBitArray
+}
+
+// concrete returns the dense or sparse bitarray backing the provided
+// bitarray, converting it into a sparse bitarray if it has neither.
+// Concurrent dense bitarrays are returned as a *concurrentBitArray
+// over the same blocks.
+func concrete(ba BitArray) BitArray {
+	switch cba := ba.(type) {
+	case *bitArray, *sparseBitArray:
+		return ba
+	case *hybridBitArray:
+		return cba.ba
+	case concurrentDense:
+		return cba.concurrent()
+	case *concurrentSparseBitArray:
+		return cba.snapshot()
+	}
+
+	return toSparse(ba)
+}
+
+// isSparse returns a bool indicating if the provided bitarray is
+// backed by a sparse representation.
+func isSparse(ba BitArray) bool {
+	switch cba := ba.(type) {
+	case *sparseBitArray, *concurrentSparseBitArray:
+		return true
+	case *hybridBitArray:
+		return isSparse(cba.ba)
+	}
+
+	return false
+}
+
+// ToSparse returns a sparse copy of the provided bitarray.
+func ToSparse(ba BitArray) BitArray {
+	return toSparse(ba)
+}
+
+// ToDense returns a dense copy of the provided bitarray.  Unless
+// the provided bitarray is already dense, the capacity of the
+// result is the smallest capacity that holds every set bit.  An
+// OutOfRangeError is returned if that capacity is more than
+// MaxDenseCapacity.
+func ToDense(ba BitArray) (BitArray, error) {
+	dba, err := toDense(ba)
+	if err != nil {
+		return nil, err
+	}
+
+	return dba, nil
+}
@@ -0,0 +1,87 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToSparse(t *testing.T) {
+	ba := newBitArray(s * 4)
+	ba.SetBit(3)
+	ba.SetBit(s * 3)
+
+	result := ToSparse(ba).(*sparseBitArray)
+	assert.Equal(t, uintSlice{0, 3}, result.indices)
+	assert.Equal(t, []uint64{3, s * 3}, result.ToNums())
+	assert.True(t, result.Equals(ba))
+
+	sba := newSparseBitArray()
+	sba.SetBit(5)
+	result = ToSparse(sba).(*sparseBitArray)
+	result.SetBit(6)
+	assert.Equal(t, []uint64{5}, sba.ToNums())
+}
+
+func TestToDense(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(3)
+	sba.SetBit(s * 3)
+
+	dense, err := ToDense(sba)
+	assert.Nil(t, err)
+	result := dense.(*bitArray)
+	assert.Len(t, result.blocks, 4)
+	assert.Equal(t, uint64(3), result.lowest)
+	assert.Equal(t, s*3, result.highest)
+	assert.True(t, result.Equals(sba))
+
+	dense, _ = ToDense(newSparseBitArray())
+	result = dense.(*bitArray)
+	assert.Equal(t, uint64(0), result.Capacity())
+	assert.False(t, result.anyset)
+
+	ba := newBitArray(s * 10)
+	ba.SetBit(1)
+	dense, _ = ToDense(ba)
+	result = dense.(*bitArray)
+	assert.Equal(t, s*10, result.Capacity())
+	result.SetBit(2)
+	assert.Equal(t, []uint64{1}, ba.ToNums())
+}
+
+func TestToDenseHighIndex(t *testing.T) {
+	for _, k := range []uint64{MaxDenseCapacity, 1 << 62, ^uint64(0)} {
+		sba := newSparseBitArray()
+		sba.SetBit(k)
+
+		_, err := ToDense(sba)
+		assert.IsType(t, OutOfRangeError(0), err)
+
+		hba := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+		hba.SetBit(k)
+		_, err = ToDense(hba)
+		assert.IsType(t, OutOfRangeError(0), err)
+
+		// aggregates that would be dense fall back to sparse
+		result := OrAll(newBitArray(s), sba)
+		assert.True(t, isSparse(result))
+		assert.Equal(t, []uint64{k}, result.ToNums())
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Bitarrays are encoded in a portable binary format so they can be
+persisted or sent between services.  All integers are little-endian
+uint64s.  The encoding consists of a header:
+
+	byte  0      kind, 0 for dense and 1 for sparse
+	bytes 1-8    capacity of the encoded bitarray
+	bytes 9-16   number of encoded blocks, n
+
+followed by n blocks of 8 bytes each.  A sparse encoding is then
+followed by the n block indices, 8 bytes each, in ascending order.
+A dense encoding contains every block, including empty ones.  The
+capacity of a sparse encoding does not extend past the end of its
+highest block.
+
+Either kind of encoding can be unmarshaled into either kind of
+bitarray.
+*/
+
+package bitarray
+
+import "encoding/binary"
+
+const (
+	denseKind  = byte(0)
+	sparseKind = byte(1)
+	// headerSize is the number of bytes in the kind, capacity,
+	// and block count header.
+	headerSize = 17
+	// wordSize is the number of bytes in an encoded block or index.
+	wordSize = 8
+)
+
+// MaxDenseCapacity is the largest capacity, in bits, of a dense
+// bitarray created by decoding an encoding or by converting a sparse
+// bitarray.  Anything larger is rejected rather than allocated so
+// that untrusted input cannot exhaust memory.  It is 2^34 bits, or 2GB
+// of blocks.
+const MaxDenseCapacity = uint64(1) << 34
+
+// maxDenseBlocks is MaxDenseCapacity in blocks.
+const maxDenseBlocks = MaxDenseCapacity / s
+
+// decoded is the intermediate representation of an encoding.  Indices
+// are nil for dense encodings.
+type decoded struct {
+	kind     byte
+	capacity uint64
+	blocks   blocks
+	indices  uintSlice
+}
+
+// numBlocks returns the number of blocks a dense bitarray needs to
+// hold everything in this sparse encoding, which is one more than its
+// highest block index.  An OutOfRangeError is returned if that is more
+// than MaxDenseCapacity allows.
+func (d *decoded) numBlocks() (uint64, error) {
+	if len(d.indices) == 0 {
+		return 0, nil
+	}
+
+	last := d.indices[len(d.indices)-1]
+	// checking the index first keeps the increment from overflowing
+	if last >= maxDenseBlocks {
+		return 0, OutOfRangeError(MaxDenseCapacity)
+	}
+
+	return last + 1, nil
+}
+
+// newEncoding allocates an encoding with room for the provided number
+// of blocks and indices and writes its header.
+func newEncoding(kind byte, capacity uint64, numBlocks, numIndices int) []byte {
+	output := make([]byte, headerSize+(numBlocks+numIndices)*wordSize)
+	output[0] = kind
+	binary.LittleEndian.PutUint64(output[1:], capacity)
+	binary.LittleEndian.PutUint64(output[9:], uint64(numBlocks))
+	return output
+}
+
+func encode(kind byte, capacity uint64, blocks blocks, indices uintSlice) []byte {
+	numIndices := 0
+	if kind == sparseKind {
+		numIndices = len(indices)
+	}
+
+	output := newEncoding(kind, capacity, len(blocks), numIndices)
+	offset := headerSize
+	for _, b := range blocks {
+		binary.LittleEndian.PutUint64(output[offset:], uint64(b))
+		offset += wordSize
+	}
+
+	if kind == sparseKind {
+		for _, index := range indices {
+			binary.LittleEndian.PutUint64(output[offset:], index)
+			offset += wordSize
+		}
+	}
+
+	return output
+}
+
+func decode(input []byte) (*decoded, error) {
+	if len(input) < headerSize {
+		return nil, InvalidEncodingError(`header is truncated`)
+	}
+
+	d := &decoded{
+		kind:     input[0],
+		capacity: binary.LittleEndian.Uint64(input[1:]),
+	}
+	if d.kind != denseKind && d.kind != sparseKind {
+		return nil, InvalidEncodingError(`unknown kind`)
+	}
+
+	count := binary.LittleEndian.Uint64(input[9:])
+	words := count
+	if d.kind == sparseKind {
+		words *= 2
+	}
+	if count > uint64(len(input)) || uint64(len(input)-headerSize) != words*wordSize {
+		return nil, InvalidEncodingError(`length does not match block count`)
+	}
+
+	d.blocks = make(blocks, count)
+	offset := headerSize
+	for i := range d.blocks {
+		d.blocks[i] = block(binary.LittleEndian.Uint64(input[offset:]))
+		offset += wordSize
+	}
+
+	if d.kind == denseKind {
+		// a dense encoding holds every block up to its capacity
+		i, r := getIndexAndRemainder(d.capacity)
+		if r > 0 {
+			i++
+		}
+		if i != count {
+			return nil, InvalidEncodingError(`capacity does not match block count`)
+		}
+
+		return d, nil
+	}
+
+	d.indices = make(uintSlice, count)
+	for i := range d.indices {
+		d.indices[i] = binary.LittleEndian.Uint64(input[offset:])
+		if i > 0 && d.indices[i] <= d.indices[i-1] {
+			return nil, InvalidEncodingError(`indices are not ascending`)
+		}
+		offset += wordSize
+	}
+
+	// a sparse bitarray never has a capacity past its last block, so
+	// a larger capacity describes blocks that are not in the input
+	i, r := getIndexAndRemainder(d.capacity)
+	if r > 0 {
+		i++
+	}
+	if i > 0 && (count == 0 || i-1 > d.indices[count-1]) {
+		return nil, InvalidEncodingError(`capacity does not match block indices`)
+	}
+
+	return d, nil
+}
+
+// MarshalBinary encodes this bitarray using the dense encoding.
+func (ba *bitArray) MarshalBinary() ([]byte, error) {
+	return encode(denseKind, ba.Capacity(), ba.blocks, nil), nil
+}
+
+// UnmarshalBinary replaces the contents of this bitarray with the
+// provided dense or sparse encoding.
+func (ba *bitArray) UnmarshalBinary(input []byte) error {
+	d, err := decode(input)
+	if err != nil {
+		return err
+	}
+
+	if d.kind == denseKind {
+		ba.blocks = d.blocks
+	} else {
+		numBlocks, err := d.numBlocks()
+		if err != nil {
+			return err
+		}
+
+		ba.blocks = make(blocks, numBlocks)
+		for i, index := range d.indices {
+			ba.blocks[index] = d.blocks[i]
+		}
+	}
+
+	ba.setLowest()
+	if ba.anyset {
+		ba.setHighest()
+	}
+
+	return nil
+}
+
+// MarshalBinary encodes this bitarray using the sparse encoding.
+func (sba *sparseBitArray) MarshalBinary() ([]byte, error) {
+	return encode(sparseKind, sba.Capacity(), sba.blocks, sba.indices), nil
+}
+
+// UnmarshalBinary replaces the contents of this bitarray with the
+// provided dense or sparse encoding.
+func (sba *sparseBitArray) UnmarshalBinary(input []byte) error {
+	d, err := decode(input)
+	if err != nil {
+		return err
+	}
+
+	sba.indices = make(uintSlice, 0, len(d.blocks))
+	sba.blocks = make(blocks, 0, len(d.blocks))
+	for i, b := range d.blocks {
+		// empty blocks are never stored in a sparse array
+		if b == 0 {
+			continue
+		}
+
+		index := uint64(i)
+		if d.kind == sparseKind {
+			index = d.indices[i]
+		}
+		sba.indices = append(sba.indices, index)
+		sba.blocks = append(sba.blocks, b)
+	}
+
+	return nil
+}
+
+// Unmarshal decodes the provided bytes into a new bitarray of the
+// kind described by the encoding.
+func Unmarshal(input []byte) (BitArray, error) {
+	var ba BitArray
+	if len(input) > 0 && input[0] == sparseKind {
+		ba = newSparseBitArray()
+	} else {
+		ba = newBitArray(0)
+	}
+
+	if err := ba.UnmarshalBinary(input); err != nil {
+		return nil, err
+	}
+
+	return ba, nil
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"encoding/binary"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMarshalDenseBitArray(t *testing.T) {
+	ba := newBitArray(s * 2)
+	ba.SetBit(1)
+	ba.SetBit(s + 2)
+
+	result, err := ba.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		0,
+		128, 0, 0, 0, 0, 0, 0, 0,
+		2, 0, 0, 0, 0, 0, 0, 0,
+		2, 0, 0, 0, 0, 0, 0, 0,
+		4, 0, 0, 0, 0, 0, 0, 0,
+	}, result)
+
+	other := newBitArray(0)
+	err = other.UnmarshalBinary(result)
+	assert.Nil(t, err)
+	assert.Equal(t, ba.blocks, other.blocks)
+	assert.Equal(t, uint64(1), other.lowest)
+	assert.Equal(t, s+2, other.highest)
+	assert.True(t, other.anyset)
+}
+
+func TestMarshalSparseBitArray(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(s*3 + 1)
+
+	result, err := sba.MarshalBinary()
+	assert.Nil(t, err)
+	assert.Equal(t, []byte{
+		1,
+		67, 0, 0, 0, 0, 0, 0, 0,
+		1, 0, 0, 0, 0, 0, 0, 0,
+		2, 0, 0, 0, 0, 0, 0, 0,
+		3, 0, 0, 0, 0, 0, 0, 0,
+	}, result)
+
+	other := newSparseBitArray()
+	err = other.UnmarshalBinary(result)
+	assert.Nil(t, err)
+	assert.Equal(t, sba.indices, other.indices)
+	assert.Equal(t, sba.blocks, other.blocks)
+}
+
+func TestUnmarshalAcrossKinds(t *testing.T) {
+	ba := newBitArray(s * 4)
+	ba.SetBit(5)
+	ba.SetBit(s * 3)
+
+	sba := newSparseBitArray()
+	sba.SetBit(5)
+	sba.SetBit(s * 3)
+
+	dense, _ := ba.MarshalBinary()
+	sparse, _ := sba.MarshalBinary()
+
+	fromDense := newSparseBitArray()
+	assert.Nil(t, fromDense.UnmarshalBinary(dense))
+	assert.Equal(t, uintSlice{0, 3}, fromDense.indices)
+	assert.True(t, fromDense.Equals(ba))
+
+	fromSparse := newBitArray(0)
+	assert.Nil(t, fromSparse.UnmarshalBinary(sparse))
+	assert.Equal(t, []uint64{5, s * 3}, fromSparse.ToNums())
+	assert.True(t, fromSparse.Equals(sba))
+}
+
+func TestUnmarshal(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(s * 10)
+	encoded, _ := sba.MarshalBinary()
+
+	result, err := Unmarshal(encoded)
+	assert.Nil(t, err)
+	assert.IsType(t, &sparseBitArray{}, result)
+	assert.Equal(t, []uint64{s * 10}, result.ToNums())
+
+	ba := newBitArray(s)
+	ba.SetBit(4)
+	encoded, _ = ba.MarshalBinary()
+
+	result, err = Unmarshal(encoded)
+	assert.Nil(t, err)
+	assert.IsType(t, &bitArray{}, result)
+	assert.Equal(t, []uint64{4}, result.ToNums())
+}
+
+func TestUnmarshalInvalidEncoding(t *testing.T) {
+	_, err := Unmarshal([]byte{0, 1})
+	assert.IsType(t, InvalidEncodingError(``), err)
+
+	encoded, _ := newBitArray(s).MarshalBinary()
+	encoded[0] = 5
+	_, err = Unmarshal(encoded)
+	assert.IsType(t, InvalidEncodingError(``), err)
+
+	encoded, _ = newBitArray(s).MarshalBinary()
+	_, err = Unmarshal(encoded[:len(encoded)-1])
+	assert.IsType(t, InvalidEncodingError(``), err)
+
+	sba := newSparseBitArray()
+	sba.SetBit(0)
+	sba.SetBit(s)
+	encoded, _ = sba.MarshalBinary()
+	encoded[len(encoded)-8] = 0
+	_, err = Unmarshal(encoded)
+	assert.IsType(t, InvalidEncodingError(``), err)
+
+	// the capacity of a dense encoding must match its blocks
+	encoded, _ = newBitArray(s * 2).MarshalBinary()
+	encoded[1] = byte(s * 3)
+	_, err = Unmarshal(encoded)
+	assert.IsType(t, InvalidEncodingError(``), err)
+}
+
+func TestUnmarshalSparseIntoDenseTooLarge(t *testing.T) {
+	for _, index := range []uint64{1 << 62, ^uint64(0), maxDenseBlocks} {
+		sba := newSparseBitArray()
+		sba.indices = uintSlice{index}
+		sba.blocks = blocks{1}
+		encoded, _ := sba.MarshalBinary()
+
+		ba := newBitArray(0)
+		assert.IsType(t, OutOfRangeError(0), ba.UnmarshalBinary(encoded))
+	}
+
+	// high bits within the limit are still accepted
+	sba := newSparseBitArray()
+	sba.SetBit(s*(maxDenseBlocks/1024) + 1)
+	encoded, _ := sba.MarshalBinary()
+	ba := newBitArray(0)
+	assert.Nil(t, ba.UnmarshalBinary(encoded))
+	assert.Equal(t, []uint64{s*(maxDenseBlocks/1024) + 1}, ba.ToNums())
+}
+
+func TestUnmarshalSparseCapacityPastBlocks(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(s * 3)
+	encoded, _ := sba.MarshalBinary()
+	binary.LittleEndian.PutUint64(encoded[1:], s*4)
+	assert.Nil(t, newBitArray(0).UnmarshalBinary(encoded))
+	binary.LittleEndian.PutUint64(encoded[1:], s*4+1)
+	assert.IsType(t, InvalidEncodingError(``), newBitArray(0).UnmarshalBinary(encoded))
+
+	// a bare header claiming a huge capacity is rejected before
+	// anything that large is allocated
+	for _, capacity := range []uint64{1, MaxDenseCapacity, ^uint64(0)} {
+		encoded, _ = newSparseBitArray().MarshalBinary()
+		binary.LittleEndian.PutUint64(encoded[1:], capacity)
+		assert.Len(t, encoded, headerSize)
+
+		targets := []BitArray{
+			newBitArray(0), newSparseBitArray(), newConcurrentBitArray(s),
+			newConcurrentSparseBitArray(2), newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold),
+		}
+		assert.True(t, allocated(func() {
+			for _, ba := range targets {
+				assert.IsType(t, InvalidEncodingError(``), ba.UnmarshalBinary(encoded))
+			}
+			_, err := Unmarshal(encoded)
+			assert.IsType(t, InvalidEncodingError(``), err)
+		}) < 1<<16)
+	}
+}
+
+func BenchmarkMarshalDenseBitArray(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+	for i := uint64(0); i < numItems; i += s / 2 {
+		ba.SetBit(i)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		ba.MarshalBinary()
+	}
+}
@@ -26,3 +26,41 @@ type OutOfRangeError uint64
 func (err OutOfRangeError) Error() string {
 	return fmt.Sprintf(`Index %d is out of range.`, err)
 }
+
+// InvalidEncodingError is an error caused by attempting to unmarshal
+// bytes that do not describe a bitarray.
+type InvalidEncodingError string
+
+// Error returns a human readable description of the encoding error.
+func (err InvalidEncodingError) Error() string {
+	return fmt.Sprintf(`Invalid bitarray encoding: %s.`, string(err))
+}
+
+// ReadOnlyError is an error caused by attempting to modify a bitarray
+// that was opened read only.
+type ReadOnlyError struct{}
+
+// Error returns a human readable description of the read only error.
+func (err ReadOnlyError) Error() string {
+	return `Bitarray is read only.`
+}
+
+// UnsupportedError is an error caused by attempting to use a bitarray
+// that is not supported on this platform.
+type UnsupportedError string
+
+// Error returns a human readable description of the unsupported error.
+func (err UnsupportedError) Error() string {
+	return fmt.Sprintf(`%s is not supported on this platform.`, string(err))
+}
+
+// InvalidThresholdsError is an error caused by creating a hybrid
+// bitarray with density thresholds it cannot switch between.
+type InvalidThresholdsError struct {
+	Sparse, Dense float64
+}
+
+// Error returns a human readable description of the thresholds error.
+func (err InvalidThresholdsError) Error() string {
+	return fmt.Sprintf(`Invalid hybrid bitarray thresholds: sparse %g, dense %g.`, err.Sparse, err.Dense)
+}
@@ -0,0 +1,394 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+const (
+	// DefaultSparseThreshold is the block density below which a hybrid
+	// bitarray switches to a sparse representation.
+	DefaultSparseThreshold = 0.25
+	// DefaultDenseThreshold is the block density above which a hybrid
+	// bitarray switches to a dense representation.  A sparse block
+	// costs twice the memory of a dense block, so past one half a dense
+	// representation is smaller.
+	DefaultDenseThreshold = 0.5
+)
+
+// hybridBitArray is a bitarray that is backed by either a dense or
+// a sparse bitarray and switches between the two as the density of
+// its blocks crosses the configured thresholds.  Density is the
+// number of non-empty blocks divided by the number of blocks a dense
+// representation holds.
+type hybridBitArray struct {
+	ba BitArray
+	// nonEmpty counts the non-empty blocks while backed by a dense
+	// bitarray.  The sparse bitarray only stores non-empty blocks.
+	nonEmpty        uint64
+	sparseThreshold float64
+	denseThreshold  float64
+}
+
+// blockCounts returns the number of non-empty blocks and the number of
+// blocks a dense representation of this bitarray would hold.
+func (hba *hybridBitArray) blockCounts() (uint64, uint64) {
+	switch ba := hba.ba.(type) {
+	case *bitArray:
+		return hba.nonEmpty, uint64(len(ba.blocks))
+	case *sparseBitArray:
+		if len(ba.indices) == 0 {
+			return 0, 0
+		}
+		return uint64(len(ba.indices)), ba.indices[len(ba.indices)-1] + 1
+	}
+
+	return 0, 0
+}
+
+// balance switches the backing bitarray if its density has crossed
+// one of the thresholds.
+func (hba *hybridBitArray) balance() {
+	nonEmpty, span := hba.blockCounts()
+	switch hba.ba.(type) {
+	case *bitArray:
+		if span == 0 || float64(nonEmpty)/float64(span) < hba.sparseThreshold {
+			hba.ba = toSparse(hba.ba)
+			hba.nonEmpty = 0
+		}
+	case *sparseBitArray:
+		if span > 0 && float64(nonEmpty)/float64(span) > hba.denseThreshold {
+			// a bitarray too large to be dense stays sparse
+			if dba, err := toDense(hba.ba); err == nil {
+				hba.ba = dba
+				hba.nonEmpty = nonEmpty
+			}
+		}
+	}
+}
+
+// recount recalculates the number of non-empty blocks after an
+// operation that may have touched many blocks.
+func (hba *hybridBitArray) recount() {
+	hba.nonEmpty = 0
+	ba, ok := hba.ba.(*bitArray)
+	if !ok {
+		return
+	}
+
+	for _, b := range ba.blocks {
+		if b != 0 {
+			hba.nonEmpty++
+		}
+	}
+}
+
+// SetBit sets the bit at the given position.  This never returns
+// an error.
+func (hba *hybridBitArray) SetBit(k uint64) error {
+	ba, ok := hba.ba.(*bitArray)
+	if !ok {
+		hba.ba.SetBit(k)
+		hba.balance()
+		return nil
+	}
+
+	i, _ := getIndexAndRemainder(k)
+	if i >= uint64(len(ba.blocks)) {
+		// if growing to fit this bit would leave the array too
+		// sparse, switch representations instead
+		if float64(hba.nonEmpty+1)/float64(i+1) < hba.sparseThreshold {
+			hba.ba = toSparse(ba)
+			hba.nonEmpty = 0
+			return hba.ba.SetBit(k)
+		}
+		ba.grow(i + 1)
+	}
+
+	if ba.blocks[i] == 0 {
+		hba.nonEmpty++
+	}
+
+	return ba.SetBit(k)
+}
+
+// GetBit gets the bit at the given position.  This never returns
+// an error.
+func (hba *hybridBitArray) GetBit(k uint64) (bool, error) {
+	if k >= hba.ba.Capacity() {
+		if _, ok := hba.ba.(*bitArray); ok {
+			return false, nil
+		}
+	}
+
+	return hba.ba.GetBit(k)
+}
+
+// ClearBit clears the bit at the given position.  This never returns
+// an error.
+func (hba *hybridBitArray) ClearBit(k uint64) error {
+	ba, ok := hba.ba.(*bitArray)
+	if !ok {
+		hba.ba.ClearBit(k)
+		hba.balance()
+		return nil
+	}
+
+	i, _ := getIndexAndRemainder(k)
+	if i >= uint64(len(ba.blocks)) || ba.blocks[i] == 0 {
+		return nil
+	}
+
+	ba.ClearBit(k)
+	if ba.blocks[i] == 0 {
+		hba.nonEmpty--
+		hba.balance()
+	}
+
+	return nil
+}
+
+// applyRange runs a range operation that may set bits past the end of
+// a dense backing bitarray.  Such operations run against a sparse
+// representation so only the touched blocks are allocated.
+func (hba *hybridBitArray) applyRange(start, stop uint64, op func(BitArray) error) {
+	if start > stop {
+		return
+	}
+
+	if stop >= hba.ba.Capacity() {
+		if _, ok := hba.ba.(*bitArray); ok {
+			hba.ba = toSparse(hba.ba)
+		}
+	}
+
+	op(hba.ba)
+	hba.recount()
+	hba.balance()
+}
+
+// SetRange sets every bit from start to stop, inclusive.  This never
+// returns an error.
+func (hba *hybridBitArray) SetRange(start, stop uint64) error {
+	hba.applyRange(start, stop, func(ba BitArray) error {
+		return ba.SetRange(start, stop)
+	})
+	return nil
+}
+
+// ClearRange clears every bit from start to stop, inclusive.  This
+// never returns an error.
+func (hba *hybridBitArray) ClearRange(start, stop uint64) error {
+	if ba, ok := hba.ba.(*bitArray); ok {
+		if start >= ba.Capacity() {
+			return nil
+		}
+		if stop >= ba.Capacity() {
+			stop = ba.Capacity() - 1
+		}
+	}
+
+	hba.applyRange(start, stop, func(ba BitArray) error {
+		return ba.ClearRange(start, stop)
+	})
+	return nil
+}
+
+// FlipRange flips every bit from start to stop, inclusive.  This never
+// returns an error.
+func (hba *hybridBitArray) FlipRange(start, stop uint64) error {
+	hba.applyRange(start, stop, func(ba BitArray) error {
+		return ba.FlipRange(start, stop)
+	})
+	return nil
+}
+
+// CountRange returns the number of set bits from start to stop,
+// inclusive.
+func (hba *hybridBitArray) CountRange(start, stop uint64) uint64 {
+	return hba.ba.CountRange(start, stop)
+}
+
+// ShiftLeft moves every bit n positions higher.
+func (hba *hybridBitArray) ShiftLeft(n uint64) {
+	hba.InsertBits(0, n)
+}
+
+// ShiftRight moves every bit n positions lower, dropping the bits
+// below n.
+func (hba *hybridBitArray) ShiftRight(n uint64) {
+	hba.DeleteBits(0, n)
+}
+
+// InsertBits moves every bit at or above the provided position count
+// positions higher, leaving the inserted positions unset.
+func (hba *hybridBitArray) InsertBits(at, count uint64) {
+	highest, ok := hba.ba.PrevSetBit(^uint64(0))
+	if !ok || highest < at {
+		return
+	}
+
+	// a dense bitarray would drop the bits moved past its capacity
+	stop := highest + count
+	if stop < highest {
+		stop = ^uint64(0)
+	}
+
+	hba.applyRange(at, stop, func(ba BitArray) error {
+		ba.InsertBits(at, count)
+		return nil
+	})
+}
+
+// DeleteBits removes the count bits starting at the provided position
+// and moves every bit above them count positions lower.
+func (hba *hybridBitArray) DeleteBits(at, count uint64) {
+	hba.ba.DeleteBits(at, count)
+	hba.recount()
+	hba.balance()
+}
+
+// Reset clears out the bitarray and returns it to a sparse
+// representation.
+func (hba *hybridBitArray) Reset() {
+	hba.ba = newSparseBitArray()
+	hba.nonEmpty = 0
+}
+
+// Blocks returns an iterator over the blocks of the backing bitarray.
+func (hba *hybridBitArray) Blocks() Iterator {
+	return hba.ba.Blocks()
+}
+
+// Bits returns an iterator over the set bits in this bitarray.
+func (hba *hybridBitArray) Bits() BitIterator {
+	return hba.ba.Bits()
+}
+
+// NextSetBit returns the position of the first set bit at or after
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (hba *hybridBitArray) NextSetBit(from uint64) (uint64, bool) {
+	return hba.ba.NextSetBit(from)
+}
+
+// PrevSetBit returns the position of the last set bit at or before
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (hba *hybridBitArray) PrevSetBit(from uint64) (uint64, bool) {
+	return hba.ba.PrevSetBit(from)
+}
+
+// Equals returns a bool indicating if the provided bitarray equals
+// this bitarray.
+func (hba *hybridBitArray) Equals(other BitArray) bool {
+	return hba.ba.Equals(other)
+}
+
+// Intersects returns a bool indicating if the provided bitarray
+// intersects this bitarray.
+func (hba *hybridBitArray) Intersects(other BitArray) bool {
+	return hba.ba.Intersects(other)
+}
+
+// IntersectsBetween returns a bool indicating if every bit set in the
+// provided bitarray from start to stop, inclusive, is also set in
+// this bitarray.
+func (hba *hybridBitArray) IntersectsBetween(other BitArray, start, stop uint64) bool {
+	return intersectsBetween(hba, other, start, stop)
+}
+
+// EqualsBetween returns a bool indicating if this bitarray and the
+// provided bitarray have the same bits set from start to stop,
+// inclusive.
+func (hba *hybridBitArray) EqualsBetween(other BitArray, start, stop uint64) bool {
+	return equalsBetween(hba, other, start, stop)
+}
+
+// Capacity returns the capacity of the backing bitarray.
+func (hba *hybridBitArray) Capacity() uint64 {
+	return hba.ba.Capacity()
+}
+
+// Or will bitwise or the two bitarrays and return a new hybrid
+// bitarray representing the result.
+func (hba *hybridBitArray) Or(other BitArray) BitArray {
+	result := newHybridBitArray(hba.sparseThreshold, hba.denseThreshold)
+	result.ba = hba.ba.Or(other)
+	result.recount()
+	result.balance()
+	return result
+}
+
+// ToNums converts this bitarray to the list of numbers contained
+// within it.
+func (hba *hybridBitArray) ToNums() []uint64 {
+	return hba.ba.ToNums()
+}
+
+// ToNumsBetween converts this bitarray to the list of numbers
+// contained within it from start to stop, inclusive.
+func (hba *hybridBitArray) ToNumsBetween(start, stop uint64) []uint64 {
+	return toNumsBetween(hba, start, stop)
+}
+
+// MarshalBinary encodes this bitarray using the encoding of its
+// current representation.
+func (hba *hybridBitArray) MarshalBinary() ([]byte, error) {
+	return hba.ba.MarshalBinary()
+}
+
+// UnmarshalBinary replaces the contents of this bitarray with the
+// provided dense or sparse encoding.
+func (hba *hybridBitArray) UnmarshalBinary(input []byte) error {
+	ba, err := Unmarshal(input)
+	if err != nil {
+		return err
+	}
+
+	hba.ba = ba
+	hba.recount()
+	hba.balance()
+	return nil
+}
+
+func newHybridBitArray(sparseThreshold, denseThreshold float64) *hybridBitArray {
+	return &hybridBitArray{
+		ba:              newSparseBitArray(),
+		sparseThreshold: sparseThreshold,
+		denseThreshold:  denseThreshold,
+	}
+}
+
+// NewHybridBitArray returns a bitarray that never returns an error and
+// switches between a dense and sparse representation depending on how
+// many of its blocks are in use.
+func NewHybridBitArray() BitArray {
+	return newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+}
+
+// NewHybridBitArrayWithThresholds returns a hybrid bitarray that
+// becomes sparse when its block density falls below sparseThreshold and
+// dense when its block density rises above denseThreshold.  Both
+// thresholds must be greater than zero and at most one, and the sparse
+// threshold must be less than the dense threshold so the bitarray does
+// not switch back and forth, otherwise an InvalidThresholdsError is
+// returned.
+func NewHybridBitArrayWithThresholds(sparseThreshold, denseThreshold float64) (BitArray, error) {
+	if !(sparseThreshold > 0 && sparseThreshold < denseThreshold && denseThreshold <= 1) {
+		return nil, InvalidThresholdsError{sparseThreshold, denseThreshold}
+	}
+
+	return newHybridBitArray(sparseThreshold, denseThreshold), nil
+}
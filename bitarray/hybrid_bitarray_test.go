@@ -0,0 +1,133 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHybridSwitchesToDense(t *testing.T) {
+	hba := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+
+	hba.SetBit(s * 3)
+	assert.IsType(t, &sparseBitArray{}, hba.ba)
+
+	hba.SetBit(0)
+	hba.SetBit(s)
+	assert.IsType(t, &bitArray{}, hba.ba)
+	assert.Equal(t, uint64(3), hba.nonEmpty)
+	assert.Equal(t, []uint64{0, s, s * 3}, hba.ToNums())
+
+	// growing a dense array by a single block keeps it dense
+	hba.SetBit(s * 4)
+	assert.IsType(t, &bitArray{}, hba.ba)
+	assert.Equal(t, uint64(4), hba.nonEmpty)
+
+	ok, err := hba.GetBit(s * 100)
+	assert.Nil(t, err)
+	assert.False(t, ok)
+}
+
+func TestHybridThresholds(t *testing.T) {
+	ba, err := NewHybridBitArrayWithThresholds(0.1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.1, ba.(*hybridBitArray).sparseThreshold)
+
+	invalid := [][2]float64{
+		{0, 0.5}, {-0.1, 0.5}, {0.5, 0.5}, {0.6, 0.5}, {0.25, 1.5}, {math.NaN(), 0.5},
+	}
+	for _, thresholds := range invalid {
+		ba, err := NewHybridBitArrayWithThresholds(thresholds[0], thresholds[1])
+		assert.Nil(t, ba)
+		assert.IsType(t, InvalidThresholdsError{}, err)
+	}
+}
+
+func TestHybridSwitchesToSparse(t *testing.T) {
+	hba := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+	hba.SetRange(0, s*4-1)
+	assert.IsType(t, &bitArray{}, hba.ba)
+	assert.Equal(t, uint64(4), hba.nonEmpty)
+
+	// a far away bit would leave a dense array mostly empty
+	hba.SetBit(s * 100)
+	assert.IsType(t, &sparseBitArray{}, hba.ba)
+	assert.Equal(t, s*4+1, hba.CountRange(0, s*100))
+
+	hba.ClearBit(s * 100)
+	assert.IsType(t, &bitArray{}, hba.ba)
+
+	hba.ClearRange(0, s*3-1)
+	assert.IsType(t, &bitArray{}, hba.ba)
+	hba.ClearRange(s*3, s*4-2)
+	assert.IsType(t, &bitArray{}, hba.ba)
+	assert.Equal(t, []uint64{s*4 - 1}, hba.ToNums())
+
+	hba.ClearBit(s*4 - 1)
+	assert.IsType(t, &sparseBitArray{}, hba.ba)
+	assert.Nil(t, hba.ToNums())
+}
+
+func TestHybridEqualsAndOr(t *testing.T) {
+	hba := NewHybridBitArray()
+	hba.SetRange(0, s*2)
+
+	sba := newSparseBitArray()
+	sba.SetRange(0, s*2)
+	assert.True(t, hba.Equals(sba))
+	assert.True(t, sba.Equals(hba))
+	assert.True(t, hba.Intersects(sba))
+
+	other := NewHybridBitArray()
+	other.SetBit(s * 50)
+
+	result := hba.Or(other)
+	assert.IsType(t, &hybridBitArray{}, result)
+	assert.Equal(t, s*2+2, result.CountRange(0, s*50))
+	assert.IsType(t, &sparseBitArray{}, result.(*hybridBitArray).ba)
+
+	result = newBitArray(s * 4).Or(other)
+	assert.Equal(t, []uint64{s * 50}, result.ToNums())
+}
+
+func TestHybridMarshal(t *testing.T) {
+	hba := NewHybridBitArray()
+	hba.SetRange(0, s*3)
+
+	encoded, err := hba.MarshalBinary()
+	assert.Nil(t, err)
+
+	result := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+	assert.Nil(t, result.UnmarshalBinary(encoded))
+	assert.True(t, result.Equals(hba))
+	assert.IsType(t, &bitArray{}, result.ba)
+	assert.Equal(t, uint64(4), result.nonEmpty)
+}
+
+func BenchmarkHybridSetBit(b *testing.B) {
+	numItems := uint64(160000)
+
+	for i := 0; i < b.N; i++ {
+		hba := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+		for j := uint64(0); j < numItems; j += 3 {
+			hba.SetBit(j)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import "sync"
+
+// IDMapper assigns compact uint64 identifiers to arbitrary comparable
+// keys so they can be stored in a bitarray.  Identifiers are handed out
+// in order starting at zero and are never reused, as bitarrays built
+// from them may still refer to them.  IDMapper is threadsafe.
+type IDMapper struct {
+	lock sync.RWMutex
+	ids  map[interface{}]uint64
+	keys []interface{}
+}
+
+// ID returns the identifier of the provided key, assigning the next
+// identifier if the key has not been seen before.  The key must be
+// comparable.
+func (m *IDMapper) ID(key interface{}) uint64 {
+	if id, ok := m.Lookup(key); ok {
+		return id
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	// another goroutine may have assigned it while we were unlocked
+	if id, ok := m.ids[key]; ok {
+		return id
+	}
+
+	id := uint64(len(m.keys))
+	m.ids[key] = id
+	m.keys = append(m.keys, key)
+	return id
+}
+
+// Lookup returns the identifier of the provided key.  The returned
+// bool is false if the key has never been assigned an identifier.
+func (m *IDMapper) Lookup(key interface{}) (uint64, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	id, ok := m.ids[key]
+	return id, ok
+}
+
+// Key returns the key assigned the provided identifier.  The returned
+// bool is false if the identifier has not been assigned.
+func (m *IDMapper) Key(id uint64) (interface{}, bool) {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	if id >= uint64(len(m.keys)) {
+		return nil, false
+	}
+
+	return m.keys[id], true
+}
+
+// Keys returns the keys assigned the provided identifiers, in order.
+// Identifiers that have not been assigned are skipped.  This is
+// typically called with the result of ToNums.
+func (m *IDMapper) Keys(ids []uint64) []interface{} {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	keys := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		if id < uint64(len(m.keys)) {
+			keys = append(keys, m.keys[id])
+		}
+	}
+
+	return keys
+}
+
+// Len returns the number of keys that have been assigned identifiers.
+func (m *IDMapper) Len() uint64 {
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+
+	return uint64(len(m.keys))
+}
+
+// NewIDMapper returns an IDMapper that has not assigned any
+// identifiers.
+func NewIDMapper() *IDMapper {
+	return &IDMapper{
+		ids: make(map[interface{}]uint64),
+	}
+}
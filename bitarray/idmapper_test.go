@@ -0,0 +1,82 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDMapper(t *testing.T) {
+	m := NewIDMapper()
+
+	assert.Equal(t, uint64(0), m.ID("a"))
+	assert.Equal(t, uint64(1), m.ID(5))
+	assert.Equal(t, uint64(0), m.ID("a"))
+	assert.Equal(t, uint64(2), m.Len())
+
+	id, ok := m.Lookup(5)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(1), id)
+	_, ok = m.Lookup("b")
+	assert.False(t, ok)
+	assert.Equal(t, uint64(2), m.Len())
+
+	key, ok := m.Key(0)
+	assert.True(t, ok)
+	assert.Equal(t, "a", key)
+	_, ok = m.Key(2)
+	assert.False(t, ok)
+
+	assert.Equal(t, []interface{}{5, "a"}, m.Keys([]uint64{1, 7, 0}))
+}
+
+func TestIDMapperConcurrentAssignment(t *testing.T) {
+	m := NewIDMapper()
+	var wg sync.WaitGroup
+	wg.Add(10)
+	for i := 0; i < 10; i++ {
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				m.ID(j)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, uint64(100), m.Len())
+	for j := 0; j < 100; j++ {
+		key, _ := m.Key(m.ID(j))
+		assert.Equal(t, j, key)
+	}
+}
+
+func BenchmarkIDMapperID(b *testing.B) {
+	m := NewIDMapper()
+	for i := 0; i < 1000; i++ {
+		m.ID(i)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		m.ID(i % 1000)
+	}
+}
@@ -19,8 +19,8 @@ Package bitarray or bitmap is useful when comparing large amounts of structured
 data if the data can be represented as integers.  For instance, set
 intersection of {1, 3, 5} and {3, 5, 7} represented as bitarrays can
 be done in a single clock cycle (not counting the time it takes to convert)
-the resultant array back into integers).  When Go implements a command
-to get trailing zeroes, the reconversion back into integers should be much faster.
+the resultant array back into integers).  Reconversion back into integers
+uses the trailing and leading zero intrinsics found in math/bits.
 */
 
 package bitarray
@@ -28,6 +28,13 @@ package bitarray
 // BitArray represents a structure that can be used to
 // quickly check for existence when using a large number
 // of items in a very memory efficient way.
+//
+// The range, shift, bit iteration, range-restricted and encoding
+// methods were added after the interface was first published, which
+// breaks implementations outside of this package.  As Blocks returns
+// an iterator over an unexported type, such an implementation can
+// only wrap a bit array from this package and must now delegate these
+// methods to it as well.
 type BitArray interface {
 	// SetBit sets the bit at the given position.  This
 	// function returns an error if the position is out
@@ -41,17 +48,61 @@ type BitArray interface {
 	// function returns an error if the position is out
 	// of range.  A sparse bit array never returns an error.
 	ClearBit(k uint64) error
+	// SetRange sets every bit from start to stop, inclusive.  This
+	// function returns an error if stop is out of range.  A sparse
+	// bit array never returns an error.
+	SetRange(start, stop uint64) error
+	// ClearRange clears every bit from start to stop, inclusive.  This
+	// function returns an error if stop is out of range.  A sparse
+	// bit array never returns an error.
+	ClearRange(start, stop uint64) error
+	// FlipRange flips every bit from start to stop, inclusive.  This
+	// function returns an error if stop is out of range.  A sparse
+	// bit array never returns an error.
+	FlipRange(start, stop uint64) error
+	// CountRange returns the number of set bits from start to
+	// stop, inclusive.
+	CountRange(start, stop uint64) uint64
+	// ShiftLeft moves every bit n positions higher.
+	ShiftLeft(n uint64)
+	// ShiftRight moves every bit n positions lower, dropping the
+	// bits below n.
+	ShiftRight(n uint64)
+	// InsertBits moves every bit at or above the provided position
+	// count positions higher, leaving the inserted positions unset.
+	InsertBits(at, count uint64)
+	// DeleteBits removes the count bits starting at the provided
+	// position and moves every bit above them count positions lower.
+	DeleteBits(at, count uint64)
 	// Reset sets all values to zero.
 	Reset()
 	// Blocks returns an iterator to be used to iterate
 	// over the bit array.
 	Blocks() Iterator
+	// Bits returns an iterator to be used to iterate over
+	// the positions of the set bits in ascending order.
+	Bits() BitIterator
+	// NextSetBit returns the position of the first set bit at
+	// or after the provided position.  The returned bool is false
+	// if no such bit exists.
+	NextSetBit(from uint64) (uint64, bool)
+	// PrevSetBit returns the position of the last set bit at
+	// or before the provided position.  The returned bool is false
+	// if no such bit exists.
+	PrevSetBit(from uint64) (uint64, bool)
 	// Equals returns a bool indicating equality between the
 	// two bit arrays.
 	Equals(other BitArray) bool
 	// Intersects returns a bool indicating if the other bit
 	// array intersects with this bit array.
 	Intersects(other BitArray) bool
+	// IntersectsBetween returns a bool indicating if every bit set
+	// in the other bit array from start to stop, inclusive, is also
+	// set in this bit array.
+	IntersectsBetween(other BitArray, start, stop uint64) bool
+	// EqualsBetween returns a bool indicating if the two bit arrays
+	// have the same bits set from start to stop, inclusive.
+	EqualsBetween(other BitArray, start, stop uint64) bool
 	// Capacity returns either the given capacity of the bit array
 	// in the case of a dense bit array or the highest possible
 	// seen capacity of the sparse array.
@@ -62,6 +113,53 @@ type BitArray interface {
 	// ToNums converts this bit array to the list of numbers contained
 	// within it.
 	ToNums() []uint64
+	// ToNumsBetween returns the numbers contained within this bit
+	// array from start to stop, inclusive.
+	ToNumsBetween(start, stop uint64) []uint64
+	// MarshalBinary encodes this bit array into the portable
+	// binary format.
+	MarshalBinary() ([]byte, error)
+	// UnmarshalBinary replaces the contents of this bit array with
+	// the provided encoding, which may be of either kind.
+	UnmarshalBinary(input []byte) error
+}
+
+// ConcurrentBitArray is a BitArray that is safe to use from
+// multiple goroutines at once.
+type ConcurrentBitArray interface {
+	BitArray
+	// TestAndSetBit sets the bit at the given position and returns
+	// a bool indicating if it was already set.  This function returns
+	// an error if the position is out of range.  A sparse bit array
+	// never returns an error.
+	TestAndSetBit(k uint64) (bool, error)
+	// TestAndClearBit clears the bit at the given position and returns
+	// a bool indicating if it was set.  This function returns an error
+	// if the position is out of range.  A sparse bit array never
+	// returns an error.
+	TestAndClearBit(k uint64) (bool, error)
+}
+
+// MmapBitArray is a dense bit array whose blocks live in a memory
+// mapped file, so it may be larger than what should be resident in
+// the heap and may be shared between processes.  Blocks are read and
+// written atomically.
+type MmapBitArray interface {
+	ConcurrentBitArray
+	// Sync flushes any changes to the underlying file.
+	Sync() error
+	// Close unmaps and closes the underlying file.  The bit array
+	// has no capacity once closed.
+	Close() error
+}
+
+// ResizableBitArray is a dense BitArray whose capacity can be changed.
+// Dense bit arrays returned by NewBitArray satisfy this interface.
+type ResizableBitArray interface {
+	BitArray
+	// Resize truncates or extends the bit array to the given
+	// capacity.  Any bits past the new capacity are cleared.
+	Resize(capacity uint64)
 }
 
 // Iterator defines methods used to iterate over a bit array.
@@ -72,3 +170,13 @@ type Iterator interface {
 	// Value returns the next block and its index
 	Value() (uint64, block)
 }
+
+// BitIterator defines methods used to iterate over the set
+// bits of a bit array.
+type BitIterator interface {
+	// Next moves the pointer to the next set bit.  Returns
+	// false when no set bits remain.
+	Next() bool
+	// Value returns the position of the current set bit.
+	Value() uint64
+}
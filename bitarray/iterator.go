@@ -16,6 +16,8 @@ limitations under the License.
 
 package bitarray
 
+import "math/bits"
+
 type sparseBitArrayIterator struct {
 	index int64
 	sba   *sparseBitArray
@@ -50,7 +52,8 @@ type bitArrayIterator struct {
 // items exist.
 func (iter *bitArrayIterator) Next() bool {
 	iter.index++
-	return uint64(iter.index) <= iter.stopIndex
+	return uint64(iter.index) <= iter.stopIndex &&
+		iter.index < int64(len(iter.ba.blocks))
 }
 
 // Value returns an index and the block at this index.
@@ -67,3 +70,39 @@ func newBitArrayIterator(ba *bitArray) *bitArrayIterator {
 		stopIndex: stop,
 	}
 }
+
+// bitIterator walks the set bits of any bit array by consuming
+// its block iterator and popping bits off each block.
+type bitIterator struct {
+	blocks  Iterator
+	index   uint64
+	current block
+	value   uint64
+}
+
+// Next moves to the next set bit and returns a bool indicating
+// if a set bit was found.
+func (iter *bitIterator) Next() bool {
+	for iter.current == 0 {
+		if !iter.blocks.Next() {
+			return false
+		}
+		iter.index, iter.current = iter.blocks.Value()
+	}
+
+	position := uint64(bits.TrailingZeros64(uint64(iter.current)))
+	iter.current &= iter.current - 1
+	iter.value = iter.index*s + position
+	return true
+}
+
+// Value returns the position of the current set bit.
+func (iter *bitIterator) Value() uint64 {
+	return iter.value
+}
+
+func newBitIterator(blocks Iterator) *bitIterator {
+	return &bitIterator{
+		blocks: blocks,
+	}
+}
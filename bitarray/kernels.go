@@ -0,0 +1,115 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import "math/bits"
+
+// The kernels below run bitwise operations over whole runs of blocks.
+// Each starts out as the portable, unrolled Go implementation and may
+// be replaced at init with an assembly version if the processor
+// supports one.  Build with the purego tag to always use the Go
+// implementations.
+var (
+	orKernel       = orBlocksGeneric
+	andKernel      = andBlocksGeneric
+	popcountKernel = popcountBlocksGeneric
+	equalKernel    = equalBlocksGeneric
+)
+
+// orBlocks sets each block of dst to the bitwise or of the blocks of a
+// and b at the same index.  a and b must be at least as long as dst
+// and dst may alias either of them.
+func orBlocks(dst, a, b []block) {
+	orKernel(dst, a[:len(dst)], b[:len(dst)])
+}
+
+// andBlocks sets each block of dst to the bitwise and of the blocks of
+// a and b at the same index.  a and b must be at least as long as dst
+// and dst may alias either of them.
+func andBlocks(dst, a, b []block) {
+	andKernel(dst, a[:len(dst)], b[:len(dst)])
+}
+
+// popcountBlocks returns the number of set bits in the provided blocks.
+func popcountBlocks(a []block) uint64 {
+	return popcountKernel(a)
+}
+
+// equalBlocks returns a bool indicating if a and b hold the same
+// blocks.  b must be at least as long as a.
+func equalBlocks(a, b []block) bool {
+	return equalKernel(a, b[:len(a)])
+}
+
+func orBlocksGeneric(dst, a, b []block) {
+	i := 0
+	for ; i+4 <= len(dst); i += 4 {
+		dst[i] = a[i] | b[i]
+		dst[i+1] = a[i+1] | b[i+1]
+		dst[i+2] = a[i+2] | b[i+2]
+		dst[i+3] = a[i+3] | b[i+3]
+	}
+	for ; i < len(dst); i++ {
+		dst[i] = a[i] | b[i]
+	}
+}
+
+func andBlocksGeneric(dst, a, b []block) {
+	i := 0
+	for ; i+4 <= len(dst); i += 4 {
+		dst[i] = a[i] & b[i]
+		dst[i+1] = a[i+1] & b[i+1]
+		dst[i+2] = a[i+2] & b[i+2]
+		dst[i+3] = a[i+3] & b[i+3]
+	}
+	for ; i < len(dst); i++ {
+		dst[i] = a[i] & b[i]
+	}
+}
+
+func popcountBlocksGeneric(a []block) uint64 {
+	// separate sums keep the additions independent of each other
+	var c0, c1, c2, c3 int
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		c0 += bits.OnesCount64(uint64(a[i]))
+		c1 += bits.OnesCount64(uint64(a[i+1]))
+		c2 += bits.OnesCount64(uint64(a[i+2]))
+		c3 += bits.OnesCount64(uint64(a[i+3]))
+	}
+	for ; i < len(a); i++ {
+		c0 += bits.OnesCount64(uint64(a[i]))
+	}
+
+	return uint64(c0 + c1 + c2 + c3)
+}
+
+func equalBlocksGeneric(a, b []block) bool {
+	i := 0
+	for ; i+4 <= len(a); i += 4 {
+		if (a[i]^b[i])|(a[i+1]^b[i+1])|(a[i+2]^b[i+2])|(a[i+3]^b[i+3]) != 0 {
+			return false
+		}
+	}
+	for ; i < len(a); i++ {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
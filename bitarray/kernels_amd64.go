@@ -0,0 +1,78 @@
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// cpuid and xgetbv are implemented in kernels_amd64.s.
+func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+func xgetbv() (eax, edx uint32)
+
+//go:noescape
+func orBlocksAVX2(dst, a, b []block)
+
+//go:noescape
+func andBlocksAVX2(dst, a, b []block)
+
+//go:noescape
+func equalBlocksAVX2(a, b []block) bool
+
+//go:noescape
+func popcountBlocksPOPCNT(a []block) uint64
+
+// hasAVX2 returns a bool indicating if both the processor and the
+// operating system support AVX2.
+func hasAVX2() bool {
+	maxLeaf, _, _, _ := cpuid(0, 0)
+	if maxLeaf < 7 {
+		return false
+	}
+
+	_, _, ecx, _ := cpuid(1, 0)
+	const osxsave, avx = 1 << 27, 1 << 28
+	if ecx&osxsave == 0 || ecx&avx == 0 {
+		return false
+	}
+
+	// the operating system must save the xmm and ymm registers
+	if eax, _ := xgetbv(); eax&6 != 6 {
+		return false
+	}
+
+	_, ebx, _, _ := cpuid(7, 0)
+	return ebx&(1<<5) != 0
+}
+
+// hasPOPCNT returns a bool indicating if the processor supports the
+// POPCNT instruction.
+func hasPOPCNT() bool {
+	_, _, ecx, _ := cpuid(1, 0)
+	return ecx&(1<<23) != 0
+}
+
+func init() {
+	if hasAVX2() {
+		orKernel = orBlocksAVX2
+		andKernel = andBlocksAVX2
+		equalKernel = equalBlocksAVX2
+	}
+
+	if hasPOPCNT() {
+		popcountKernel = popcountBlocksPOPCNT
+	}
+}
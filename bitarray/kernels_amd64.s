@@ -0,0 +1,197 @@
+// Copyright 2014 Workiva, LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//  http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build amd64 && !purego
+// +build amd64,!purego
+
+#include "textflag.h"
+
+// func cpuid(eaxArg, ecxArg uint32) (eax, ebx, ecx, edx uint32)
+TEXT ·cpuid(SB), NOSPLIT, $0-24
+	MOVL eaxArg+0(FP), AX
+	MOVL ecxArg+4(FP), CX
+	CPUID
+	MOVL AX, eax+8(FP)
+	MOVL BX, ebx+12(FP)
+	MOVL CX, ecx+16(FP)
+	MOVL DX, edx+20(FP)
+	RET
+
+// func xgetbv() (eax, edx uint32)
+TEXT ·xgetbv(SB), NOSPLIT, $0-8
+	MOVL $0, CX
+	XGETBV
+	MOVL AX, eax+0(FP)
+	MOVL DX, edx+4(FP)
+	RET
+
+// func orBlocksAVX2(dst, a, b []block)
+TEXT ·orBlocksAVX2(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI
+	MOVQ dst_len+8(FP), CX
+	MOVQ a_base+24(FP), SI
+	MOVQ b_base+48(FP), DX
+
+or_loop:
+	// eight blocks at a time in two ymm registers
+	CMPQ CX, $8
+	JB   or_tail
+	VMOVDQU (SI), Y0
+	VMOVDQU 32(SI), Y1
+	VPOR    (DX), Y0, Y0
+	VPOR    32(DX), Y1, Y1
+	VMOVDQU Y0, (DI)
+	VMOVDQU Y1, 32(DI)
+	ADDQ    $64, SI
+	ADDQ    $64, DX
+	ADDQ    $64, DI
+	SUBQ    $8, CX
+	JMP     or_loop
+
+or_tail:
+	TESTQ CX, CX
+	JZ    or_done
+	MOVQ  (SI), AX
+	ORQ   (DX), AX
+	MOVQ  AX, (DI)
+	ADDQ  $8, SI
+	ADDQ  $8, DX
+	ADDQ  $8, DI
+	DECQ  CX
+	JMP   or_tail
+
+or_done:
+	VZEROUPPER
+	RET
+
+// func andBlocksAVX2(dst, a, b []block)
+TEXT ·andBlocksAVX2(SB), NOSPLIT, $0-72
+	MOVQ dst_base+0(FP), DI
+	MOVQ dst_len+8(FP), CX
+	MOVQ a_base+24(FP), SI
+	MOVQ b_base+48(FP), DX
+
+and_loop:
+	CMPQ CX, $8
+	JB   and_tail
+	VMOVDQU (SI), Y0
+	VMOVDQU 32(SI), Y1
+	VPAND   (DX), Y0, Y0
+	VPAND   32(DX), Y1, Y1
+	VMOVDQU Y0, (DI)
+	VMOVDQU Y1, 32(DI)
+	ADDQ    $64, SI
+	ADDQ    $64, DX
+	ADDQ    $64, DI
+	SUBQ    $8, CX
+	JMP     and_loop
+
+and_tail:
+	TESTQ CX, CX
+	JZ    and_done
+	MOVQ  (SI), AX
+	ANDQ  (DX), AX
+	MOVQ  AX, (DI)
+	ADDQ  $8, SI
+	ADDQ  $8, DX
+	ADDQ  $8, DI
+	DECQ  CX
+	JMP   and_tail
+
+and_done:
+	VZEROUPPER
+	RET
+
+// func equalBlocksAVX2(a, b []block) bool
+TEXT ·equalBlocksAVX2(SB), NOSPLIT, $0-49
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	MOVQ b_base+24(FP), DX
+
+equal_loop:
+	CMPQ CX, $8
+	JB   equal_tail
+	VMOVDQU (SI), Y0
+	VMOVDQU 32(SI), Y1
+	VPXOR   (DX), Y0, Y0
+	VPXOR   32(DX), Y1, Y1
+	VPOR    Y1, Y0, Y0
+	VPTEST  Y0, Y0
+	JNZ     equal_false
+	ADDQ    $64, SI
+	ADDQ    $64, DX
+	SUBQ    $8, CX
+	JMP     equal_loop
+
+equal_tail:
+	TESTQ CX, CX
+	JZ    equal_true
+	MOVQ  (SI), AX
+	CMPQ  AX, (DX)
+	JNE   equal_false
+	ADDQ  $8, SI
+	ADDQ  $8, DX
+	DECQ  CX
+	JMP   equal_tail
+
+equal_true:
+	VZEROUPPER
+	MOVB $1, ret+48(FP)
+	RET
+
+equal_false:
+	VZEROUPPER
+	MOVB $0, ret+48(FP)
+	RET
+
+// func popcountBlocksPOPCNT(a []block) uint64
+TEXT ·popcountBlocksPOPCNT(SB), NOSPLIT, $0-32
+	MOVQ a_base+0(FP), SI
+	MOVQ a_len+8(FP), CX
+	XORQ AX, AX
+	XORQ R8, R8
+	XORQ R9, R9
+	XORQ R10, R10
+
+popcount_loop:
+	// four independent sums so the counts can overlap
+	CMPQ    CX, $4
+	JB      popcount_tail
+	POPCNTQ (SI), BX
+	POPCNTQ 8(SI), DX
+	POPCNTQ 16(SI), R11
+	POPCNTQ 24(SI), R12
+	ADDQ    BX, AX
+	ADDQ    DX, R8
+	ADDQ    R11, R9
+	ADDQ    R12, R10
+	ADDQ    $32, SI
+	SUBQ    $4, CX
+	JMP     popcount_loop
+
+popcount_tail:
+	TESTQ   CX, CX
+	JZ      popcount_done
+	POPCNTQ (SI), BX
+	ADDQ    BX, AX
+	ADDQ    $8, SI
+	DECQ    CX
+	JMP     popcount_tail
+
+popcount_done:
+	ADDQ R8, AX
+	ADDQ R10, R9
+	ADDQ R9, AX
+	MOVQ AX, ret+24(FP)
+	RET
@@ -0,0 +1,171 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// benchmarkBlocks is the number of blocks in a ten million bit array.
+const benchmarkBlocks = int(10000000 / s)
+
+func randomBlocks(r *rand.Rand, n int) []block {
+	blocks := make([]block, n)
+	for i := range blocks {
+		blocks[i] = block(r.Uint64())
+	}
+
+	return blocks
+}
+
+func TestKernelsMatchGeneric(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	for n := 0; n < 40; n++ {
+		a, b := randomBlocks(r, n), randomBlocks(r, n)
+
+		expected, result := make([]block, n), make([]block, n)
+		orBlocksGeneric(expected, a, b)
+		orBlocks(result, a, b)
+		assert.Equal(t, expected, result)
+
+		andBlocksGeneric(expected, a, b)
+		andBlocks(result, a, b)
+		assert.Equal(t, expected, result)
+
+		assert.Equal(t, popcountBlocksGeneric(a), popcountBlocks(a))
+		assert.True(t, equalBlocks(a, a))
+		if n > 0 {
+			c := append([]block(nil), a...)
+			c[r.Intn(n)] ^= 1 << uint(r.Intn(int(s)))
+			assert.False(t, equalBlocks(a, c))
+			assert.False(t, equalBlocksGeneric(a, c))
+		}
+	}
+}
+
+func TestKernelsAlias(t *testing.T) {
+	a := []block{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	b := []block{3, 3, 3, 3, 3, 3, 3, 3, 3, 3}
+
+	andBlocks(a, a, b)
+	assert.Equal(t, []block{1, 2, 3, 0, 1, 2, 3, 0, 1, 2}, a)
+
+	orBlocks(a[:4], a, b)
+	assert.Equal(t, []block{3, 3, 3, 3, 1, 2, 3, 0, 1, 2}, a)
+}
+
+func TestKernelsShortInputs(t *testing.T) {
+	assert.Panics(t, func() {
+		orBlocks(make([]block, 4), make([]block, 4), make([]block, 3))
+	})
+	assert.Panics(t, func() {
+		equalBlocks(make([]block, 4), make([]block, 3))
+	})
+}
+
+func TestDenseAggregatesUseKernels(t *testing.T) {
+	ba := newBitArray(s * 100)
+	other := newBitArray(s * 20)
+	for i := uint64(0); i < s*100; i += 7 {
+		ba.SetBit(i)
+	}
+	for i := uint64(0); i < s*20; i += 3 {
+		other.SetBit(i)
+	}
+
+	expected := AndAll(toSparse(ba), toSparse(other))
+	result := AndAll(ba, other)
+	assert.True(t, result.Equals(expected))
+	assert.Equal(t, uint64(s*100), result.Capacity())
+
+	expected = OrAll(toSparse(ba), toSparse(other))
+	result = OrAll(ba, other)
+	assert.True(t, result.Equals(expected))
+	assert.Equal(t, expected.ToNums(), result.ToNums())
+
+	assert.Equal(t, uint64(len(ba.ToNums())), ba.CountRange(0, s*100))
+}
+
+func benchmarkOr(b *testing.B, kernel func(dst, a, b []block)) {
+	r := rand.New(rand.NewSource(42))
+	x, y := randomBlocks(r, benchmarkBlocks), randomBlocks(r, benchmarkBlocks)
+	dst := make([]block, benchmarkBlocks)
+	b.SetBytes(int64(benchmarkBlocks * 8))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		kernel(dst, x, y)
+	}
+}
+
+func BenchmarkOrBlocks(b *testing.B) {
+	benchmarkOr(b, orBlocks)
+}
+
+func BenchmarkOrBlocksGeneric(b *testing.B) {
+	benchmarkOr(b, orBlocksGeneric)
+}
+
+func BenchmarkAndBlocks(b *testing.B) {
+	benchmarkOr(b, andBlocks)
+}
+
+func BenchmarkAndBlocksGeneric(b *testing.B) {
+	benchmarkOr(b, andBlocksGeneric)
+}
+
+func benchmarkPopcount(b *testing.B, kernel func(a []block) uint64) {
+	r := rand.New(rand.NewSource(42))
+	x := randomBlocks(r, benchmarkBlocks)
+	b.SetBytes(int64(benchmarkBlocks * 8))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		kernel(x)
+	}
+}
+
+func BenchmarkPopcountBlocks(b *testing.B) {
+	benchmarkPopcount(b, popcountBlocks)
+}
+
+func BenchmarkPopcountBlocksGeneric(b *testing.B) {
+	benchmarkPopcount(b, popcountBlocksGeneric)
+}
+
+func benchmarkEqual(b *testing.B, kernel func(a, b []block) bool) {
+	r := rand.New(rand.NewSource(42))
+	x := randomBlocks(r, benchmarkBlocks)
+	y := append([]block(nil), x...)
+	b.SetBytes(int64(benchmarkBlocks * 8))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		kernel(x, y)
+	}
+}
+
+func BenchmarkEqualBlocks(b *testing.B) {
+	benchmarkEqual(b, equalBlocks)
+}
+
+func BenchmarkEqualBlocksGeneric(b *testing.B) {
+	benchmarkEqual(b, equalBlocksGeneric)
+}
@@ -0,0 +1,151 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// KeySet is a set of arbitrary comparable keys stored in a bitarray.
+// Keys are translated to bit positions by an IDMapper, which should be
+// shared between sets that are combined often: sets with the same
+// mapper are combined with bitwise operations while sets with
+// different mappers are combined key by key.  KeySet is not
+// threadsafe.
+type KeySet struct {
+	mapper *IDMapper
+	ba     BitArray
+}
+
+// Add adds the provided keys to the set.  An error is returned if the
+// underlying bitarray cannot hold the identifier of a key.
+func (ks *KeySet) Add(keys ...interface{}) error {
+	for _, key := range keys {
+		if err := ks.ba.SetBit(ks.mapper.ID(key)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Remove removes the provided keys from the set.
+func (ks *KeySet) Remove(keys ...interface{}) {
+	for _, key := range keys {
+		if id, ok := ks.mapper.Lookup(key); ok {
+			ks.ba.ClearBit(id)
+		}
+	}
+}
+
+// Contains returns a bool indicating if the provided key is in the set.
+func (ks *KeySet) Contains(key interface{}) bool {
+	id, ok := ks.mapper.Lookup(key)
+	if !ok {
+		return false
+	}
+
+	result, _ := ks.ba.GetBit(id)
+	return result
+}
+
+// Len returns the number of keys in the set.
+func (ks *KeySet) Len() uint64 {
+	return ks.ba.CountRange(0, ^uint64(0))
+}
+
+// Keys returns the keys in the set ordered by identifier.
+func (ks *KeySet) Keys() []interface{} {
+	return ks.mapper.Keys(ks.ba.ToNums())
+}
+
+// BitArray returns the bitarray backing this set.
+func (ks *KeySet) BitArray() BitArray {
+	return ks.ba
+}
+
+// Mapper returns the IDMapper used by this set.
+func (ks *KeySet) Mapper() *IDMapper {
+	return ks.mapper
+}
+
+// bitsOf returns the keys of the provided set as a bitarray using this
+// set's mapper.  If assign is false keys this mapper has never seen
+// are left out.
+func (ks *KeySet) bitsOf(other *KeySet, assign bool) BitArray {
+	if other.mapper == ks.mapper {
+		return other.ba
+	}
+
+	result := newSparseBitArray()
+	for _, key := range other.Keys() {
+		if assign {
+			result.SetBit(ks.mapper.ID(key))
+		} else if id, ok := ks.mapper.Lookup(key); ok {
+			result.SetBit(id)
+		}
+	}
+
+	return result
+}
+
+// matchKind makes the freshly built result of combining with ba behave
+// like ba where it can, so keys can still be added to a set built from
+// a growable or hybrid bitarray.
+func matchKind(ba, result BitArray) BitArray {
+	switch b := ba.(type) {
+	case *bitArray:
+		if dba, ok := result.(*bitArray); ok {
+			dba.growable = b.growable
+		}
+	case *hybridBitArray:
+		if _, ok := result.(*hybridBitArray); !ok {
+			hba := newHybridBitArray(b.sparseThreshold, b.denseThreshold)
+			hba.ba = result
+			hba.recount()
+			hba.balance()
+			return hba
+		}
+	}
+
+	return result
+}
+
+// Union returns a new set with the keys in either set.  The result
+// uses this set's mapper.
+func (ks *KeySet) Union(other *KeySet) *KeySet {
+	return &KeySet{
+		mapper: ks.mapper,
+		ba:     matchKind(ks.ba, ks.ba.Or(ks.bitsOf(other, true))),
+	}
+}
+
+// Intersect returns a new set with the keys in both sets.  The result
+// uses this set's mapper.
+func (ks *KeySet) Intersect(other *KeySet) *KeySet {
+	return &KeySet{
+		mapper: ks.mapper,
+		ba:     matchKind(ks.ba, AndAll(ks.ba, ks.bitsOf(other, false))),
+	}
+}
+
+// NewKeySet returns a set that translates keys with the
+// provided mapper and stores them in the provided bitarray.  Mapped
+// identifiers are compact, so a growable dense bitarray is usually the
+// best choice unless the set holds few of the mapper's keys.
+func NewKeySet(mapper *IDMapper, ba BitArray) *KeySet {
+	return &KeySet{
+		mapper: mapper,
+		ba:     ba,
+	}
+}
@@ -0,0 +1,104 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestKeySetAddContainsRemove(t *testing.T) {
+	m := NewIDMapper()
+	for _, ba := range []BitArray{NewGrowableBitArray(0), NewSparseBitArray(), NewHybridBitArray()} {
+		ks := NewKeySet(m, ba)
+		assert.Nil(t, ks.Add("a", "b", 3))
+		assert.True(t, ks.Contains("a"))
+		assert.True(t, ks.Contains(3))
+		assert.False(t, ks.Contains("c"))
+		assert.Equal(t, uint64(3), ks.Len())
+
+		ks.Remove("a", "c")
+		assert.False(t, ks.Contains("a"))
+		assert.Equal(t, []interface{}{"b", 3}, ks.Keys())
+	}
+}
+
+func TestKeySetAddOutOfRange(t *testing.T) {
+	m := NewIDMapper()
+	ks := NewKeySet(m, NewBitArray(s))
+	for i := uint64(0); i < s; i++ {
+		m.ID(i)
+	}
+
+	assert.IsType(t, OutOfRangeError(0), ks.Add("a"))
+	assert.False(t, ks.Contains("a"))
+}
+
+func TestKeySetUnionIntersect(t *testing.T) {
+	m := NewIDMapper()
+	ks := NewKeySet(m, NewGrowableBitArray(0))
+	other := NewKeySet(m, NewSparseBitArray())
+	ks.Add("a", "b", "c")
+	other.Add("b", "c", "d")
+
+	union := ks.Union(other)
+	assert.Equal(t, []interface{}{"a", "b", "c", "d"}, union.Keys())
+	assert.Nil(t, union.Add("e"))
+	assert.True(t, union.Contains("e"))
+	assert.False(t, ks.Contains("e"))
+
+	intersection := ks.Intersect(other)
+	assert.Equal(t, []interface{}{"b", "c"}, intersection.Keys())
+	assert.Nil(t, intersection.Add("f"))
+	assert.True(t, intersection.Contains("f"))
+}
+
+func TestKeySetAcrossMappers(t *testing.T) {
+	ks := NewKeySet(NewIDMapper(), NewHybridBitArray())
+	other := NewKeySet(NewIDMapper(), NewSparseBitArray())
+	ks.Add("a", "b")
+	other.Add("c", "b")
+
+	union := ks.Union(other)
+	assert.Equal(t, ks.Mapper(), union.Mapper())
+	assert.Equal(t, []interface{}{"a", "b", "c"}, union.Keys())
+
+	intersection := ks.Intersect(other)
+	assert.Equal(t, []interface{}{"b"}, intersection.Keys())
+	assert.IsType(t, &hybridBitArray{}, intersection.BitArray())
+}
+
+func BenchmarkKeySetIntersect(b *testing.B) {
+	m := NewIDMapper()
+	ks := NewKeySet(m, NewGrowableBitArray(0))
+	other := NewKeySet(m, NewGrowableBitArray(0))
+	for i := 0; i < 100000; i++ {
+		if i%2 == 0 {
+			ks.Add(i)
+		}
+		if i%3 == 0 {
+			other.Add(i)
+		}
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ks.Intersect(other)
+	}
+}
@@ -0,0 +1,273 @@
+//go:build linux || darwin
+// +build linux darwin
+
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"os"
+	"syscall"
+	"unsafe"
+)
+
+// blockBytes is the number of bytes a block takes up in the file.
+const blockBytes = int64(s / 8)
+
+// mmapBitArray is a concurrent bit array whose blocks are a shared
+// mapping of a file.  The file holds nothing but the blocks, in the
+// same layout and native byte order as the blocks of a dense bit
+// array, so any process mapping the same file sees the same bits.
+type mmapBitArray struct {
+	*concurrentBitArray
+	file     *os.File
+	data     []byte
+	readOnly bool
+}
+
+// SetBit sets the bit at the given index.
+func (mba *mmapBitArray) SetBit(k uint64) error {
+	if mba.readOnly {
+		return ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.SetBit(k)
+}
+
+// ClearBit clears the bit at the given index.
+func (mba *mmapBitArray) ClearBit(k uint64) error {
+	if mba.readOnly {
+		return ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.ClearBit(k)
+}
+
+// TestAndSetBit sets the bit at the given index and returns a bool
+// indicating if it was already set.
+func (mba *mmapBitArray) TestAndSetBit(k uint64) (bool, error) {
+	if mba.readOnly {
+		return false, ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.TestAndSetBit(k)
+}
+
+// TestAndClearBit clears the bit at the given index and returns a bool
+// indicating if it was set.
+func (mba *mmapBitArray) TestAndClearBit(k uint64) (bool, error) {
+	if mba.readOnly {
+		return false, ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.TestAndClearBit(k)
+}
+
+// SetRange sets every bit from start to stop, inclusive.
+func (mba *mmapBitArray) SetRange(start, stop uint64) error {
+	if mba.readOnly {
+		return ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.SetRange(start, stop)
+}
+
+// ClearRange clears every bit from start to stop, inclusive.
+func (mba *mmapBitArray) ClearRange(start, stop uint64) error {
+	if mba.readOnly {
+		return ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.ClearRange(start, stop)
+}
+
+// FlipRange flips every bit from start to stop, inclusive.
+func (mba *mmapBitArray) FlipRange(start, stop uint64) error {
+	if mba.readOnly {
+		return ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.FlipRange(start, stop)
+}
+
+// Reset clears out the bit array.  This does nothing if the bit array
+// is read only.
+func (mba *mmapBitArray) Reset() {
+	if !mba.readOnly {
+		mba.concurrentBitArray.Reset()
+	}
+}
+
+// ShiftLeft moves every bit n positions higher, dropping the bits
+// moved past the capacity of this bit array.  This does nothing if the
+// bit array is read only.
+func (mba *mmapBitArray) ShiftLeft(n uint64) {
+	mba.InsertBits(0, n)
+}
+
+// ShiftRight moves every bit n positions lower, dropping the bits
+// below n.  This does nothing if the bit array is read only.
+func (mba *mmapBitArray) ShiftRight(n uint64) {
+	mba.DeleteBits(0, n)
+}
+
+// InsertBits moves every bit at or above the provided position count
+// positions higher, leaving the inserted positions unset and dropping
+// the bits moved past the capacity of this bit array.  This does
+// nothing if the bit array is read only.
+func (mba *mmapBitArray) InsertBits(at, count uint64) {
+	if !mba.readOnly {
+		mba.concurrentBitArray.InsertBits(at, count)
+	}
+}
+
+// DeleteBits removes the count bits starting at the provided position
+// and moves every bit above them count positions lower.  This does
+// nothing if the bit array is read only.
+func (mba *mmapBitArray) DeleteBits(at, count uint64) {
+	if !mba.readOnly {
+		mba.concurrentBitArray.DeleteBits(at, count)
+	}
+}
+
+// UnmarshalBinary replaces the contents of this bit array with the
+// provided dense or sparse encoding.  The capacity of this bit array
+// does not change.
+func (mba *mmapBitArray) UnmarshalBinary(input []byte) error {
+	if mba.readOnly {
+		return ReadOnlyError{}
+	}
+
+	return mba.concurrentBitArray.UnmarshalBinary(input)
+}
+
+// Sync flushes any changes to the underlying file.
+func (mba *mmapBitArray) Sync() error {
+	if len(mba.data) == 0 {
+		return nil
+	}
+
+	_, _, errno := syscall.Syscall(syscall.SYS_MSYNC,
+		uintptr(unsafe.Pointer(&mba.data[0])), uintptr(len(mba.data)), syscall.MS_SYNC)
+	if errno != 0 {
+		return errno
+	}
+
+	return nil
+}
+
+// Close unmaps and closes the underlying file.  This must not be called
+// while other goroutines are using the bit array.
+func (mba *mmapBitArray) Close() error {
+	if mba.file == nil {
+		return nil
+	}
+
+	mba.blocks = nil
+	if mba.data != nil {
+		if err := syscall.Munmap(mba.data); err != nil {
+			return err
+		}
+		mba.data = nil
+	}
+
+	err := mba.file.Close()
+	mba.file = nil
+	return err
+}
+
+func openMmapBitArray(path string, size uint64, readOnly bool) (*mmapBitArray, error) {
+	flag, prot := os.O_RDWR|os.O_CREATE, syscall.PROT_READ|syscall.PROT_WRITE
+	if readOnly {
+		flag, prot = os.O_RDONLY, syscall.PROT_READ
+	}
+
+	file, err := os.OpenFile(path, flag, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	length := info.Size()
+	if length%blockBytes != 0 {
+		file.Close()
+		return nil, InvalidEncodingError(`file size is not a whole number of blocks`)
+	}
+
+	i, r := getIndexAndRemainder(size)
+	if r > 0 {
+		i++
+	}
+
+	if !readOnly && int64(i)*blockBytes > length {
+		length = int64(i) * blockBytes
+		if err := file.Truncate(length); err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
+	mba := &mmapBitArray{
+		concurrentBitArray: &concurrentBitArray{},
+		file:               file,
+		readOnly:           readOnly,
+	}
+	if length == 0 {
+		return mba, nil
+	}
+
+	data, err := syscall.Mmap(int(file.Fd()), 0, int(length), prot, syscall.MAP_SHARED)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	// mappings are page aligned so the data can be viewed as blocks
+	mba.data = data
+	mba.blocks = unsafe.Slice((*block)(unsafe.Pointer(&data[0])), len(data)/int(blockBytes))
+	return mba, nil
+}
+
+// OpenMmapBitArray maps the file at the given path into memory as a
+// dense bit array that can be read and written.  The file is created
+// if it does not exist and grown to hold at least size bits if it is
+// smaller.  The capacity of the bit array is the size of the file.
+func OpenMmapBitArray(path string, size uint64) (MmapBitArray, error) {
+	mba, err := openMmapBitArray(path, size, false)
+	if err != nil {
+		return nil, err
+	}
+
+	return mba, nil
+}
+
+// OpenMmapBitArrayReadOnly maps the file at the given path into memory
+// as a dense bit array that can only be read.  Any attempt to modify
+// the bit array returns a ReadOnlyError.
+func OpenMmapBitArrayReadOnly(path string) (MmapBitArray, error) {
+	mba, err := openMmapBitArray(path, 0, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return mba, nil
+}
@@ -0,0 +1,32 @@
+//go:build !linux && !darwin
+// +build !linux,!darwin
+
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// OpenMmapBitArray is not supported on this platform and always
+// returns an UnsupportedError.
+func OpenMmapBitArray(path string, size uint64) (MmapBitArray, error) {
+	return nil, UnsupportedError(`Memory mapped bitarrays`)
+}
+
+// OpenMmapBitArrayReadOnly is not supported on this platform and
+// always returns an UnsupportedError.
+func OpenMmapBitArrayReadOnly(path string) (MmapBitArray, error) {
+	return nil, UnsupportedError(`Memory mapped bitarrays`)
+}
@@ -0,0 +1,234 @@
+//go:build linux || darwin
+// +build linux darwin
+
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempBitArrayPath(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "bitarray")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return filepath.Join(dir, "bits")
+}
+
+func TestMmapBitArrayPersists(t *testing.T) {
+	path := tempBitArrayPath(t)
+	ba, err := OpenMmapBitArray(path, s*2+1)
+	if !assert.Nil(t, err) {
+		return
+	}
+
+	assert.Equal(t, uint64(s*3), ba.Capacity())
+	assert.Nil(t, ba.SetBit(9))
+	assert.Nil(t, ba.SetRange(s*2, s*2+3))
+	assert.IsType(t, OutOfRangeError(0), ba.SetBit(s*3))
+	assert.Nil(t, ba.Sync())
+	assert.Nil(t, ba.Close())
+	assert.Nil(t, ba.Close())
+
+	// the file is just the blocks
+	data, err := ioutil.ReadFile(path)
+	assert.Nil(t, err)
+	assert.Len(t, data, 24)
+	assert.Equal(t, uint64(1<<9), binary.LittleEndian.Uint64(data))
+	assert.Equal(t, uint64(0xF), binary.LittleEndian.Uint64(data[16:]))
+
+	ba, err = OpenMmapBitArrayReadOnly(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ba.Close()
+
+	assert.Equal(t, []uint64{9, s * 2, s*2 + 1, s*2 + 2, s*2 + 3}, ba.ToNums())
+	result, err := ba.GetBit(9)
+	assert.Nil(t, err)
+	assert.True(t, result)
+	assert.Equal(t, uint64(4), ba.CountRange(s, s*3))
+}
+
+func TestMmapBitArrayReadOnly(t *testing.T) {
+	path := tempBitArrayPath(t)
+	ba, err := OpenMmapBitArray(path, s)
+	assert.Nil(t, err)
+	ba.SetBit(3)
+	ba.Close()
+
+	ba, err = OpenMmapBitArrayReadOnly(path)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ba.Close()
+
+	assert.IsType(t, ReadOnlyError{}, ba.SetBit(1))
+	assert.IsType(t, ReadOnlyError{}, ba.ClearBit(3))
+	assert.IsType(t, ReadOnlyError{}, ba.SetRange(0, 5))
+	_, err = ba.TestAndSetBit(1)
+	assert.IsType(t, ReadOnlyError{}, err)
+	ba.Reset()
+	ba.ShiftLeft(1)
+	assert.Equal(t, []uint64{3}, ba.ToNums())
+}
+
+func TestMmapBitArrayShared(t *testing.T) {
+	path := tempBitArrayPath(t)
+	ba, err := OpenMmapBitArray(path, s*4)
+	assert.Nil(t, err)
+	defer ba.Close()
+	other, err := OpenMmapBitArray(path, 0)
+	assert.Nil(t, err)
+	defer other.Close()
+
+	assert.Equal(t, ba.Capacity(), other.Capacity())
+	ba.SetBit(100)
+	result, _ := other.GetBit(100)
+	assert.True(t, result)
+
+	wasSet, err := other.TestAndSetBit(100)
+	assert.Nil(t, err)
+	assert.True(t, wasSet)
+
+	other.SetBit(s * 3)
+	assert.True(t, ba.Equals(other))
+	assert.Equal(t, []uint64{100, s * 3}, ba.ToNums())
+	k, ok := ba.NextSetBit(101)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(s*3), k)
+}
+
+func TestMmapBitArrayReadsInPlace(t *testing.T) {
+	// 32MB of blocks, none of which should be copied to be read
+	size := uint64(1 << 28)
+	ba, err := OpenMmapBitArray(tempBitArrayPath(t), size)
+	if !assert.Nil(t, err) {
+		return
+	}
+	defer ba.Close()
+
+	ba.SetBit(3)
+	ba.SetBit(size / 2)
+	ba.SetBit(size - 1)
+	sba := newSparseBitArray()
+	sba.SetBit(3)
+	sba.SetBit(size / 2)
+	sba.SetBit(size - 1)
+	dense := newBitArray(size)
+	dense.SetRange(0, size-1)
+
+	limit := size / s
+	assert.True(t, allocated(func() {
+		count := 0
+		for iter := ba.Bits(); iter.Next(); {
+			count++
+		}
+		assert.Equal(t, 3, count)
+		assert.Equal(t, []uint64{3, size / 2, size - 1}, ba.ToNums())
+		assert.True(t, ba.Equals(sba))
+		assert.True(t, sba.Equals(ba))
+		assert.True(t, ba.Intersects(sba))
+		assert.True(t, dense.Intersects(ba))
+		assert.True(t, sba.EqualsBetween(ba, 0, size-1))
+		assert.Equal(t, uint64(3), ba.CountRange(0, size-1))
+
+		ba.InsertBits(size/2, 1)
+		ba.DeleteBits(size/2, 1)
+	}) < limit)
+	assert.Equal(t, []uint64{3, size / 2}, ba.ToNums())
+
+	// the encoding is the only allocation as large as the mapping
+	var encoded []byte
+	assert.True(t, allocated(func() {
+		encoded, err = ba.MarshalBinary()
+	}) < size/8+limit)
+	assert.Nil(t, err)
+	result, err := Unmarshal(encoded)
+	assert.Nil(t, err)
+	assert.True(t, result.Equals(ba))
+}
+
+func TestMmapBitArrayGrowsFile(t *testing.T) {
+	path := tempBitArrayPath(t)
+	ba, err := OpenMmapBitArray(path, s)
+	assert.Nil(t, err)
+	ba.SetBit(1)
+	ba.Close()
+
+	ba, err = OpenMmapBitArray(path, s*2)
+	assert.Nil(t, err)
+	defer ba.Close()
+	assert.Equal(t, uint64(s*2), ba.Capacity())
+	assert.Equal(t, []uint64{1}, ba.ToNums())
+}
+
+func TestMmapBitArrayErrors(t *testing.T) {
+	path := tempBitArrayPath(t)
+	_, err := OpenMmapBitArrayReadOnly(path)
+	assert.True(t, os.IsNotExist(err))
+
+	assert.Nil(t, ioutil.WriteFile(path, make([]byte, 5), 0644))
+	_, err = OpenMmapBitArray(path, 0)
+	assert.IsType(t, InvalidEncodingError(""), err)
+
+	assert.Nil(t, ioutil.WriteFile(path, nil, 0644))
+	ba, err := OpenMmapBitArrayReadOnly(path)
+	assert.Nil(t, err)
+	assert.Equal(t, uint64(0), ba.Capacity())
+	assert.Nil(t, ba.Sync())
+	assert.Nil(t, ba.Close())
+
+	ba, err = OpenMmapBitArray(path, s)
+	assert.Nil(t, err)
+	ba.Close()
+	_, err = ba.GetBit(0)
+	assert.IsType(t, OutOfRangeError(0), err)
+}
+
+func BenchmarkMmapBitArraySetBit(b *testing.B) {
+	dir, err := ioutil.TempDir("", "bitarray")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	numItems := uint64(1000000)
+	ba, err := OpenMmapBitArray(filepath.Join(dir, "bits"), numItems)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer ba.Close()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ba.SetBit(uint64(i) % numItems)
+	}
+}
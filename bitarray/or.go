@@ -131,20 +131,16 @@ func orDenseWithDenseBitArray(dba *bitArray, other *bitArray) BitArray {
 
 	ba := newBitArray(max * s)
 
-	for i := uint64(0); i < max; i++ {
-		if i == uint64(len(dba.blocks)) {
-			copy(ba.blocks[i:], other.blocks[i:])
-			break
-		}
-
-		if i == uint64(len(other.blocks)) {
-			copy(ba.blocks[i:], dba.blocks[i:])
-			break
-		}
-
-		ba.blocks[i] = dba.blocks[i].or(other.blocks[i])
+	n := len(dba.blocks)
+	if len(other.blocks) < n {
+		n = len(other.blocks)
 	}
 
+	orBlocks(ba.blocks[:n], dba.blocks, other.blocks)
+	// only the longer of the two has anything left to copy
+	copy(ba.blocks[n:], dba.blocks[n:])
+	copy(ba.blocks[n:], other.blocks[n:])
+
 	ba.setLowest()
 	ba.setHighest()
 
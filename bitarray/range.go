@@ -0,0 +1,124 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// rangeIterator restricts a block iterator to the blocks touched by
+// the range from start to stop, inclusive, masking off any bits that
+// fall outside of the range.
+type rangeIterator struct {
+	iter        Iterator
+	start, stop uint64
+}
+
+// Next moves to the next block within the range and returns a bool
+// indicating if one was found.
+func (iter *rangeIterator) Next() bool {
+	startIndex, _ := getIndexAndRemainder(iter.start)
+	stopIndex, _ := getIndexAndRemainder(iter.stop)
+	for iter.iter.Next() {
+		index, _ := iter.iter.Value()
+		if index > stopIndex {
+			return false
+		}
+
+		if index >= startIndex {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Value returns the index of the current block and the bits of that
+// block within the range.
+func (iter *rangeIterator) Value() (uint64, block) {
+	index, b := iter.iter.Value()
+	return index, b & blockRangeMask(index, iter.start, iter.stop)
+}
+
+// blocksBetween returns an iterator over the blocks of the provided
+// bit array from start to stop, inclusive.  The underlying iterator is
+// positioned at the start of the range so blocks before it are skipped
+// without being visited.
+func blocksBetween(ba BitArray, start, stop uint64) Iterator {
+	startIndex, _ := getIndexAndRemainder(start)
+	var iter Iterator
+	switch cba := concrete(ba).(type) {
+	case *bitArray:
+		bai := newBitArrayIterator(cba)
+		if bai.index < int64(startIndex)-1 {
+			bai.index = int64(startIndex) - 1
+		}
+		iter = bai
+	case *sparseBitArray:
+		sbai := newCompressedBitArrayIterator(cba)
+		sbai.index = cba.indices.search(startIndex) - 1
+		iter = sbai
+	case *concurrentBitArray:
+		iter = newConcurrentBitArrayIterator(cba, startIndex)
+	}
+
+	return &rangeIterator{iter: iter, start: start, stop: stop}
+}
+
+// intersectsBetween returns a bool indicating if every bit set in
+// other from start to stop, inclusive, is also set in ba.
+func intersectsBetween(ba, other BitArray, start, stop uint64) bool {
+	if start > stop {
+		return true
+	}
+
+	result := true
+	mergeIterators(blocksBetween(ba, start, stop), blocksBetween(other, start, stop), func(b, o block) bool {
+		result = o&^b == 0
+		return result
+	})
+
+	return result
+}
+
+// equalsBetween returns a bool indicating if both bit arrays have the
+// same bits set from start to stop, inclusive.
+func equalsBetween(ba, other BitArray, start, stop uint64) bool {
+	if start > stop {
+		return true
+	}
+
+	result := true
+	mergeIterators(blocksBetween(ba, start, stop), blocksBetween(other, start, stop), func(b, o block) bool {
+		result = b == o
+		return result
+	})
+
+	return result
+}
+
+// toNumsBetween returns the numbers set in ba from start to stop,
+// inclusive.
+func toNumsBetween(ba BitArray, start, stop uint64) []uint64 {
+	nums := make([]uint64, 0)
+	if start > stop {
+		return nums
+	}
+
+	for iter := blocksBetween(ba, start, stop); iter.Next(); {
+		index, b := iter.Value()
+		b.toNums(index*s, &nums)
+	}
+
+	return nums
+}
@@ -0,0 +1,109 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// maxIndex is the index of the block holding the highest possible
+// position.
+const maxIndex = ^uint64(0) / s
+
+// lowMask returns a block with every position below the provided
+// position set.
+func lowMask(position uint64) block {
+	return block(1)<<position - 1
+}
+
+// insertBits moves every bit of b at or above the provided position
+// up by count positions, in place, leaving the inserted positions
+// unset.  Bits moved past the last block are dropped.
+func insertBits(b []block, at, count uint64) {
+	insertBlocks(uint64(len(b)), func(i uint64) block {
+		return b[i]
+	}, func(i uint64, v block) {
+		b[i] = v
+	}, at, count)
+}
+
+// insertBlocks is insertBits over n blocks read with load and written
+// with store.
+func insertBlocks(n uint64, load func(uint64) block, store func(uint64, block), at, count uint64) {
+	atIndex, atPos := getIndexAndRemainder(at)
+	if atIndex >= n || count == 0 {
+		return
+	}
+
+	q, r := getIndexAndRemainder(count)
+	low := load(atIndex) & lowMask(atPos)
+	source := func(j uint64) block {
+		if j == atIndex {
+			return load(j) &^ low
+		}
+		return load(j)
+	}
+
+	// walk down so every source block is read before it is written
+	for i := n; i > atIndex; {
+		i--
+		var result block
+		if i >= atIndex+q {
+			j := i - q
+			result = source(j) << r
+			if j > atIndex {
+				result |= source(j-1) >> (s - r)
+			}
+		}
+		store(i, result)
+	}
+
+	store(atIndex, load(atIndex)|low)
+}
+
+// deleteBits removes the count bits of b starting at the provided
+// position, in place, moving every bit above them down by count
+// positions.
+func deleteBits(b []block, at, count uint64) {
+	deleteBlocks(uint64(len(b)), func(i uint64) block {
+		return b[i]
+	}, func(i uint64, v block) {
+		b[i] = v
+	}, at, count)
+}
+
+// deleteBlocks is deleteBits over n blocks read with load and written
+// with store.
+func deleteBlocks(n uint64, load func(uint64) block, store func(uint64, block), at, count uint64) {
+	atIndex, atPos := getIndexAndRemainder(at)
+	if atIndex >= n || count == 0 {
+		return
+	}
+
+	q, r := getIndexAndRemainder(count)
+	low := load(atIndex) & lowMask(atPos)
+	source := func(j uint64) block {
+		if j >= n {
+			return 0
+		}
+		return load(j)
+	}
+
+	// walk up so every source block is read before it is written
+	for i := atIndex; i < n; i++ {
+		j := i + q
+		store(i, source(j)>>r|source(j+1)<<(s-r))
+	}
+
+	store(atIndex, load(atIndex)&^lowMask(atPos)|low)
+}
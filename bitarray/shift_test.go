@@ -0,0 +1,203 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// expectedInsert returns the numbers expected after inserting count
+// bits at the provided position, dropping anything at or past limit.
+func expectedInsert(nums []uint64, at, count, limit uint64) []uint64 {
+	result := make([]uint64, 0, len(nums))
+	for _, num := range nums {
+		if num >= at {
+			num += count
+		}
+		if num < limit {
+			result = append(result, num)
+		}
+	}
+
+	return result
+}
+
+// expectedDelete returns the numbers expected after deleting count
+// bits at the provided position.
+func expectedDelete(nums []uint64, at, count uint64) []uint64 {
+	result := make([]uint64, 0, len(nums))
+	for _, num := range nums {
+		switch {
+		case num < at:
+			result = append(result, num)
+		case num >= at+count:
+			result = append(result, num-count)
+		}
+	}
+
+	return result
+}
+
+func TestInsertDeleteBitsMatchesExpected(t *testing.T) {
+	r := rand.New(rand.NewSource(42))
+	capacity := uint64(s * 8)
+	for i := 0; i < 500; i++ {
+		ba := newBitArray(capacity)
+		sba := newSparseBitArray()
+		for j := 0; j < 40; j++ {
+			k := uint64(r.Int63n(int64(capacity)))
+			ba.SetBit(k)
+			sba.SetBit(k)
+		}
+		nums := ba.ToNums()
+		at := uint64(r.Int63n(int64(capacity)))
+		count := uint64(r.Int63n(int64(s * 3)))
+
+		if i%2 == 0 {
+			ba.InsertBits(at, count)
+			sba.InsertBits(at, count)
+			assert.Equal(t, expectedInsert(nums, at, count, capacity), ba.ToNums())
+			assert.Equal(t, expectedInsert(nums, at, count, ^uint64(0)), sba.ToNums())
+		} else {
+			ba.DeleteBits(at, count)
+			sba.DeleteBits(at, count)
+			assert.Equal(t, expectedDelete(nums, at, count), ba.ToNums())
+			assert.Equal(t, expectedDelete(nums, at, count), sba.ToNums())
+		}
+	}
+}
+
+func TestBitArrayShift(t *testing.T) {
+	ba := newBitArray(s * 2)
+	ba.SetBit(0)
+	ba.SetBit(s - 1)
+	ba.SetBit(s + 5)
+
+	ba.ShiftLeft(3)
+	assert.Equal(t, []uint64{3, s + 2, s + 8}, ba.ToNums())
+	assert.Equal(t, uint64(3), ba.lowest)
+	assert.Equal(t, uint64(s+8), ba.highest)
+
+	ba.ShiftLeft(s - 8)
+	assert.Equal(t, []uint64{s - 5, s*2 - 6}, ba.ToNums())
+
+	ba.ShiftRight(s)
+	assert.Equal(t, []uint64{s - 6}, ba.ToNums())
+
+	ba.ShiftRight(s)
+	assert.Empty(t, ba.ToNums())
+	assert.False(t, ba.anyset)
+}
+
+func TestGrowableBitArrayInsertBits(t *testing.T) {
+	ba := newBitArray(s)
+	ba.growable = true
+	ba.SetBit(1)
+	ba.SetBit(s - 1)
+
+	ba.InsertBits(2, s*2)
+	assert.Equal(t, []uint64{1, s*3 - 1}, ba.ToNums())
+	assert.Equal(t, uint64(s*3), ba.Capacity())
+}
+
+func TestSparseBitArrayShift(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(1)
+	sba.SetBit(s * 100)
+
+	sba.ShiftLeft(s * 2)
+	assert.Equal(t, []uint64{s*2 + 1, s * 102}, sba.ToNums())
+	assert.Equal(t, uintSlice{2, 102}, sba.indices)
+
+	sba.ShiftRight(s*2 + 1)
+	assert.Equal(t, []uint64{0, s*100 - 1}, sba.ToNums())
+
+	sba.ShiftRight(s * 200)
+	assert.Empty(t, sba.ToNums())
+	assert.Len(t, sba.blocks, 0)
+}
+
+func TestSparseBitArrayDeleteToEnd(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(3)
+	sba.SetBit(s * 5)
+
+	sba.DeleteBits(4, ^uint64(0))
+	assert.Equal(t, []uint64{3}, sba.ToNums())
+}
+
+func TestShiftOtherBitArrays(t *testing.T) {
+	cba := newConcurrentBitArray(s * 2)
+	csba := newConcurrentSparseBitArray(3)
+	hba := newHybridBitArray(DefaultSparseThreshold, DefaultDenseThreshold)
+	for _, ba := range []BitArray{cba, csba, hba} {
+		ba.SetRange(0, s-1)
+		ba.InsertBits(5, s)
+	}
+
+	expected := newSparseBitArray()
+	expected.SetRange(0, 4)
+	expected.SetRange(s+5, s*2-1)
+
+	assert.True(t, cba.Equals(expected))
+	assert.True(t, csba.Equals(expected))
+	assert.True(t, hba.Equals(expected))
+
+	hba.InsertBits(0, s*1000)
+	assert.Equal(t, uint64(s*1000), hba.ToNums()[0])
+	assert.True(t, isSparse(hba))
+
+	for _, ba := range []BitArray{cba, csba, hba} {
+		ba.ShiftRight(s)
+	}
+	assert.Equal(t, []uint64{5, 6}, cba.ToNumsBetween(0, 6))
+	assert.Equal(t, []uint64{5, 6}, csba.ToNumsBetween(0, 6))
+	assert.Equal(t, uint64(s*999), hba.ToNums()[0])
+}
+
+func BenchmarkBitArrayInsertBits(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+	for i := uint64(0); i < numItems; i += 3 {
+		ba.SetBit(i)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ba.InsertBits(numItems/2, 7)
+		ba.DeleteBits(numItems/2, 7)
+	}
+}
+
+func BenchmarkSparseBitArrayInsertBits(b *testing.B) {
+	numItems := uint64(160000)
+	sba := newSparseBitArray()
+	for i := uint64(0); i < numItems; i += 300 {
+		sba.SetBit(i)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		sba.InsertBits(numItems/2, 7)
+		sba.DeleteBits(numItems/2, 7)
+	}
+}
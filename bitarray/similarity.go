@@ -0,0 +1,129 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+// mergeBlocks walks the blocks of both bit arrays in index order and
+// calls fn with each pair of blocks sharing an index.  A block missing
+// from one of the bit arrays is passed as zero.  The walk stops early
+// if fn returns false.
+func mergeBlocks(ba, other BitArray, fn func(b, o block) bool) {
+	mergeIterators(ba.Blocks(), other.Blocks(), fn)
+}
+
+// sameBits returns a bool indicating if both bit arrays have the
+// same bits set, whatever their capacities.
+func sameBits(ba, other BitArray) bool {
+	result := true
+	mergeBlocks(ba, other, func(b, o block) bool {
+		result = b == o
+		return result
+	})
+
+	return result
+}
+
+// mergeIterators is mergeBlocks over a pair of block iterators.
+func mergeIterators(self, others Iterator, fn func(b, o block) bool) {
+	selfOk, otherOk := self.Next(), others.Next()
+	for selfOk || otherOk {
+		var selfIndex, otherIndex uint64
+		var selfBlock, otherBlock block
+		if selfOk {
+			selfIndex, selfBlock = self.Value()
+		}
+		if otherOk {
+			otherIndex, otherBlock = others.Value()
+		}
+
+		switch {
+		case !otherOk || (selfOk && selfIndex < otherIndex):
+			if !fn(selfBlock, 0) {
+				return
+			}
+			selfOk = self.Next()
+		case !selfOk || otherIndex < selfIndex:
+			if !fn(0, otherBlock) {
+				return
+			}
+			otherOk = others.Next()
+		default:
+			if !fn(selfBlock, otherBlock) {
+				return
+			}
+			selfOk, otherOk = self.Next(), others.Next()
+		}
+	}
+}
+
+// IsSubsetOf returns a bool indicating if every bit set in ba is
+// also set in other.
+func IsSubsetOf(ba, other BitArray) bool {
+	result := true
+	mergeBlocks(ba, other, func(b, o block) bool {
+		result = b&^o == 0
+		return result
+	})
+
+	return result
+}
+
+// IsSupersetOf returns a bool indicating if every bit set in other
+// is also set in ba.
+func IsSupersetOf(ba, other BitArray) bool {
+	return IsSubsetOf(other, ba)
+}
+
+// IntersectionCount returns the number of bits set in both bit arrays.
+func IntersectionCount(ba, other BitArray) uint64 {
+	count := uint64(0)
+	mergeBlocks(ba, other, func(b, o block) bool {
+		count += (b & o).count()
+		return true
+	})
+
+	return count
+}
+
+// Jaccard returns the Jaccard similarity of the two bit arrays, the
+// number of bits set in both divided by the number of bits set in
+// either.  Two empty bit arrays have a similarity of 1.
+func Jaccard(ba, other BitArray) float64 {
+	intersection, union := uint64(0), uint64(0)
+	mergeBlocks(ba, other, func(b, o block) bool {
+		intersection += (b & o).count()
+		union += (b | o).count()
+		return true
+	})
+
+	if union == 0 {
+		return 1
+	}
+
+	return float64(intersection) / float64(union)
+}
+
+// HammingDistance returns the number of positions at which the two
+// bit arrays differ.
+func HammingDistance(ba, other BitArray) uint64 {
+	count := uint64(0)
+	mergeBlocks(ba, other, func(b, o block) bool {
+		count += (b ^ o).count()
+		return true
+	})
+
+	return count
+}
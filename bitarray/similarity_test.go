@@ -0,0 +1,101 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitarray
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSubsetOf(t *testing.T) {
+	ba := newBitArray(s * 4)
+	sba := newSparseBitArray()
+
+	assert.True(t, IsSubsetOf(ba, sba))
+	assert.True(t, IsSubsetOf(sba, ba))
+
+	sba.SetBit(5)
+	sba.SetBit(s * 3)
+	assert.False(t, IsSubsetOf(sba, ba))
+	assert.True(t, IsSubsetOf(ba, sba))
+
+	ba.SetBit(5)
+	ba.SetBit(s * 3)
+	ba.SetBit(s * 2)
+	assert.True(t, IsSubsetOf(sba, ba))
+	assert.False(t, IsSubsetOf(ba, sba))
+	assert.True(t, IsSupersetOf(ba, sba))
+	assert.False(t, IsSupersetOf(sba, ba))
+
+	sba.SetBit(s * 10)
+	assert.False(t, IsSubsetOf(sba, ba))
+}
+
+func TestIntersectionCount(t *testing.T) {
+	ba := newBitArray(s * 4)
+	sba := newSparseBitArray()
+	assert.Equal(t, uint64(0), IntersectionCount(ba, sba))
+
+	ba.SetRange(0, s*2)
+	sba.SetRange(s, s*3)
+	assert.Equal(t, s+1, IntersectionCount(ba, sba))
+	assert.Equal(t, s+1, IntersectionCount(sba, ba))
+}
+
+func TestJaccard(t *testing.T) {
+	ba := newSparseBitArray()
+	other := newSparseBitArray()
+	assert.Equal(t, float64(1), Jaccard(ba, other))
+
+	ba.SetBit(1)
+	ba.SetBit(2)
+	other.SetBit(2)
+	other.SetBit(s * 5)
+	assert.InDelta(t, 1.0/3.0, Jaccard(ba, other), 1e-9)
+
+	other.ClearBit(2)
+	assert.Equal(t, float64(0), Jaccard(ba, other))
+}
+
+func TestHammingDistance(t *testing.T) {
+	ba := newBitArray(s * 2)
+	sba := newSparseBitArray()
+	assert.Equal(t, uint64(0), HammingDistance(ba, sba))
+
+	ba.SetBit(1)
+	ba.SetBit(s + 1)
+	sba.SetBit(1)
+	sba.SetBit(s * 7)
+	assert.Equal(t, uint64(2), HammingDistance(ba, sba))
+	assert.Equal(t, uint64(2), HammingDistance(sba, ba))
+}
+
+func BenchmarkIntersectionCount(b *testing.B) {
+	numItems := uint64(160000)
+	ba := newBitArray(numItems)
+	other := newBitArray(numItems)
+	for i := uint64(0); i < numItems; i += 3 {
+		ba.SetBit(i)
+		other.SetBit(i + 1)
+	}
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		IntersectionCount(ba, other)
+	}
+}
@@ -143,6 +143,12 @@ func (sba *sparseBitArray) ToNums() []uint64 {
 	return nums
 }
 
+// ToNumsBetween converts this bitarray to the list of numbers
+// contained within it from start to stop, inclusive.
+func (sba *sparseBitArray) ToNumsBetween(start, stop uint64) []uint64 {
+	return toNumsBetween(sba, start, stop)
+}
+
 // ClearBit clears the bit at the given position.
 func (sba *sparseBitArray) ClearBit(k uint64) error {
 	index, position := getIndexAndRemainder(k)
@@ -160,6 +166,234 @@ func (sba *sparseBitArray) ClearBit(k uint64) error {
 	return nil
 }
 
+// applyRange calls op with each block touched by the provided range
+// and the mask of positions in that block falling inside the range.
+// Blocks missing from this array are only materialized if op sets
+// bits on an empty block, and blocks left empty are removed.
+func (sba *sparseBitArray) applyRange(start, stop uint64, op func(b, mask block) block) {
+	startIndex, _ := getIndexAndRemainder(start)
+	sba.applyStridedRange(start, stop, startIndex, 1, op)
+}
+
+// applyStridedRange is applyRange restricted to the block indices
+// first, first+stride, first+2*stride and so on.  Every block already
+// stored in this array must fall on the stride.
+func (sba *sparseBitArray) applyStridedRange(start, stop, first, stride uint64,
+	op func(b, mask block) block) {
+
+	startIndex, _ := getIndexAndRemainder(start)
+	stopIndex, _ := getIndexAndRemainder(stop)
+	if start > stop || first > stopIndex {
+		return
+	}
+
+	lo := sba.indices.search(startIndex)
+	hi := lo + uintSlice(sba.indices[lo:]).search(stopIndex+1)
+
+	if op(0, ^block(0)) == 0 {
+		// only existing blocks can be affected, compact in place
+		j := lo
+		for i := lo; i < hi; i++ {
+			index := sba.indices[i]
+			b := op(sba.blocks[i], blockRangeMask(index, start, stop))
+			if b == 0 {
+				continue
+			}
+			sba.indices[j], sba.blocks[j] = index, b
+			j++
+		}
+
+		if j < hi {
+			sba.indices = append(sba.indices[:j], sba.indices[hi:]...)
+			sba.blocks = append(sba.blocks[:j], sba.blocks[hi:]...)
+		}
+		return
+	}
+
+	size := int64(len(sba.indices)) - (hi - lo) + int64((stopIndex-first)/stride+1)
+	indices := make(uintSlice, 0, size)
+	blocks := make(blocks, 0, size)
+	indices = append(indices, sba.indices[:lo]...)
+	blocks = append(blocks, sba.blocks[:lo]...)
+
+	j := lo
+	for index := first; index <= stopIndex; index += stride {
+		var b block
+		if j < hi && sba.indices[j] == index {
+			b = sba.blocks[j]
+			j++
+		}
+
+		if b = op(b, blockRangeMask(index, start, stop)); b != 0 {
+			indices = append(indices, index)
+			blocks = append(blocks, b)
+		}
+	}
+
+	sba.indices = append(indices, sba.indices[hi:]...)
+	sba.blocks = append(blocks, sba.blocks[hi:]...)
+}
+
+// SetRange sets every bit from start to stop, inclusive.
+func (sba *sparseBitArray) SetRange(start, stop uint64) error {
+	sba.applyRange(start, stop, func(b, mask block) block {
+		return b | mask
+	})
+	return nil
+}
+
+// ClearRange clears every bit from start to stop, inclusive.
+func (sba *sparseBitArray) ClearRange(start, stop uint64) error {
+	sba.applyRange(start, stop, func(b, mask block) block {
+		return b &^ mask
+	})
+	return nil
+}
+
+// FlipRange flips every bit from start to stop, inclusive.
+func (sba *sparseBitArray) FlipRange(start, stop uint64) error {
+	sba.applyRange(start, stop, func(b, mask block) block {
+		return b ^ mask
+	})
+	return nil
+}
+
+// CountRange returns the number of set bits from start to stop,
+// inclusive.
+func (sba *sparseBitArray) CountRange(start, stop uint64) uint64 {
+	if start > stop {
+		return 0
+	}
+
+	startIndex, _ := getIndexAndRemainder(start)
+	stopIndex, _ := getIndexAndRemainder(stop)
+	count := uint64(0)
+	for i := sba.indices.search(startIndex); i < int64(len(sba.indices)); i++ {
+		index := sba.indices[i]
+		if index > stopIndex {
+			break
+		}
+		count += (sba.blocks[i] & blockRangeMask(index, start, stop)).count()
+	}
+
+	return count
+}
+
+// appendBlock appends the block at the given index, merging it with
+// the last block if that shares its index.  Blocks must be appended
+// in index order and empty blocks are skipped.
+func (sba *sparseBitArray) appendBlock(index uint64, b block) {
+	if b == 0 {
+		return
+	}
+
+	last := len(sba.indices) - 1
+	if last >= 0 && sba.indices[last] == index {
+		sba.blocks[last] |= b
+		return
+	}
+
+	sba.indices = append(sba.indices, index)
+	sba.blocks = append(sba.blocks, b)
+}
+
+// ShiftLeft moves every bit n positions higher.  Bits moved past the
+// highest possible position are dropped.
+func (sba *sparseBitArray) ShiftLeft(n uint64) {
+	sba.InsertBits(0, n)
+}
+
+// ShiftRight moves every bit n positions lower, dropping the bits
+// below n.
+func (sba *sparseBitArray) ShiftRight(n uint64) {
+	sba.DeleteBits(0, n)
+}
+
+// InsertBits moves every bit at or above the provided position count
+// positions higher, leaving the inserted positions unset.  Only the
+// indices of the blocks above the position are rewritten when count
+// is a multiple of the block size.
+func (sba *sparseBitArray) InsertBits(at, count uint64) {
+	if count == 0 {
+		return
+	}
+
+	atIndex, atPos := getIndexAndRemainder(at)
+	q, r := getIndexAndRemainder(count)
+	result := &sparseBitArray{
+		indices: make(uintSlice, 0, len(sba.indices)+1),
+		blocks:  make(blocks, 0, len(sba.blocks)+1),
+	}
+	for i, index := range sba.indices {
+		b := sba.blocks[i]
+		if index < atIndex {
+			result.appendBlock(index, b)
+			continue
+		}
+
+		if index == atIndex {
+			result.appendBlock(index, b&lowMask(atPos))
+			b &^= lowMask(atPos)
+		}
+
+		// anything moved past the highest position is dropped
+		if index+q <= maxIndex {
+			result.appendBlock(index+q, b<<r)
+		}
+		if index+q+1 <= maxIndex {
+			result.appendBlock(index+q+1, b>>(s-r))
+		}
+	}
+
+	*sba = *result
+}
+
+// DeleteBits removes the count bits starting at the provided position
+// and moves every bit above them count positions lower.
+func (sba *sparseBitArray) DeleteBits(at, count uint64) {
+	if count == 0 {
+		return
+	}
+
+	atIndex, atPos := getIndexAndRemainder(at)
+	q, r := getIndexAndRemainder(count)
+	end := at + count
+	truncate := end < at
+	endIndex, endPos := getIndexAndRemainder(end)
+	result := &sparseBitArray{
+		indices: make(uintSlice, 0, len(sba.indices)),
+		blocks:  make(blocks, 0, len(sba.blocks)),
+	}
+	for i, index := range sba.indices {
+		b := sba.blocks[i]
+		if index < atIndex {
+			result.appendBlock(index, b)
+			continue
+		}
+
+		if index == atIndex {
+			result.appendBlock(index, b&lowMask(atPos))
+		}
+
+		// drop everything below the end of the deleted bits
+		if truncate || index < endIndex {
+			continue
+		}
+		if index == endIndex {
+			b &^= lowMask(endPos)
+		}
+
+		// every remaining bit is at or above the end of the deleted
+		// bits so nothing moves below the provided position
+		if index-q > 0 {
+			result.appendBlock(index-q-1, b<<(s-r))
+		}
+		result.appendBlock(index-q, b>>r)
+	}
+
+	*sba = *result
+}
+
 // Reset erases all values from this bitarray.
 func (sba *sparseBitArray) Reset() {
 	sba.blocks = sba.blocks[:0]
@@ -171,6 +405,51 @@ func (sba *sparseBitArray) Blocks() Iterator {
 	return newCompressedBitArrayIterator(sba)
 }
 
+// Bits returns an iterator over the set bits in this bitarray.
+func (sba *sparseBitArray) Bits() BitIterator {
+	return newBitIterator(sba.Blocks())
+}
+
+// NextSetBit returns the position of the first set bit at or after
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (sba *sparseBitArray) NextSetBit(from uint64) (uint64, bool) {
+	index, position := getIndexAndRemainder(from)
+	i := sba.indices.search(index)
+	if i < int64(len(sba.indices)) && sba.indices[i] == index {
+		if position = sba.blocks[i].nextSetPosition(position); position < s {
+			return index*s + position, true
+		}
+		i++
+	}
+
+	if i == int64(len(sba.indices)) {
+		return 0, false
+	}
+
+	return sba.indices[i]*s + sba.blocks[i].findRightPosition(), true
+}
+
+// PrevSetBit returns the position of the last set bit at or before
+// the provided position.  The returned bool is false if no such bit
+// exists.
+func (sba *sparseBitArray) PrevSetBit(from uint64) (uint64, bool) {
+	index, position := getIndexAndRemainder(from)
+	i := sba.indices.search(index)
+	if i < int64(len(sba.indices)) && sba.indices[i] == index {
+		if position = sba.blocks[i].prevSetPosition(position); position < s {
+			return index*s + position, true
+		}
+	}
+
+	if i == 0 {
+		return 0, false
+	}
+
+	i--
+	return sba.indices[i]*s + sba.blocks[i].findLeftPosition(), true
+}
+
 // Capacity returns the value of the highest possible *seen* value
 // in this sparse bitarray.
 func (sba *sparseBitArray) Capacity() uint64 {
@@ -227,11 +506,14 @@ func (sba *sparseBitArray) Equals(other BitArray) bool {
 // Or will perform a bitwise or operation with the provided bitarray and
 // return a new result bitarray.
 func (sba *sparseBitArray) Or(other BitArray) BitArray {
-	if ba, ok := other.(*sparseBitArray); ok {
-		return orSparseWithSparseBitArray(sba, ba)
+	switch cba := concrete(other).(type) {
+	case *sparseBitArray:
+		return orSparseWithSparseBitArray(sba, cba)
+	case *bitArray:
+		return orSparseWithDenseBitArray(sba, cba)
 	}
 
-	return orSparseWithDenseBitArray(sba, other.(*bitArray))
+	return OrAll(sba, other)
 }
 
 func (sba *sparseBitArray) copy() *sparseBitArray {
@@ -282,8 +564,18 @@ func (sba *sparseBitArray) Intersects(other BitArray) bool {
 	return true
 }
 
+// IntersectsBetween returns a bool indicating if every bit set in the
+// provided bitarray from start to stop, inclusive, is also set in
+// this bitarray.
 func (sba *sparseBitArray) IntersectsBetween(other BitArray, start, stop uint64) bool {
-	return true
+	return intersectsBetween(sba, other, start, stop)
+}
+
+// EqualsBetween returns a bool indicating if this bitarray and the
+// provided bitarray have the same bits set from start to stop,
+// inclusive.
+func (sba *sparseBitArray) EqualsBetween(other BitArray, start, stop uint64) bool {
+	return equalsBetween(sba, other, start, stop)
 }
 
 func newSparseBitArray() *sparseBitArray {
@@ -308,3 +308,171 @@ func BenchmarkSparseBitArrayToNums(b *testing.B) {
 		sba.ToNums()
 	}
 }
+
+func TestSparseBitArrayNextSetBit(t *testing.T) {
+	sba := newSparseBitArray()
+
+	_, ok := sba.NextSetBit(0)
+	assert.False(t, ok)
+
+	sba.SetBit(5)
+	sba.SetBit(s + 1)
+	sba.SetBit(s * 3)
+
+	result, ok := sba.NextSetBit(0)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), result)
+
+	result, ok = sba.NextSetBit(6)
+	assert.True(t, ok)
+	assert.Equal(t, s+1, result)
+
+	result, ok = sba.NextSetBit(s + 2)
+	assert.True(t, ok)
+	assert.Equal(t, s*3, result)
+
+	_, ok = sba.NextSetBit(s*3 + 1)
+	assert.False(t, ok)
+}
+
+func TestSparseBitArrayPrevSetBit(t *testing.T) {
+	sba := newSparseBitArray()
+
+	_, ok := sba.PrevSetBit(s)
+	assert.False(t, ok)
+
+	sba.SetBit(5)
+	sba.SetBit(s + 1)
+	sba.SetBit(s * 3)
+
+	result, ok := sba.PrevSetBit(s * 10)
+	assert.True(t, ok)
+	assert.Equal(t, s*3, result)
+
+	result, ok = sba.PrevSetBit(s*3 - 1)
+	assert.True(t, ok)
+	assert.Equal(t, s+1, result)
+
+	result, ok = sba.PrevSetBit(s)
+	assert.True(t, ok)
+	assert.Equal(t, uint64(5), result)
+
+	_, ok = sba.PrevSetBit(4)
+	assert.False(t, ok)
+}
+
+func TestSparseBitArrayBits(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(0)
+	sba.SetBit(s - 1)
+	sba.SetBit(s * 20)
+
+	result := make([]uint64, 0, 3)
+	for iter := sba.Bits(); iter.Next(); {
+		result = append(result, iter.Value())
+	}
+
+	assert.Equal(t, []uint64{0, s - 1, s * 20}, result)
+}
+
+func TestSparseBitArraySetRange(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(s * 10)
+
+	sba.SetRange(s-2, s*2+1)
+	assert.Equal(t, uintSlice{0, 1, 2, 10}, sba.indices)
+	assert.Equal(t, s+5, sba.CountRange(0, s*20))
+
+	ok, _ := sba.GetBit(s - 3)
+	assert.False(t, ok)
+	ok, _ = sba.GetBit(s + 5)
+	assert.True(t, ok)
+	ok, _ = sba.GetBit(s*2 + 2)
+	assert.False(t, ok)
+}
+
+func TestSparseBitArrayClearRange(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetRange(0, s*4-1)
+	sba.SetBit(s * 10)
+
+	sba.ClearRange(s-1, s*3)
+	assert.Equal(t, uintSlice{0, 3, 10}, sba.indices)
+	assert.Len(t, sba.blocks, 3)
+	assert.Equal(t, s*2-1, sba.CountRange(0, s*20))
+
+	sba.ClearRange(0, s*20)
+	assert.Len(t, sba.indices, 0)
+	assert.Len(t, sba.blocks, 0)
+}
+
+func TestSparseBitArrayFlipRange(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(3)
+
+	sba.FlipRange(2, s)
+	assert.Equal(t, s-2, sba.CountRange(0, s*2))
+
+	ok, _ := sba.GetBit(3)
+	assert.False(t, ok)
+
+	sba.FlipRange(2, s)
+	assert.Equal(t, []uint64{3}, sba.ToNums())
+	assert.Equal(t, uintSlice{0}, sba.indices)
+}
+
+func BenchmarkSparseBitArraySetRange(b *testing.B) {
+	numItems := uint64(160000)
+
+	for i := 0; i < b.N; i++ {
+		sba := newSparseBitArray()
+		sba.SetRange(1, numItems-2)
+	}
+}
+
+func TestSparseBitArrayIntersectsBetween(t *testing.T) {
+	sba := newSparseBitArray()
+	other := newSparseBitArray()
+
+	sba.SetBit(5)
+	sba.SetBit(s * 10)
+	other.SetBit(5)
+	other.SetBit(s*10 + 1)
+
+	assert.True(t, sba.IntersectsBetween(other, 0, s*10))
+	assert.False(t, sba.IntersectsBetween(other, 0, s*10+1))
+	assert.True(t, sba.IntersectsBetween(other, s*10+2, s*20))
+	assert.True(t, sba.IntersectsBetween(other, 10, 5))
+
+	ba := newBitArray(s * 2)
+	ba.SetBit(s + 1)
+	assert.True(t, sba.IntersectsBetween(ba, 0, s))
+	assert.False(t, sba.IntersectsBetween(ba, 0, s+1))
+}
+
+func TestSparseBitArrayEqualsBetween(t *testing.T) {
+	sba := newSparseBitArray()
+	other := newSparseBitArray()
+
+	sba.SetBit(5)
+	sba.SetBit(s * 10)
+	other.SetBit(5)
+	other.SetBit(s * 20)
+
+	assert.True(t, sba.EqualsBetween(other, 0, s*10-1))
+	assert.False(t, sba.EqualsBetween(other, 0, s*10))
+	assert.False(t, other.EqualsBetween(sba, s*10, s*20))
+	assert.True(t, sba.EqualsBetween(other, s*10+1, s*20-1))
+}
+
+func TestSparseBitArrayToNumsBetween(t *testing.T) {
+	sba := newSparseBitArray()
+	sba.SetBit(5)
+	sba.SetBit(s * 10)
+	sba.SetBit(s*10 + 3)
+	sba.SetBit(s * 20)
+
+	assert.Equal(t, []uint64{s * 10, s*10 + 3}, sba.ToNumsBetween(6, s*20-1))
+	assert.Equal(t, []uint64{5}, sba.ToNumsBetween(0, s))
+	assert.Empty(t, sba.ToNumsBetween(s*10+4, s*20-1))
+}
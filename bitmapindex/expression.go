@@ -0,0 +1,113 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitmapindex
+
+import "github.com/Workiva/go-datastructures/bitarray"
+
+// Expression is a boolean query over the index.  Expressions are built
+// with Eq, And, Or and Not and compile down to bitarray operations.
+type Expression interface {
+	// evaluate returns the bitarray of records matching this
+	// expression.  The result may be one of the index's own
+	// bitmaps and must not be modified.
+	evaluate(idx *Index) bitarray.BitArray
+}
+
+type eq struct {
+	attribute string
+	value     interface{}
+}
+
+func (e *eq) evaluate(idx *Index) bitarray.BitArray {
+	return idx.lookup(e.attribute, e.value)
+}
+
+type and struct {
+	exprs []Expression
+}
+
+// evaluate intersects the positive expressions in a single pass and
+// then subtracts the negated ones, so only a conjunction made
+// entirely of negations needs the set of all records.
+func (a *and) evaluate(idx *Index) bitarray.BitArray {
+	positives := make([]bitarray.BitArray, 0, len(a.exprs))
+	negatives := make([]bitarray.BitArray, 0, len(a.exprs))
+	for _, expr := range a.exprs {
+		if n, ok := expr.(*not); ok {
+			negatives = append(negatives, n.expr.evaluate(idx))
+			continue
+		}
+		positives = append(positives, expr.evaluate(idx))
+	}
+
+	var result bitarray.BitArray
+	if len(positives) == 0 {
+		result = idx.all
+	} else {
+		result = bitarray.AndAll(positives...)
+	}
+
+	if len(negatives) > 0 {
+		result = bitarray.AndNot(result, bitarray.OrAll(negatives...))
+	}
+
+	return result
+}
+
+type or struct {
+	exprs []Expression
+}
+
+func (o *or) evaluate(idx *Index) bitarray.BitArray {
+	results := make([]bitarray.BitArray, 0, len(o.exprs))
+	for _, expr := range o.exprs {
+		results = append(results, expr.evaluate(idx))
+	}
+
+	return bitarray.OrAll(results...)
+}
+
+type not struct {
+	expr Expression
+}
+
+func (n *not) evaluate(idx *Index) bitarray.BitArray {
+	return bitarray.AndNot(idx.all, n.expr.evaluate(idx))
+}
+
+// Eq matches the records whose attribute has the given value.
+func Eq(attribute string, value interface{}) Expression {
+	return &eq{attribute: attribute, value: value}
+}
+
+// And matches the records matching every provided expression.  An
+// empty And matches every record.
+func And(exprs ...Expression) Expression {
+	return &and{exprs: exprs}
+}
+
+// Or matches the records matching any provided expression.  An empty
+// Or matches no records.
+func Or(exprs ...Expression) Expression {
+	return &or{exprs: exprs}
+}
+
+// Not matches the records in the index that do not match the
+// provided expression.
+func Not(expr Expression) Expression {
+	return &not{expr: expr}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package bitmapindex is a bitmap index over records identified by a
+uint64.  Each (attribute, value) pair maps to a bitarray of the
+records having that value, so filtering records by several categorical
+attributes becomes a handful of bitwise operations.  Queries are built
+from Eq predicates combined with And, Or and Not, and the index is
+updated incrementally as records are inserted and deleted.  The index
+is threadsafe.
+*/
+package bitmapindex
+
+import (
+	"sync"
+
+	"github.com/Workiva/go-datastructures/bitarray"
+)
+
+type key struct {
+	attribute string
+	value     interface{}
+}
+
+// Index maps (attribute, value) pairs to the records having that value.
+type Index struct {
+	lock    sync.RWMutex
+	bitmaps map[key]bitarray.BitArray
+	records map[uint64]map[string]interface{}
+	// all tracks every record in the index so negations have
+	// something to subtract from.
+	all bitarray.BitArray
+}
+
+// Insert adds the record with the given id and attribute values to
+// the index, replacing any record already inserted with that id.
+// Attribute values must be comparable.
+func (idx *Index) Insert(id uint64, attributes map[string]interface{}) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.delete(id)
+
+	record := make(map[string]interface{}, len(attributes))
+	for attribute, value := range attributes {
+		record[attribute] = value
+		k := key{attribute: attribute, value: value}
+		bm, ok := idx.bitmaps[k]
+		if !ok {
+			bm = bitarray.NewHybridBitArray()
+			idx.bitmaps[k] = bm
+		}
+		bm.SetBit(id)
+	}
+
+	idx.records[id] = record
+	idx.all.SetBit(id)
+}
+
+// Delete removes the record with the given id from the index.
+func (idx *Index) Delete(id uint64) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+
+	idx.delete(id)
+}
+
+func (idx *Index) delete(id uint64) {
+	record, ok := idx.records[id]
+	if !ok {
+		return
+	}
+
+	for attribute, value := range record {
+		k := key{attribute: attribute, value: value}
+		bm := idx.bitmaps[k]
+		bm.ClearBit(id)
+		if _, ok := bm.NextSetBit(0); !ok {
+			delete(idx.bitmaps, k)
+		}
+	}
+
+	delete(idx.records, id)
+	idx.all.ClearBit(id)
+}
+
+// Len returns the number of records in the index.
+func (idx *Index) Len() int {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	return len(idx.records)
+}
+
+// Query returns a new bitarray of the ids of the records matching
+// the provided expression.
+func (idx *Index) Query(expr Expression) bitarray.BitArray {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+
+	result := expr.evaluate(idx)
+	if _, ok := expr.(*eq); ok || result == idx.all {
+		// this is one of our own bitmaps, don't hand it out
+		result = bitarray.OrAll(result)
+	}
+
+	return result
+}
+
+// lookup returns the bitmap for the given pair or an empty bitarray
+// if no record has that value.
+func (idx *Index) lookup(attribute string, value interface{}) bitarray.BitArray {
+	if bm, ok := idx.bitmaps[key{attribute: attribute, value: value}]; ok {
+		return bm
+	}
+
+	return bitarray.NewSparseBitArray()
+}
+
+// New is the constructor for an empty bitmap index.
+func New() *Index {
+	return &Index{
+		bitmaps: make(map[key]bitarray.BitArray),
+		records: make(map[uint64]map[string]interface{}),
+		all:     bitarray.NewHybridBitArray(),
+	}
+}
@@ -0,0 +1,164 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bitmapindex
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func record(color, size string) map[string]interface{} {
+	return map[string]interface{}{
+		"color": color,
+		"size":  size,
+	}
+}
+
+func newTestIndex() *Index {
+	idx := New()
+	idx.Insert(0, record("red", "small"))
+	idx.Insert(1, record("blue", "small"))
+	idx.Insert(2, record("red", "large"))
+	idx.Insert(3, record("green", "large"))
+	idx.Insert(200, record("red", "small"))
+	return idx
+}
+
+func TestEq(t *testing.T) {
+	idx := newTestIndex()
+
+	assert.Equal(t, []uint64{0, 2, 200}, idx.Query(Eq("color", "red")).ToNums())
+	assert.Equal(t, []uint64{2, 3}, idx.Query(Eq("size", "large")).ToNums())
+	assert.Empty(t, idx.Query(Eq("color", "purple")).ToNums())
+	assert.Empty(t, idx.Query(Eq("shape", "round")).ToNums())
+}
+
+func TestQueryDoesNotAlias(t *testing.T) {
+	idx := newTestIndex()
+
+	result := idx.Query(Eq("color", "red"))
+	result.SetBit(1)
+	assert.Equal(t, []uint64{0, 2, 200}, idx.Query(Eq("color", "red")).ToNums())
+
+	result = idx.Query(And())
+	result.SetBit(50)
+	assert.Equal(t, []uint64{0, 1, 2, 3, 200}, idx.Query(And()).ToNums())
+}
+
+func TestAnd(t *testing.T) {
+	idx := newTestIndex()
+
+	result := idx.Query(And(Eq("color", "red"), Eq("size", "small")))
+	assert.Equal(t, []uint64{0, 200}, result.ToNums())
+
+	result = idx.Query(And(Eq("color", "red"), Not(Eq("size", "small"))))
+	assert.Equal(t, []uint64{2}, result.ToNums())
+
+	result = idx.Query(And(Not(Eq("color", "red")), Not(Eq("size", "small"))))
+	assert.Equal(t, []uint64{3}, result.ToNums())
+
+	result = idx.Query(And(Eq("color", "red"), Eq("color", "blue")))
+	assert.Empty(t, result.ToNums())
+
+	assert.Equal(t, []uint64{0, 1, 2, 3, 200}, idx.Query(And()).ToNums())
+}
+
+func TestOr(t *testing.T) {
+	idx := newTestIndex()
+
+	result := idx.Query(Or(Eq("color", "blue"), Eq("color", "green")))
+	assert.Equal(t, []uint64{1, 3}, result.ToNums())
+
+	result = idx.Query(Or(Eq("color", "green"), And(Eq("color", "red"), Eq("size", "large"))))
+	assert.Equal(t, []uint64{2, 3}, result.ToNums())
+
+	assert.Empty(t, idx.Query(Or()).ToNums())
+}
+
+func TestNot(t *testing.T) {
+	idx := newTestIndex()
+
+	assert.Equal(t, []uint64{1, 3}, idx.Query(Not(Eq("color", "red"))).ToNums())
+	assert.Equal(t, []uint64{0, 1, 2, 3, 200}, idx.Query(Not(Eq("color", "purple"))).ToNums())
+
+	result := idx.Query(Not(Or(Eq("color", "red"), Eq("size", "large"))))
+	assert.Equal(t, []uint64{1}, result.ToNums())
+}
+
+func TestInsertReplaces(t *testing.T) {
+	idx := newTestIndex()
+
+	idx.Insert(3, record("red", "small"))
+
+	assert.Equal(t, 5, idx.Len())
+	assert.Empty(t, idx.Query(Eq("color", "green")).ToNums())
+	assert.Equal(t, []uint64{0, 2, 3, 200}, idx.Query(Eq("color", "red")).ToNums())
+	assert.Equal(t, []uint64{2}, idx.Query(Eq("size", "large")).ToNums())
+}
+
+func TestInsertCopiesAttributes(t *testing.T) {
+	idx := New()
+	attributes := record("red", "small")
+	idx.Insert(1, attributes)
+	attributes["color"] = "blue"
+
+	idx.Delete(1)
+	assert.Equal(t, 0, idx.Len())
+	assert.Empty(t, idx.bitmaps)
+}
+
+func TestDelete(t *testing.T) {
+	idx := newTestIndex()
+
+	idx.Delete(3)
+	idx.Delete(3)
+	idx.Delete(100)
+
+	assert.Equal(t, 4, idx.Len())
+	assert.Empty(t, idx.Query(Eq("color", "green")).ToNums())
+	assert.Equal(t, []uint64{2}, idx.Query(Eq("size", "large")).ToNums())
+	assert.Equal(t, []uint64{0, 1, 200}, idx.Query(Not(Eq("size", "large"))).ToNums())
+	_, ok := idx.bitmaps[key{attribute: "color", value: "green"}]
+	assert.False(t, ok)
+}
+
+func TestNonStringValues(t *testing.T) {
+	idx := New()
+	idx.Insert(1, map[string]interface{}{"age": 30, "active": true})
+	idx.Insert(2, map[string]interface{}{"age": 40, "active": true})
+
+	assert.Equal(t, []uint64{1}, idx.Query(Eq("age", 30)).ToNums())
+	assert.Equal(t, []uint64{1, 2}, idx.Query(Eq("active", true)).ToNums())
+	assert.Empty(t, idx.Query(Eq("age", "30")).ToNums())
+}
+
+func BenchmarkQuery(b *testing.B) {
+	numItems := 100000
+	idx := New()
+	for i := 0; i < numItems; i++ {
+		idx.Insert(uint64(i), record(fmt.Sprintf("%d", i%7), fmt.Sprintf("%d", i%3)))
+	}
+	expr := And(Eq("color", "1"), Not(Eq("size", "2")))
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		idx.Query(expr)
+	}
+}
@@ -0,0 +1,266 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package bloom includes a Bloom filter and a counting Bloom filter.
+These are useful for probabilistic existence checks of arbitrary
+keys where a bitarray would require every entity to have a uint64
+identifier.  A filter never reports that an added key is missing but
+may report that a missing key exists at the configured false positive
+rate.  The Bloom filter is backed by a dense bitarray.  This is *NOT*
+a threadsafe package.
+*/
+package bloom
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+
+	"github.com/Workiva/go-datastructures/bitarray"
+)
+
+// headerSize is the number of bytes used to encode the size and
+// number of hashes of a filter.
+const headerSize = 16
+
+// MinFalsePositiveRate is the smallest false positive rate Optimal
+// sizes a filter for.  Lower rates, including zero and negative rates,
+// are raised to it as no finite filter can guarantee them.
+const MinFalsePositiveRate = 1e-12
+
+// MaxSize is the largest number of bits, or counters, in a filter.
+// Optimal and the constructors cap sizes at it, so a filter for a huge
+// number of items or a tiny false positive rate has a higher false
+// positive rate instead of being too large to allocate.  It matches the
+// largest dense bitarray the bitarray package will decode.
+const MaxSize = bitarray.MaxDenseCapacity
+
+const (
+	// bitsHeaderSize is the number of bytes in the header of a
+	// bitarray encoding.
+	bitsHeaderSize = 17
+	// denseKind is the first byte of a dense bitarray encoding.
+	denseKind = byte(0)
+)
+
+// Optimal returns the number of bits and number of hashes a filter
+// needs to hold the expected number of items at the given false
+// positive rate.  An expected number of items of zero is treated as
+// one and a rate below MinFalsePositiveRate, or one that is not a
+// number, is treated as MinFalsePositiveRate.  A rate of one or more
+// needs only a single bit and hash.  The number of bits is capped at
+// MaxSize.
+func Optimal(expectedItems uint64, falsePositiveRate float64) (uint64, uint64) {
+	if expectedItems < 1 {
+		expectedItems = 1
+	}
+	if !(falsePositiveRate >= MinFalsePositiveRate) {
+		falsePositiveRate = MinFalsePositiveRate
+	}
+	if falsePositiveRate >= 1 {
+		return 1, 1
+	}
+
+	n := float64(expectedItems)
+	m := math.Ceil(-n * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	if m < 1 {
+		m = 1
+	}
+	if m > float64(MaxSize) {
+		m = float64(MaxSize)
+	}
+
+	k := math.Floor(m / n * math.Ln2)
+	if k < 1 {
+		k = 1
+	}
+
+	return uint64(m), uint64(k)
+}
+
+// positions returns the k positions in a filter of m bits that the
+// provided key hashes to.  This uses double hashing over the two halves
+// of a 128 bit FNV-1a hash.
+func positions(key []byte, m, k uint64) []uint64 {
+	hasher := fnv.New128a()
+	hasher.Write(key)
+	sum := hasher.Sum(nil)
+	h1 := binary.BigEndian.Uint64(sum[:8])
+	// an even, and in particular a zero, step would visit fewer
+	// than k distinct positions in a filter whose size is a power of
+	// two
+	h2 := binary.BigEndian.Uint64(sum[8:]) | 1
+
+	result := make([]uint64, k)
+	for i := uint64(0); i < k; i++ {
+		result[i] = (h1 + i*h2) % m
+	}
+
+	return result
+}
+
+func encodeHeader(m, k uint64, size int) []byte {
+	output := make([]byte, headerSize, headerSize+size)
+	binary.LittleEndian.PutUint64(output, m)
+	binary.LittleEndian.PutUint64(output[8:], k)
+	return output
+}
+
+func decodeHeader(input []byte) (uint64, uint64, error) {
+	if len(input) < headerSize {
+		return 0, 0, InvalidEncodingError(`header is truncated`)
+	}
+
+	m := binary.LittleEndian.Uint64(input)
+	k := binary.LittleEndian.Uint64(input[8:])
+	if m == 0 || k == 0 {
+		return 0, 0, InvalidEncodingError(`size and hashes must be positive`)
+	}
+	if m > MaxSize {
+		return 0, 0, InvalidEncodingError(`size exceeds MaxSize`)
+	}
+	if k > m {
+		return 0, 0, InvalidEncodingError(`hashes exceed size`)
+	}
+
+	return m, k, nil
+}
+
+// Bloom is a Bloom filter backed by a dense bitarray.
+type Bloom struct {
+	bits bitarray.BitArray
+	m    uint64
+	k    uint64
+}
+
+// Add adds the provided key to the filter.
+func (b *Bloom) Add(key []byte) {
+	for _, position := range positions(key, b.m, b.k) {
+		b.bits.SetBit(position)
+	}
+}
+
+// Exists returns a bool indicating if the provided key may have been
+// added to this filter.  False positives are possible but false
+// negatives are not.
+func (b *Bloom) Exists(key []byte) bool {
+	for _, position := range positions(key, b.m, b.k) {
+		if ok, _ := b.bits.GetBit(position); !ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Size returns the number of bits in this filter.
+func (b *Bloom) Size() uint64 {
+	return b.m
+}
+
+// Hashes returns the number of hashes used per key.
+func (b *Bloom) Hashes() uint64 {
+	return b.k
+}
+
+// Reset removes all keys from this filter.
+func (b *Bloom) Reset() {
+	b.bits.Reset()
+}
+
+// Union returns a new filter that reports every key added to either
+// filter.  The filters must have the same size and number of hashes.
+func (b *Bloom) Union(other *Bloom) (*Bloom, error) {
+	if b.m != other.m || b.k != other.k {
+		return nil, IncompatibleError{}
+	}
+
+	return &Bloom{
+		bits: b.bits.Or(other.bits),
+		m:    b.m,
+		k:    b.k,
+	}, nil
+}
+
+// MarshalBinary encodes this filter as its size and number of hashes,
+// each a little-endian uint64, followed by the encoding of its bitarray.
+func (b *Bloom) MarshalBinary() ([]byte, error) {
+	encoded, err := b.bits.MarshalBinary()
+	if err != nil {
+		return nil, err
+	}
+
+	return append(encodeHeader(b.m, b.k, len(encoded)), encoded...), nil
+}
+
+// UnmarshalBinary replaces this filter with the provided encoding.
+// The bitarray must use the dense encoding and its length must match
+// the size in the header, which is checked before it is decoded so
+// nothing larger than the encoding itself is allocated.
+func (b *Bloom) UnmarshalBinary(input []byte) error {
+	m, k, err := decodeHeader(input)
+	if err != nil {
+		return err
+	}
+
+	encoded := input[headerSize:]
+	numBlocks := (m + 63) / 64
+	if len(encoded) < bitsHeaderSize || encoded[0] != denseKind ||
+		uint64(len(encoded)-bitsHeaderSize) != numBlocks*8 {
+		return InvalidEncodingError(`size does not match bitarray`)
+	}
+
+	bits := bitarray.NewBitArray(0)
+	if err := bits.UnmarshalBinary(encoded); err != nil {
+		return err
+	}
+
+	// a filter's bitarray holds just enough blocks for its size
+	if bits.Capacity() < m || bits.Capacity()-m >= 64 {
+		return InvalidEncodingError(`size does not match bitarray`)
+	}
+
+	b.bits, b.m, b.k = bits, m, k
+	return nil
+}
+
+// New returns a Bloom filter sized to hold the expected number of
+// items at the given false positive rate.
+func New(expectedItems uint64, falsePositiveRate float64) *Bloom {
+	m, k := Optimal(expectedItems, falsePositiveRate)
+	return NewWithSize(m, k)
+}
+
+// NewWithSize returns a Bloom filter of m bits that sets k bits
+// per key.  m is capped at MaxSize.
+func NewWithSize(m, k uint64) *Bloom {
+	if m < 1 {
+		m = 1
+	}
+	if m > MaxSize {
+		m = MaxSize
+	}
+	if k < 1 {
+		k = 1
+	}
+
+	return &Bloom{
+		bits: bitarray.NewBitArray(m),
+		m:    m,
+		k:    k,
+	}
+}
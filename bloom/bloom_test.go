@@ -0,0 +1,168 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bloom
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/Workiva/go-datastructures/bitarray"
+)
+
+func TestOptimal(t *testing.T) {
+	m, k := Optimal(1000, 0.01)
+	assert.Equal(t, uint64(9586), m)
+	assert.Equal(t, uint64(6), k)
+
+	m, k = Optimal(0, 0.5)
+	assert.True(t, m >= 1)
+	assert.Equal(t, uint64(1), k)
+}
+
+func TestOptimalInvalidRate(t *testing.T) {
+	minM, minK := Optimal(1000, MinFalsePositiveRate)
+	for _, rate := range []float64{0, -1, math.NaN(), math.Inf(-1), MinFalsePositiveRate / 2} {
+		m, k := Optimal(1000, rate)
+		assert.Equal(t, minM, m)
+		assert.Equal(t, minK, k)
+	}
+
+	for _, rate := range []float64{1, 2, math.Inf(1)} {
+		m, k := Optimal(1000, rate)
+		assert.Equal(t, uint64(1), m)
+		assert.Equal(t, uint64(1), k)
+	}
+
+	m, k := Optimal(math.MaxUint64, 0.01)
+	assert.Equal(t, MaxSize, m)
+	assert.True(t, k >= 1)
+
+	m, _ = Optimal(1<<32, MinFalsePositiveRate)
+	assert.Equal(t, MaxSize, m)
+}
+
+func TestPositionsDistinct(t *testing.T) {
+	// a zero step would put every probe on the same bit
+	for i := 0; i < 1000; i++ {
+		key := []byte{byte(i), byte(i >> 8)}
+		seen := make(map[uint64]bool)
+		for _, position := range positions(key, 64, 8) {
+			seen[position] = true
+		}
+		assert.Len(t, seen, 8)
+	}
+}
+
+func TestBloomAddExists(t *testing.T) {
+	b := New(100, 0.01)
+
+	assert.False(t, b.Exists([]byte(`a`)))
+	b.Add([]byte(`a`))
+	assert.True(t, b.Exists([]byte(`a`)))
+
+	b.Reset()
+	assert.False(t, b.Exists([]byte(`a`)))
+}
+
+func TestBloomFalsePositiveRate(t *testing.T) {
+	numItems := 1000
+	b := New(uint64(numItems), 0.01)
+	for i := 0; i < numItems; i++ {
+		b.Add([]byte(fmt.Sprintf(`in-%d`, i)))
+	}
+
+	for i := 0; i < numItems; i++ {
+		assert.True(t, b.Exists([]byte(fmt.Sprintf(`in-%d`, i))))
+	}
+
+	falsePositives := 0
+	for i := 0; i < 10000; i++ {
+		if b.Exists([]byte(fmt.Sprintf(`out-%d`, i))) {
+			falsePositives++
+		}
+	}
+
+	assert.True(t, falsePositives < 300, `too many false positives: %d`, falsePositives)
+}
+
+func TestBloomUnion(t *testing.T) {
+	b := New(100, 0.01)
+	other := New(100, 0.01)
+	b.Add([]byte(`a`))
+	other.Add([]byte(`b`))
+
+	result, err := b.Union(other)
+	assert.Nil(t, err)
+	assert.True(t, result.Exists([]byte(`a`)))
+	assert.True(t, result.Exists([]byte(`b`)))
+	assert.False(t, b.Exists([]byte(`b`)))
+
+	_, err = b.Union(New(1000, 0.01))
+	assert.IsType(t, IncompatibleError{}, err)
+}
+
+func TestBloomMarshal(t *testing.T) {
+	b := New(100, 0.01)
+	b.Add([]byte(`a`))
+
+	encoded, err := b.MarshalBinary()
+	assert.Nil(t, err)
+
+	result := &Bloom{}
+	assert.Nil(t, result.UnmarshalBinary(encoded))
+	assert.Equal(t, b.Size(), result.Size())
+	assert.Equal(t, b.Hashes(), result.Hashes())
+	assert.True(t, result.Exists([]byte(`a`)))
+
+	assert.IsType(t, InvalidEncodingError(``), result.UnmarshalBinary(encoded[:4]))
+
+	// a size larger than the encoded bitarray is rejected before
+	// anything that large is allocated
+	bad := append([]byte(nil), encoded...)
+	binary.LittleEndian.PutUint64(bad, 1<<62)
+	assert.IsType(t, InvalidEncodingError(``), result.UnmarshalBinary(bad))
+
+	bad = append([]byte(nil), encoded...)
+	binary.LittleEndian.PutUint64(bad[8:], 1<<62)
+	assert.IsType(t, InvalidEncodingError(``), result.UnmarshalBinary(bad))
+	assert.Equal(t, b.Size(), result.Size())
+
+	// the size is checked against the encoded bitarray before it is
+	// decoded, which also rules out sparse encodings
+	bad = append([]byte(nil), encoded...)
+	binary.LittleEndian.PutUint64(bad, MaxSize)
+	assert.IsType(t, InvalidEncodingError(``), result.UnmarshalBinary(bad))
+
+	sparse, _ := bitarray.ToSparse(b.bits).MarshalBinary()
+	bad = append(append([]byte(nil), encoded[:headerSize]...), sparse...)
+	assert.IsType(t, InvalidEncodingError(``), result.UnmarshalBinary(bad))
+	assert.Equal(t, b.Size(), result.Size())
+}
+
+func BenchmarkBloomAdd(b *testing.B) {
+	bf := New(uint64(b.N), 0.01)
+	key := []byte(`benchmark`)
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bf.Add(key)
+	}
+}
@@ -0,0 +1,173 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bloom
+
+import (
+	"math"
+
+	"github.com/Workiva/go-datastructures/bitarray"
+)
+
+// CountingBloom is a Bloom filter that keeps a counter per position
+// instead of a single bit so keys can also be removed.  Counters
+// saturate at 255, after which they are never decremented.
+type CountingBloom struct {
+	counters []uint8
+	m        uint64
+	k        uint64
+}
+
+// Add adds the provided key to the filter.
+func (cb *CountingBloom) Add(key []byte) {
+	for _, position := range positions(key, cb.m, cb.k) {
+		if cb.counters[position] < math.MaxUint8 {
+			cb.counters[position]++
+		}
+	}
+}
+
+// Remove removes the provided key from the filter.  Only keys that
+// were added should be removed or other keys may be lost.
+func (cb *CountingBloom) Remove(key []byte) {
+	if !cb.Exists(key) {
+		return
+	}
+
+	for _, position := range positions(key, cb.m, cb.k) {
+		// a saturated counter no longer knows how many keys
+		// share it, so it is left alone
+		if cb.counters[position] < math.MaxUint8 {
+			cb.counters[position]--
+		}
+	}
+}
+
+// Exists returns a bool indicating if the provided key may be in
+// this filter.  False positives are possible but false negatives are
+// not.
+func (cb *CountingBloom) Exists(key []byte) bool {
+	for _, position := range positions(key, cb.m, cb.k) {
+		if cb.counters[position] == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Size returns the number of counters in this filter.
+func (cb *CountingBloom) Size() uint64 {
+	return cb.m
+}
+
+// Hashes returns the number of hashes used per key.
+func (cb *CountingBloom) Hashes() uint64 {
+	return cb.k
+}
+
+// Reset removes all keys from this filter.
+func (cb *CountingBloom) Reset() {
+	for i := range cb.counters {
+		cb.counters[i] = 0
+	}
+}
+
+// Union returns a new filter holding the sum of the counters of both
+// filters.  The filters must have the same size and number of hashes.
+func (cb *CountingBloom) Union(other *CountingBloom) (*CountingBloom, error) {
+	if cb.m != other.m || cb.k != other.k {
+		return nil, IncompatibleError{}
+	}
+
+	result := NewCountingWithSize(cb.m, cb.k)
+	for i, count := range cb.counters {
+		sum := uint64(count) + uint64(other.counters[i])
+		if sum > math.MaxUint8 {
+			sum = math.MaxUint8
+		}
+		result.counters[i] = uint8(sum)
+	}
+
+	return result, nil
+}
+
+// ToBloom returns a regular Bloom filter reporting the same keys as
+// this filter.
+func (cb *CountingBloom) ToBloom() *Bloom {
+	bits := bitarray.NewBitArray(cb.m)
+	for i, count := range cb.counters {
+		if count > 0 {
+			bits.SetBit(uint64(i))
+		}
+	}
+
+	return &Bloom{
+		bits: bits,
+		m:    cb.m,
+		k:    cb.k,
+	}
+}
+
+// MarshalBinary encodes this filter as its size and number of hashes,
+// each a little-endian uint64, followed by one byte per counter.
+func (cb *CountingBloom) MarshalBinary() ([]byte, error) {
+	return append(encodeHeader(cb.m, cb.k, len(cb.counters)), cb.counters...), nil
+}
+
+// UnmarshalBinary replaces this filter with the provided encoding.
+func (cb *CountingBloom) UnmarshalBinary(input []byte) error {
+	m, k, err := decodeHeader(input)
+	if err != nil {
+		return err
+	}
+
+	if uint64(len(input)-headerSize) != m {
+		return InvalidEncodingError(`length does not match size`)
+	}
+
+	cb.counters = make([]uint8, m)
+	copy(cb.counters, input[headerSize:])
+	cb.m, cb.k = m, k
+	return nil
+}
+
+// NewCounting returns a counting Bloom filter sized to hold the
+// expected number of items at the given false positive rate.
+func NewCounting(expectedItems uint64, falsePositiveRate float64) *CountingBloom {
+	m, k := Optimal(expectedItems, falsePositiveRate)
+	return NewCountingWithSize(m, k)
+}
+
+// NewCountingWithSize returns a counting Bloom filter of m counters
+// that increments k counters per key.  m is capped at MaxSize.
+func NewCountingWithSize(m, k uint64) *CountingBloom {
+	if m < 1 {
+		m = 1
+	}
+	if m > MaxSize {
+		m = MaxSize
+	}
+	if k < 1 {
+		k = 1
+	}
+
+	return &CountingBloom{
+		counters: make([]uint8, m),
+		m:        m,
+		k:        k,
+	}
+}
@@ -0,0 +1,89 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bloom
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCountingAddRemove(t *testing.T) {
+	cb := NewCounting(100, 0.01)
+
+	cb.Add([]byte(`a`))
+	cb.Add([]byte(`a`))
+	cb.Add([]byte(`b`))
+	assert.True(t, cb.Exists([]byte(`a`)))
+
+	cb.Remove([]byte(`a`))
+	assert.True(t, cb.Exists([]byte(`a`)))
+
+	cb.Remove([]byte(`a`))
+	assert.False(t, cb.Exists([]byte(`a`)))
+	assert.True(t, cb.Exists([]byte(`b`)))
+
+	// removing a missing key leaves other keys alone
+	cb.Remove([]byte(`a`))
+	assert.True(t, cb.Exists([]byte(`b`)))
+}
+
+func TestCountingSaturates(t *testing.T) {
+	cb := NewCountingWithSize(1, 1)
+	for i := 0; i < 300; i++ {
+		cb.Add([]byte(`a`))
+	}
+	assert.Equal(t, uint8(255), cb.counters[0])
+
+	cb.Remove([]byte(`a`))
+	assert.Equal(t, uint8(255), cb.counters[0])
+}
+
+func TestCountingUnionAndToBloom(t *testing.T) {
+	cb := NewCounting(100, 0.01)
+	other := NewCounting(100, 0.01)
+	cb.Add([]byte(`a`))
+	other.Add([]byte(`b`))
+
+	result, err := cb.Union(other)
+	assert.Nil(t, err)
+	assert.True(t, result.Exists([]byte(`a`)))
+	assert.True(t, result.Exists([]byte(`b`)))
+
+	_, err = cb.Union(NewCountingWithSize(5, 1))
+	assert.IsType(t, IncompatibleError{}, err)
+
+	b := result.ToBloom()
+	assert.True(t, b.Exists([]byte(`a`)))
+	assert.True(t, b.Exists([]byte(`b`)))
+	assert.Equal(t, result.Size(), b.Size())
+}
+
+func TestCountingMarshal(t *testing.T) {
+	cb := NewCounting(100, 0.01)
+	cb.Add([]byte(`a`))
+
+	encoded, err := cb.MarshalBinary()
+	assert.Nil(t, err)
+
+	result := &CountingBloom{}
+	assert.Nil(t, result.UnmarshalBinary(encoded))
+	assert.Equal(t, cb.counters, result.counters)
+	assert.True(t, result.Exists([]byte(`a`)))
+
+	assert.IsType(t, InvalidEncodingError(``), result.UnmarshalBinary(encoded[:len(encoded)-1]))
+}
@@ -0,0 +1,35 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package bloom
+
+import "fmt"
+
+// IncompatibleError is returned when attempting to combine two filters
+// that differ in size or number of hashes.
+type IncompatibleError struct{}
+
+func (ie IncompatibleError) Error() string {
+	return `Filters differ in size or number of hashes.`
+}
+
+// InvalidEncodingError is returned when attempting to unmarshal bytes
+// that do not describe a filter.
+type InvalidEncodingError string
+
+func (err InvalidEncodingError) Error() string {
+	return fmt.Sprintf(`Invalid filter encoding: %s.`, string(err))
+}
@@ -10,6 +10,8 @@ importing this package instead of each subpackage individually.
 import (
 	_ "github.com/Workiva/go-datastructures/augmentedtree"
 	_ "github.com/Workiva/go-datastructures/bitarray"
+	_ "github.com/Workiva/go-datastructures/bitmapindex"
+	_ "github.com/Workiva/go-datastructures/bloom"
 	_ "github.com/Workiva/go-datastructures/futures"
 	_ "github.com/Workiva/go-datastructures/graph"
 	_ "github.com/Workiva/go-datastructures/rangetree"
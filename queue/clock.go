@@ -0,0 +1,156 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells a delay queue what time it is and how to wait for a
+// later time.  Tests can supply a ManualClock to control when items
+// become due.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// NewTimer returns a timer whose channel receives the current
+	// time once the provided duration has elapsed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer waits for a clock to reach a deadline.  A timer that is no
+// longer needed should be stopped so the clock can let it go.
+type Timer interface {
+	// C returns the channel that receives the time once the deadline
+	// has passed.
+	C() <-chan time.Time
+	// Stop prevents the timer from firing.  It returns false if the
+	// timer had already fired or been stopped.
+	Stop() bool
+}
+
+type realClock struct{}
+
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+func (realClock) NewTimer(d time.Duration) Timer {
+	return realTimer{time.NewTimer(d)}
+}
+
+type realTimer struct {
+	*time.Timer
+}
+
+func (rt realTimer) C() <-chan time.Time {
+	return rt.Timer.C
+}
+
+// RealClock is a clock backed by the time package.
+var RealClock Clock = realClock{}
+
+type manualTimer struct {
+	clock *ManualClock
+	at    time.Time
+	ch    chan time.Time
+}
+
+// C returns the channel that receives once the clock has been
+// advanced past this timer's deadline.
+func (mt *manualTimer) C() <-chan time.Time {
+	return mt.ch
+}
+
+// Stop removes this timer from its clock.
+func (mt *manualTimer) Stop() bool {
+	mc := mt.clock
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	for i, timer := range mc.timers {
+		if timer == mt {
+			copy(mc.timers[i:], mc.timers[i+1:])
+			mc.timers[len(mc.timers)-1] = nil
+			mc.timers = mc.timers[:len(mc.timers)-1]
+			return true
+		}
+	}
+
+	return false
+}
+
+// ManualClock is a clock that only moves when told to.  Timers
+// returned by NewTimer fire once the clock has been advanced past
+// their deadline.
+type ManualClock struct {
+	lock   sync.Mutex
+	now    time.Time
+	timers []*manualTimer
+}
+
+// Now returns the clock's current time.
+func (mc *ManualClock) Now() time.Time {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	return mc.now
+}
+
+// NewTimer returns a timer that fires once the clock has been
+// advanced by at least the provided duration.  The clock holds on to
+// the timer until it fires or is stopped.
+func (mc *ManualClock) NewTimer(d time.Duration) Timer {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	timer := &manualTimer{clock: mc, at: mc.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		timer.ch <- mc.now
+		return timer
+	}
+
+	mc.timers = append(mc.timers, timer)
+	return timer
+}
+
+// Advance moves the clock forward by the provided duration and fires
+// any timers whose deadline has passed.
+func (mc *ManualClock) Advance(d time.Duration) {
+	mc.lock.Lock()
+	defer mc.lock.Unlock()
+
+	mc.now = mc.now.Add(d)
+	pending := mc.timers[:0]
+	for _, timer := range mc.timers {
+		if timer.at.After(mc.now) {
+			pending = append(pending, timer)
+			continue
+		}
+		timer.ch <- mc.now
+	}
+
+	for i := len(pending); i < len(mc.timers); i++ {
+		mc.timers[i] = nil
+	}
+	mc.timers = pending
+}
+
+// NewManualClock returns a manual clock set to the provided time.
+func NewManualClock(now time.Time) *ManualClock {
+	return &ManualClock{now: now}
+}
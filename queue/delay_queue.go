@@ -0,0 +1,267 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Delayed is an item that can be added to a delay queue.
+type Delayed interface {
+	// ReadyAt returns the time at which the item may be taken from
+	// the queue.
+	ReadyAt() time.Time
+}
+
+type delayedEntry struct {
+	item    Delayed
+	readyAt time.Time
+	// sequence keeps items that are ready at the same time in the
+	// order they were put.
+	sequence uint64
+}
+
+// delayedItems is a min-heap of entries ordered by ready time.
+type delayedItems []delayedEntry
+
+func (items delayedItems) Len() int {
+	return len(items)
+}
+
+func (items delayedItems) Less(i, j int) bool {
+	if items[i].readyAt.Equal(items[j].readyAt) {
+		return items[i].sequence < items[j].sequence
+	}
+
+	return items[i].readyAt.Before(items[j].readyAt)
+}
+
+func (items delayedItems) Swap(i, j int) {
+	items[i], items[j] = items[j], items[i]
+}
+
+func (items *delayedItems) Push(x interface{}) {
+	*items = append(*items, x.(delayedEntry))
+}
+
+func (items *delayedItems) Pop() interface{} {
+	old := *items
+	entry := old[len(old)-1]
+	old[len(old)-1] = delayedEntry{}
+	*items = old[:len(old)-1]
+	return entry
+}
+
+// DelayQueue is a queue of items that may not be taken until their
+// ready time has arrived.  Items are taken in order of ready time and
+// items that are ready at the same time are taken in the order they
+// were put.
+type DelayQueue struct {
+	items    delayedItems
+	sequence uint64
+	lock     sync.Mutex
+	disposed bool
+	clock    Clock
+	// changed wakes getters when an item becomes the earliest in the
+	// queue or the queue is disposed.
+	changed roomSignal
+}
+
+// Put adds items to the queue.  This only returns an error if the
+// queue has been disposed.
+func (dq *DelayQueue) Put(items ...Delayed) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if dq.disposed {
+		return DisposedError{}
+	}
+
+	for _, item := range items {
+		entry := delayedEntry{
+			item:     item,
+			readyAt:  item.ReadyAt(),
+			sequence: dq.sequence,
+		}
+		dq.sequence++
+		heap.Push(&dq.items, entry)
+		if dq.items[0].sequence == entry.sequence {
+			dq.changed.broadcast()
+		}
+	}
+
+	return nil
+}
+
+// Get retrieves up to number items whose ready time has arrived.  If
+// no item is ready, this call blocks until the earliest item becomes
+// ready.
+func (dq *DelayQueue) Get(number int) ([]Delayed, error) {
+	return dq.get(context.Background(), nil, number)
+}
+
+// Poll is like Get except that it gives up if no item becomes ready
+// within the provided timeout, as measured by the queue's clock, in
+// which case a TimeoutError is returned.
+func (dq *DelayQueue) Poll(number int, timeout time.Duration) ([]Delayed, error) {
+	timer := dq.clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	return dq.get(context.Background(), timer.C(), number)
+}
+
+// GetWithContext is like Get except that it gives up if the provided
+// context is done before any item becomes ready, in which case the
+// context's error is returned.
+func (dq *DelayQueue) GetWithContext(ctx context.Context, number int) ([]Delayed, error) {
+	return dq.get(ctx, nil, number)
+}
+
+func (dq *DelayQueue) get(ctx context.Context, expired <-chan time.Time, number int) ([]Delayed, error) {
+	if number < 1 {
+		return nil, nil
+	}
+
+	dq.lock.Lock()
+
+	for {
+		if dq.disposed {
+			dq.lock.Unlock()
+			return nil, DisposedError{}
+		}
+
+		now := dq.clock.Now()
+		if items := dq.take(now, number); len(items) > 0 {
+			dq.lock.Unlock()
+			return items, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			dq.lock.Unlock()
+			return nil, err
+		}
+
+		var due <-chan time.Time
+		var timer Timer
+		if len(dq.items) > 0 {
+			timer = dq.clock.NewTimer(dq.items[0].readyAt.Sub(now))
+			due = timer.C()
+		}
+		changed := dq.changed.wait()
+		dq.lock.Unlock()
+
+		var err error
+		select {
+		case <-changed:
+		case <-due:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-expired:
+			err = TimeoutError{}
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		dq.lock.Lock()
+	}
+}
+
+// take removes up to number items that are ready at the provided
+// time.
+func (dq *DelayQueue) take(now time.Time, number int) []Delayed {
+	var items []Delayed
+	for len(items) < number && len(dq.items) > 0 && !dq.items[0].readyAt.After(now) {
+		items = append(items, heap.Pop(&dq.items).(delayedEntry).item)
+	}
+
+	return items
+}
+
+// Peek returns the item with the earliest ready time without removing
+// it from the queue, whether or not it is ready.
+func (dq *DelayQueue) Peek() Delayed {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if len(dq.items) > 0 {
+		return dq.items[0].item
+	}
+	return nil
+}
+
+// Empty returns a bool indicating if there are any items left
+// in the queue.
+func (dq *DelayQueue) Empty() bool {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return len(dq.items) == 0
+}
+
+// Len returns the number of items in the queue, ready or not.
+func (dq *DelayQueue) Len() int {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return len(dq.items)
+}
+
+// Disposed returns a bool indicating if this queue has been disposed.
+func (dq *DelayQueue) Disposed() bool {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return dq.disposed
+}
+
+// Dispose will dispose of this queue.  Any waiting or subsequent
+// calls to Get or Put will return an error.
+func (dq *DelayQueue) Dispose() {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	dq.disposed = true
+	dq.changed.broadcast()
+	dq.items = nil
+}
+
+// NewDelayQueue is the constructor for a delay queue that uses the
+// system clock.
+func NewDelayQueue(hint int) *DelayQueue {
+	return NewDelayQueueWithClock(hint, RealClock)
+}
+
+// NewDelayQueueWithClock is the constructor for a delay queue that
+// uses the provided clock to decide when items are ready.
+func NewDelayQueueWithClock(hint int, clock Clock) *DelayQueue {
+	return &DelayQueue{
+		items: make(delayedItems, 0, hint),
+		clock: clock,
+	}
+}
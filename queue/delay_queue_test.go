@@ -0,0 +1,233 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type mockDelayed struct {
+	name string
+	at   time.Time
+}
+
+func (md mockDelayed) ReadyAt() time.Time {
+	return md.at
+}
+
+var epoch = time.Date(2014, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+func delayed(name string, after time.Duration) mockDelayed {
+	return mockDelayed{name: name, at: epoch.Add(after)}
+}
+
+func TestManualClock(t *testing.T) {
+	clock := NewManualClock(epoch)
+	assert.Equal(t, epoch, clock.Now())
+
+	timer := clock.NewTimer(time.Second)
+	clock.Advance(500 * time.Millisecond)
+	select {
+	case <-timer.C():
+		t.Fatal(`timer fired early`)
+	default:
+	}
+
+	clock.Advance(500 * time.Millisecond)
+	assert.Equal(t, epoch.Add(time.Second), <-timer.C())
+	assert.False(t, timer.Stop())
+	assert.Equal(t, epoch.Add(time.Second), <-clock.NewTimer(0).C())
+
+	// stopped timers are dropped and never fire
+	timer = clock.NewTimer(time.Second)
+	assert.Len(t, clock.timers, 1)
+	assert.True(t, timer.Stop())
+	assert.Len(t, clock.timers, 0)
+	clock.Advance(time.Hour)
+	select {
+	case <-timer.C():
+		t.Fatal(`stopped timer fired`)
+	default:
+	}
+}
+
+func TestDelayQueueStopsTimers(t *testing.T) {
+	clock := NewManualClock(epoch)
+	dq := NewDelayQueueWithClock(1, clock)
+	dq.Put(delayed(`b`, time.Hour))
+
+	done := make(chan []Delayed)
+	go func() {
+		result, _ := dq.Get(1)
+		done <- result
+	}()
+
+	// every wakeup that ends a wait gives back its timer
+	for i := 0; i < 10; i++ {
+		time.Sleep(time.Millisecond)
+		dq.Put(delayed(`c`, time.Duration(10-i)*time.Minute))
+	}
+	dq.Put(delayed(`a`, 0))
+	assert.Equal(t, []Delayed{delayed(`a`, 0)}, <-done)
+	assert.Len(t, clock.timers, 0)
+
+	_, err := dq.Poll(1, 0)
+	assert.IsType(t, TimeoutError{}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	errs := make(chan error)
+	go func() {
+		_, err := dq.GetWithContext(ctx, 1)
+		errs <- err
+	}()
+	time.Sleep(10 * time.Millisecond)
+	cancel()
+	assert.Equal(t, context.Canceled, <-errs)
+	assert.Len(t, clock.timers, 0)
+}
+
+func TestDelayQueueOrdersByReadyTime(t *testing.T) {
+	clock := NewManualClock(epoch)
+	dq := NewDelayQueueWithClock(4, clock)
+
+	dq.Put(delayed(`c`, 3*time.Second), delayed(`a`, time.Second),
+		delayed(`b`, 2*time.Second), delayed(`b2`, 2*time.Second))
+	assert.Equal(t, 4, dq.Len())
+	assert.Equal(t, delayed(`a`, time.Second), dq.Peek())
+
+	clock.Advance(2 * time.Second)
+	result, err := dq.Get(5)
+	assert.Nil(t, err)
+	assert.Equal(t, []Delayed{
+		delayed(`a`, time.Second), delayed(`b`, 2*time.Second),
+		delayed(`b2`, 2*time.Second),
+	}, result)
+	assert.Equal(t, 1, dq.Len())
+}
+
+func TestDelayQueueGetBlocksUntilDue(t *testing.T) {
+	clock := NewManualClock(epoch)
+	dq := NewDelayQueueWithClock(1, clock)
+	dq.Put(delayed(`a`, time.Minute))
+
+	done := make(chan []Delayed)
+	go func() {
+		result, _ := dq.Get(1)
+		done <- result
+	}()
+
+	clock.Advance(30 * time.Second)
+	select {
+	case <-done:
+		t.Fatal(`get returned an item that was not due`)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, []Delayed{delayed(`a`, time.Minute)}, <-done)
+}
+
+func TestDelayQueueEarlierItemWakesGetter(t *testing.T) {
+	clock := NewManualClock(epoch)
+	dq := NewDelayQueueWithClock(1, clock)
+
+	done := make(chan []Delayed)
+	go func() {
+		result, _ := dq.Get(1)
+		done <- result
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	dq.Put(delayed(`b`, time.Hour))
+	dq.Put(delayed(`a`, -time.Second))
+	assert.Equal(t, []Delayed{delayed(`a`, -time.Second)}, <-done)
+}
+
+func TestDelayQueuePoll(t *testing.T) {
+	clock := NewManualClock(epoch)
+	dq := NewDelayQueueWithClock(1, clock)
+	dq.Put(delayed(`a`, time.Minute))
+
+	_, err := dq.Poll(1, 0)
+	assert.IsType(t, TimeoutError{}, err)
+
+	done := make(chan error)
+	go func() {
+		_, err := dq.Poll(1, time.Second)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	clock.Advance(time.Second)
+	assert.IsType(t, TimeoutError{}, <-done)
+	assert.Equal(t, 1, dq.Len())
+}
+
+func TestDelayQueueGetWithContext(t *testing.T) {
+	dq := NewDelayQueue(1)
+	dq.Put(mockDelayed{at: time.Now().Add(time.Hour)})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := dq.GetWithContext(ctx, 1)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
+
+func TestDelayQueueRealClock(t *testing.T) {
+	dq := NewDelayQueue(1)
+	start := time.Now()
+	dq.Put(mockDelayed{name: `a`, at: start.Add(10 * time.Millisecond)})
+
+	result, err := dq.Get(1)
+	assert.Nil(t, err)
+	assert.Len(t, result, 1)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+}
+
+func TestDelayQueueDispose(t *testing.T) {
+	dq := NewDelayQueueWithClock(1, NewManualClock(epoch))
+	dq.Put(delayed(`a`, time.Minute))
+
+	done := make(chan error)
+	go func() {
+		_, err := dq.Get(1)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	dq.Dispose()
+	assert.IsType(t, DisposedError{}, <-done)
+	assert.True(t, dq.Disposed())
+	assert.IsType(t, DisposedError{}, dq.Put(delayed(`b`, 0)))
+}
+
+func BenchmarkDelayQueue(b *testing.B) {
+	dq := NewDelayQueueWithClock(b.N, NewManualClock(epoch))
+	for i := 0; i < b.N; i++ {
+		dq.Put(delayed(``, time.Duration(b.N-i)*-time.Second))
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dq.Get(1)
+	}
+}
@@ -0,0 +1,281 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+// Deque is a threadsafe double-ended queue backed by a growable ring
+// buffer.  Items can be pushed to and popped from either end, so it
+// can serve as a FIFO queue, a LIFO stack, or both at once as when
+// requeueing a failed item at the front.  Pops block on an empty
+// deque until an item is pushed or the deque is disposed.
+type Deque struct {
+	lock     sync.Mutex
+	items    []interface{}
+	head     int
+	count    int
+	disposed bool
+	// pushed wakes poppers waiting on an empty deque when items are
+	// pushed or the deque is disposed.
+	pushed roomSignal
+}
+
+// grow makes room for at least number more items.
+func (d *Deque) grow(number int) {
+	if d.count+number <= len(d.items) {
+		return
+	}
+
+	size := len(d.items) * 2
+	if size == 0 {
+		size = 1
+	}
+	for size < d.count+number {
+		size *= 2
+	}
+
+	items := make([]interface{}, size)
+	n := copy(items, d.items[d.head:])
+	if n < d.count {
+		copy(items[n:], d.items[:d.count-n])
+	}
+	d.items = items
+	d.head = 0
+}
+
+// index returns the position in the ring of the ith item from the
+// front.
+func (d *Deque) index(i int) int {
+	return (d.head + i) % len(d.items)
+}
+
+func (d *Deque) push(front bool, items []interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.disposed {
+		return DisposedError{}
+	}
+
+	d.grow(len(items))
+	for _, item := range items {
+		if front {
+			d.head = d.index(len(d.items) - 1)
+			d.items[d.head] = item
+		} else {
+			d.items[d.index(d.count)] = item
+		}
+		d.count++
+	}
+
+	d.pushed.broadcast()
+	return nil
+}
+
+// PushFront adds items to the front of the deque, one at a time, so
+// the last item provided ends up at the very front.  This only
+// returns an error if the deque has been disposed.
+func (d *Deque) PushFront(items ...interface{}) error {
+	return d.push(true, items)
+}
+
+// PushBack adds items to the back of the deque in the order
+// provided.  This only returns an error if the deque has been
+// disposed.
+func (d *Deque) PushBack(items ...interface{}) error {
+	return d.push(false, items)
+}
+
+// take removes an item from the provided end of the deque.  This must
+// only be called with the lock held on a non-empty deque.
+func (d *Deque) take(front bool) interface{} {
+	i := d.index(d.count - 1)
+	if front {
+		i = d.head
+		d.head = d.index(1)
+	}
+
+	item := d.items[i]
+	d.items[i] = nil
+	d.count--
+	return item
+}
+
+func (d *Deque) pop(ctx context.Context, front bool) (interface{}, error) {
+	d.lock.Lock()
+
+	for {
+		if d.disposed {
+			d.lock.Unlock()
+			return nil, DisposedError{}
+		}
+
+		if d.count > 0 {
+			item := d.take(front)
+			d.lock.Unlock()
+			return item, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			d.lock.Unlock()
+			return nil, err
+		}
+
+		pushed := d.pushed.wait()
+		d.lock.Unlock()
+
+		select {
+		case <-pushed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		d.lock.Lock()
+	}
+}
+
+// PopFront removes and returns the item at the front of the deque.
+// If the deque is empty, this call blocks until an item is pushed.
+func (d *Deque) PopFront() (interface{}, error) {
+	return d.pop(context.Background(), true)
+}
+
+// PopBack removes and returns the item at the back of the deque.  If
+// the deque is empty, this call blocks until an item is pushed.
+func (d *Deque) PopBack() (interface{}, error) {
+	return d.pop(context.Background(), false)
+}
+
+// PopFrontWithContext is like PopFront except that it gives up if the
+// provided context is done before an item is pushed, in which case
+// the context's error is returned.
+func (d *Deque) PopFrontWithContext(ctx context.Context) (interface{}, error) {
+	return d.pop(ctx, true)
+}
+
+// PopBackWithContext is like PopBack except that it gives up if the
+// provided context is done before an item is pushed, in which case
+// the context's error is returned.
+func (d *Deque) PopBackWithContext(ctx context.Context) (interface{}, error) {
+	return d.pop(ctx, false)
+}
+
+func (d *Deque) tryPop(front bool) (interface{}, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.disposed || d.count == 0 {
+		return nil, false
+	}
+
+	return d.take(front), true
+}
+
+// TryPopFront removes and returns the item at the front of the deque
+// without waiting.  The returned bool is false if the deque is empty
+// or disposed.
+func (d *Deque) TryPopFront() (interface{}, bool) {
+	return d.tryPop(true)
+}
+
+// TryPopBack removes and returns the item at the back of the deque
+// without waiting.  The returned bool is false if the deque is empty
+// or disposed.
+func (d *Deque) TryPopBack() (interface{}, bool) {
+	return d.tryPop(false)
+}
+
+// PeekFront returns the item at the front of the deque without
+// removing it, or nil if the deque is empty.
+func (d *Deque) PeekFront() interface{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.count == 0 {
+		return nil
+	}
+	return d.items[d.head]
+}
+
+// PeekBack returns the item at the back of the deque without removing
+// it, or nil if the deque is empty.
+func (d *Deque) PeekBack() interface{} {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if d.count == 0 {
+		return nil
+	}
+	return d.items[d.index(d.count-1)]
+}
+
+// Empty returns a bool indicating if there are any items left in the
+// deque.
+func (d *Deque) Empty() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.count == 0
+}
+
+// Len returns the number of items in the deque.
+func (d *Deque) Len() int {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.count
+}
+
+// Disposed returns a bool indicating if this deque has been disposed.
+func (d *Deque) Disposed() bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	return d.disposed
+}
+
+// Dispose will dispose of this deque.  Any waiting or subsequent
+// calls to push or pop will return an error.
+func (d *Deque) Dispose() {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.disposed = true
+	d.pushed.broadcast()
+	d.items = nil
+	d.head = 0
+	d.count = 0
+}
+
+// NewDeque is the constructor for a deque with room for hint items
+// before it needs to grow.
+func NewDeque(hint int) *Deque {
+	if hint < 0 {
+		hint = 0
+	}
+
+	return &Deque{
+		items: make([]interface{}, hint),
+	}
+}
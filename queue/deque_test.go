@@ -0,0 +1,179 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDequeFIFO(t *testing.T) {
+	d := NewDeque(2)
+	d.PushBack(1, 2, 3)
+	assert.Equal(t, 3, d.Len())
+
+	for i := 1; i <= 3; i++ {
+		result, err := d.PopFront()
+		assert.Nil(t, err)
+		assert.Equal(t, i, result)
+	}
+	assert.True(t, d.Empty())
+}
+
+func TestDequeLIFO(t *testing.T) {
+	d := NewDeque(0)
+	d.PushBack(1, 2, 3)
+
+	for i := 3; i >= 1; i-- {
+		result, err := d.PopBack()
+		assert.Nil(t, err)
+		assert.Equal(t, i, result)
+	}
+}
+
+func TestDequePushFront(t *testing.T) {
+	d := NewDeque(2)
+	d.PushBack(3)
+	d.PushFront(2, 1)
+	assert.Equal(t, 1, d.PeekFront())
+	assert.Equal(t, 3, d.PeekBack())
+
+	for i := 1; i <= 3; i++ {
+		result, _ := d.PopFront()
+		assert.Equal(t, i, result)
+	}
+	assert.Nil(t, d.PeekFront())
+	assert.Nil(t, d.PeekBack())
+}
+
+func TestDequeWrapsAndGrows(t *testing.T) {
+	d := NewDeque(4)
+	expected := make([]interface{}, 0, 100)
+
+	// keep the ring wrapped around its end while it grows
+	for i := 0; i < 50; i++ {
+		d.PushBack(i)
+		d.PushFront(-i - 1)
+		d.PopFront()
+		expected = append(expected, i)
+	}
+
+	result := make([]interface{}, 0, 50)
+	for !d.Empty() {
+		item, _ := d.PopFront()
+		result = append(result, item)
+	}
+	assert.Equal(t, expected, result)
+}
+
+func TestDequeTryPop(t *testing.T) {
+	d := NewDeque(1)
+	_, ok := d.TryPopFront()
+	assert.False(t, ok)
+
+	d.PushBack(1, 2)
+	result, ok := d.TryPopBack()
+	assert.True(t, ok)
+	assert.Equal(t, 2, result)
+	result, ok = d.TryPopFront()
+	assert.True(t, ok)
+	assert.Equal(t, 1, result)
+	_, ok = d.TryPopBack()
+	assert.False(t, ok)
+}
+
+func TestDequeBlockingPop(t *testing.T) {
+	d := NewDeque(1)
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	results := make(chan int, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			defer wg.Done()
+			result, err := d.PopBack()
+			assert.Nil(t, err)
+			results <- result.(int)
+		}()
+	}
+
+	time.Sleep(10 * time.Millisecond)
+	d.PushBack(1)
+	d.PushFront(2)
+	wg.Wait()
+
+	assert.Equal(t, 3, <-results+<-results)
+}
+
+func TestDequePopWithContext(t *testing.T) {
+	d := NewDeque(1)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	_, err := d.PopFrontWithContext(ctx)
+	assert.Equal(t, context.DeadlineExceeded, err)
+
+	d.PushBack(1)
+	result, err := d.PopBackWithContext(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, 1, result)
+}
+
+func TestDequeDispose(t *testing.T) {
+	d := NewDeque(1)
+
+	done := make(chan error)
+	go func() {
+		_, err := d.PopFront()
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	d.Dispose()
+	assert.IsType(t, DisposedError{}, <-done)
+	assert.True(t, d.Disposed())
+	assert.IsType(t, DisposedError{}, d.PushBack(1))
+	assert.IsType(t, DisposedError{}, d.PushFront(1))
+	_, err := d.PopBack()
+	assert.IsType(t, DisposedError{}, err)
+	_, ok := d.TryPopFront()
+	assert.False(t, ok)
+}
+
+func BenchmarkDeque(b *testing.B) {
+	d := NewDeque(b.N)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			d.PopFront()
+		}
+		wg.Done()
+	}()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		d.PushBack(i)
+	}
+	wg.Wait()
+}
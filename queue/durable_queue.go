@@ -0,0 +1,729 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Codec converts the items of a durable queue to and from the bytes
+// stored in its log.
+type Codec interface {
+	// Encode returns the bytes that represent the provided item.
+	Encode(item interface{}) ([]byte, error)
+	// Decode returns the item represented by the provided bytes.
+	Decode(data []byte) (interface{}, error)
+}
+
+// BytesCodec is a codec for items that are already byte slices.
+type BytesCodec struct{}
+
+// Encode returns the provided item, which must be a []byte.
+func (BytesCodec) Encode(item interface{}) ([]byte, error) {
+	data, ok := item.([]byte)
+	if !ok {
+		return nil, fmt.Errorf(`BytesCodec cannot encode %T.`, item)
+	}
+
+	return data, nil
+}
+
+// Decode returns a copy of the provided bytes.
+func (BytesCodec) Decode(data []byte) (interface{}, error) {
+	return append([]byte(nil), data...), nil
+}
+
+// DefaultSegmentSize is the size in bytes past which a durable queue
+// starts a new log segment unless another size is given.
+const DefaultSegmentSize = 64 << 20
+
+const (
+	// recordStart begins every segment and carries the next ID to be
+	// assigned, so IDs are never reused once their puts are deleted.
+	recordStart byte = iota
+	recordPut
+	recordAck
+)
+
+const (
+	// recordHeaderSize is the payload length, checksum, kind and ID
+	// that precede the payload of every record.
+	recordHeaderSize = 4 + 4 + 1 + 8
+	segmentSuffix    = `.wal`
+)
+
+// encodeRecord appends a record to the provided buffer.  The checksum
+// covers the kind, ID and payload.
+func encodeRecord(buf []byte, kind byte, id uint64, payload []byte) []byte {
+	start := len(buf)
+	var header [recordHeaderSize]byte
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(payload)))
+	header[8] = kind
+	binary.LittleEndian.PutUint64(header[9:], id)
+
+	buf = append(buf, header[:]...)
+	buf = append(buf, payload...)
+	binary.LittleEndian.PutUint32(buf[start+4:], crc32.ChecksumIEEE(buf[start+8:]))
+	return buf
+}
+
+// readRecords calls fn with every record in data and returns the
+// length of the prefix of data made up of whole, valid records.
+func readRecords(data []byte, fn func(kind byte, id uint64, payload []byte) error) (int, error) {
+	offset := 0
+	for len(data)-offset >= recordHeaderSize {
+		header := data[offset : offset+recordHeaderSize]
+		end := offset + recordHeaderSize + int(binary.LittleEndian.Uint32(header))
+		if end < offset || end > len(data) {
+			break
+		}
+		if crc32.ChecksumIEEE(data[offset+8:end]) != binary.LittleEndian.Uint32(header[4:]) {
+			break
+		}
+
+		err := fn(header[8], binary.LittleEndian.Uint64(header[9:]), data[offset+recordHeaderSize:end])
+		if err != nil {
+			return offset, err
+		}
+		offset = end
+	}
+
+	return offset, nil
+}
+
+// tornRecord returns a bool indicating if the invalid data from offset
+// to the end of data can be explained by a final record that was only
+// partly written: it is shorter than the record it begins, it is a
+// single record that ends with data, or it is nothing but zeros.
+// Anything else means a record followed by more data is damaged.
+func tornRecord(data []byte, offset int) bool {
+	rest := data[offset:]
+	if len(rest) < recordHeaderSize {
+		return true
+	}
+
+	if recordHeaderSize+int64(binary.LittleEndian.Uint32(rest)) >= int64(len(rest)) {
+		return true
+	}
+
+	for _, b := range rest {
+		if b != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DurableItem is an item retrieved from a durable queue along with
+// the ID used to acknowledge it.
+type DurableItem struct {
+	ID   uint64
+	Item interface{}
+}
+
+type segment struct {
+	number uint64
+	path   string
+	// size is the number of bytes written to this segment.
+	size int64
+	// unacked counts the items put in this segment that have not
+	// been acknowledged, and unackedSize the bytes of their records.
+	unacked     int
+	unackedSize int64
+}
+
+func (seg *segment) add(entry *durableEntry) {
+	seg.unacked++
+	seg.unackedSize += entry.size
+}
+
+func (seg *segment) remove(entry *durableEntry) {
+	seg.unacked--
+	seg.unackedSize -= entry.size
+}
+
+type durableEntry struct {
+	id   uint64
+	item interface{}
+	// size is the number of bytes in this item's put record.
+	size    int64
+	segment *segment
+	acked   bool
+}
+
+// DurableQueue is a queue whose items survive the process.  Every put
+// is appended to a log on disk, which is split into segments, and
+// synced before Put returns.  Items retrieved with Get stay in the log
+// until they are acknowledged with Ack, and reopening the queue
+// replays every item that was not acknowledged, in the order it was
+// put.  The oldest segment is deleted once every item in it has been
+// acknowledged.  When the items left in it take up no more than a
+// quarter of it, they are copied to the newest segment first, so a
+// few items that are never acknowledged do not keep every later
+// segment on disk.
+type DurableQueue struct {
+	lock        sync.Mutex
+	dir         string
+	codec       Codec
+	segmentSize int64
+	segments    []*segment
+	// file is the newest segment, which records are appended to.
+	file      *os.File
+	nextID    uint64
+	pending   []*durableEntry
+	delivered map[uint64]*durableEntry
+	disposed  bool
+	// pushed wakes getters waiting on an empty queue when items are
+	// put or the queue is disposed.
+	pushed roomSignal
+}
+
+func (dq *DurableQueue) segmentPath(number uint64) string {
+	return filepath.Join(dq.dir, fmt.Sprintf(`%020d%s`, number, segmentSuffix))
+}
+
+// replay rebuilds the queue from the segments in its directory.
+func (dq *DurableQueue) replay() error {
+	paths, err := filepath.Glob(filepath.Join(dq.dir, `*`+segmentSuffix))
+	if err != nil {
+		return err
+	}
+
+	for _, path := range paths {
+		number, err := strconv.ParseUint(strings.TrimSuffix(filepath.Base(path), segmentSuffix), 10, 64)
+		if err != nil {
+			continue
+		}
+		dq.segments = append(dq.segments, &segment{number: number, path: path})
+	}
+	sort.Slice(dq.segments, func(i, j int) bool {
+		return dq.segments[i].number < dq.segments[j].number
+	})
+
+	var entries []*durableEntry
+	byID := make(map[uint64]*durableEntry)
+	for i, seg := range dq.segments {
+		data, err := os.ReadFile(seg.path)
+		if err != nil {
+			return err
+		}
+
+		valid, err := readRecords(data, func(kind byte, id uint64, payload []byte) error {
+			switch kind {
+			case recordStart:
+				if id > dq.nextID {
+					dq.nextID = id
+				}
+			case recordPut:
+				// a second put of an ID is the item being copied
+				// out of an older segment
+				if entry, ok := byID[id]; ok {
+					entry.segment.remove(entry)
+					entry.segment = seg
+					seg.add(entry)
+					return nil
+				}
+
+				item, err := dq.codec.Decode(payload)
+				if err != nil {
+					return err
+				}
+
+				entry := &durableEntry{
+					id: id, item: item, segment: seg,
+					size: int64(recordHeaderSize + len(payload)),
+				}
+				entries = append(entries, entry)
+				byID[id] = entry
+				seg.add(entry)
+				if id >= dq.nextID {
+					dq.nextID = id + 1
+				}
+			case recordAck:
+				if entry, ok := byID[id]; ok {
+					delete(byID, id)
+					entry.acked = true
+					entry.segment.remove(entry)
+				}
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		if valid < len(data) {
+			// the end of the newest segment may hold a record that
+			// was only partly written when the process stopped
+			if i != len(dq.segments)-1 || !tornRecord(data, valid) {
+				return CorruptLogError(seg.path)
+			}
+			if err := os.Truncate(seg.path, int64(valid)); err != nil {
+				return err
+			}
+		}
+		seg.size = int64(valid)
+	}
+
+	// items copied out of older segments are replayed from where they
+	// were copied to, but IDs still follow the order of the puts
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].id < entries[j].id
+	})
+	for _, entry := range entries {
+		if !entry.acked {
+			dq.pending = append(dq.pending, entry)
+		}
+	}
+
+	if len(dq.segments) == 0 {
+		return dq.roll()
+	}
+
+	last := dq.segments[len(dq.segments)-1]
+	dq.file, err = os.OpenFile(last.path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	return dq.compact()
+}
+
+// roll starts a new segment and makes it the one records are
+// appended to.
+func (dq *DurableQueue) roll() error {
+	number := uint64(0)
+	if len(dq.segments) > 0 {
+		number = dq.segments[len(dq.segments)-1].number + 1
+	}
+
+	seg := &segment{number: number, path: dq.segmentPath(number)}
+	file, err := os.OpenFile(seg.path, os.O_CREATE|os.O_EXCL|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	start := encodeRecord(nil, recordStart, dq.nextID, nil)
+	if _, err := file.Write(start); err != nil {
+		file.Close()
+		os.Remove(seg.path)
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		file.Close()
+		os.Remove(seg.path)
+		return err
+	}
+	if err := syncDir(dq.dir); err != nil {
+		file.Close()
+		os.Remove(seg.path)
+		return err
+	}
+
+	if dq.file != nil {
+		dq.file.Close()
+	}
+	dq.file = file
+	seg.size = int64(len(start))
+	dq.segments = append(dq.segments, seg)
+	return dq.compact()
+}
+
+// newest returns the segment records are appended to.
+func (dq *DurableQueue) newest() *segment {
+	return dq.segments[len(dq.segments)-1]
+}
+
+// write appends the provided records to the newest segment, starting
+// a new segment first if the newest one is full.
+func (dq *DurableQueue) write(records []byte) error {
+	if dq.newest().size >= dq.segmentSize {
+		if err := dq.roll(); err != nil {
+			return err
+		}
+	}
+
+	return dq.append(records)
+}
+
+// append appends the provided records to the newest segment and syncs
+// it.  If the write fails, the segment is truncated back to its last
+// good record.
+func (dq *DurableQueue) append(records []byte) error {
+	seg := dq.newest()
+	_, err := dq.file.Write(records)
+	if err == nil {
+		err = dq.file.Sync()
+	}
+	if err != nil {
+		dq.file.Truncate(seg.size)
+		return err
+	}
+
+	seg.size += int64(len(records))
+	return nil
+}
+
+// compact deletes the oldest segments for as long as every item put
+// in them has been acknowledged, first copying the items left in a
+// segment to the newest segment if they take up no more than a
+// quarter of it.  The newest segment is never deleted.  An
+// acknowledgement can only refer to an item put, or copied, before
+// it, so the acknowledgements in a deleted segment only concern items
+// that are gone as well.
+func (dq *DurableQueue) compact() error {
+	for len(dq.segments) > 1 {
+		oldest := dq.segments[0]
+		if oldest.unacked > 0 {
+			if oldest.unackedSize*4 > oldest.size {
+				return nil
+			}
+			if err := dq.move(oldest); err != nil {
+				return err
+			}
+		}
+
+		if err := os.Remove(oldest.path); err != nil {
+			return err
+		}
+		dq.segments[0] = nil
+		dq.segments = dq.segments[1:]
+	}
+
+	return nil
+}
+
+// move copies the items put in the provided segment that have not
+// been acknowledged to the newest segment, keeping their IDs.  The
+// newest segment may grow past the segment size to hold them.
+func (dq *DurableQueue) move(seg *segment) error {
+	entries := make([]*durableEntry, 0, seg.unacked)
+	for _, entry := range dq.delivered {
+		if entry.segment == seg {
+			entries = append(entries, entry)
+		}
+	}
+	// the oldest items are at the front of the pending items
+	for _, entry := range dq.pending {
+		if len(entries) == seg.unacked {
+			break
+		}
+		if entry.segment == seg {
+			entries = append(entries, entry)
+		}
+	}
+
+	var records []byte
+	for _, entry := range entries {
+		payload, err := dq.codec.Encode(entry.item)
+		if err != nil {
+			return err
+		}
+		records = encodeRecord(records, recordPut, entry.id, payload)
+	}
+
+	if err := dq.append(records); err != nil {
+		return err
+	}
+
+	newest := dq.newest()
+	for _, entry := range entries {
+		seg.remove(entry)
+		entry.segment = newest
+		newest.add(entry)
+	}
+
+	return nil
+}
+
+// Put adds items to the queue.  The items are in the log on disk by
+// the time this returns.  An error is returned if the queue has been
+// disposed or the items cannot be encoded or written, in which case
+// none of them are added.
+func (dq *DurableQueue) Put(items ...interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if dq.disposed {
+		return DisposedError{}
+	}
+
+	var records []byte
+	entries := make([]*durableEntry, 0, len(items))
+	for i, item := range items {
+		payload, err := dq.codec.Encode(item)
+		if err != nil {
+			return err
+		}
+
+		id := dq.nextID + uint64(i)
+		records = encodeRecord(records, recordPut, id, payload)
+		entries = append(entries, &durableEntry{
+			id: id, item: item, size: int64(recordHeaderSize + len(payload)),
+		})
+	}
+
+	if err := dq.write(records); err != nil {
+		return err
+	}
+
+	seg := dq.newest()
+	for _, entry := range entries {
+		entry.segment = seg
+		seg.add(entry)
+	}
+	dq.pending = append(dq.pending, entries...)
+	dq.nextID += uint64(len(items))
+
+	dq.pushed.broadcast()
+	return nil
+}
+
+// Get retrieves up to number items from the queue.  If the queue is
+// empty, this call blocks until the next item is put.  Retrieved items
+// are delivered again if the queue is reopened before they are
+// acknowledged.
+func (dq *DurableQueue) Get(number int64) ([]DurableItem, error) {
+	return dq.GetWithContext(context.Background(), number)
+}
+
+// Poll is like Get except that it gives up if no items are put to the
+// queue within the provided timeout, in which case a TimeoutError is
+// returned.
+func (dq *DurableQueue) Poll(number int64, timeout time.Duration) ([]DurableItem, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	items, err := dq.GetWithContext(ctx, number)
+	if err == context.DeadlineExceeded {
+		return nil, TimeoutError{}
+	}
+
+	return items, err
+}
+
+// GetWithContext is like Get except that it gives up if the provided
+// context is done before any items are put to the queue, in which case
+// the context's error is returned.
+func (dq *DurableQueue) GetWithContext(ctx context.Context, number int64) ([]DurableItem, error) {
+	if number < 1 {
+		return nil, nil
+	}
+
+	dq.lock.Lock()
+
+	for {
+		if dq.disposed {
+			dq.lock.Unlock()
+			return nil, DisposedError{}
+		}
+
+		if len(dq.pending) > 0 {
+			items := dq.take(number)
+			dq.lock.Unlock()
+			return items, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			dq.lock.Unlock()
+			return nil, err
+		}
+
+		pushed := dq.pushed.wait()
+		dq.lock.Unlock()
+
+		select {
+		case <-pushed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		dq.lock.Lock()
+	}
+}
+
+// take moves up to number pending items to the delivered items.
+func (dq *DurableQueue) take(number int64) []DurableItem {
+	if number > int64(len(dq.pending)) {
+		number = int64(len(dq.pending))
+	}
+
+	items := make([]DurableItem, 0, number)
+	for i, entry := range dq.pending[:number] {
+		items = append(items, DurableItem{ID: entry.id, Item: entry.item})
+		dq.delivered[entry.id] = entry
+		dq.pending[i] = nil
+	}
+	dq.pending = dq.pending[number:]
+
+	return items
+}
+
+// Ack acknowledges the retrieved items with the provided IDs so that
+// they are never delivered again.  IDs of items that have not been
+// retrieved, or have already been acknowledged, are ignored.
+func (dq *DurableQueue) Ack(ids ...uint64) error {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if dq.disposed {
+		return DisposedError{}
+	}
+
+	var records []byte
+	acked := make([]*durableEntry, 0, len(ids))
+	for _, id := range ids {
+		entry, ok := dq.delivered[id]
+		if !ok {
+			continue
+		}
+
+		delete(dq.delivered, id)
+		acked = append(acked, entry)
+		records = encodeRecord(records, recordAck, id, nil)
+	}
+
+	if len(acked) == 0 {
+		return nil
+	}
+
+	if err := dq.write(records); err != nil {
+		for _, entry := range acked {
+			dq.delivered[entry.id] = entry
+		}
+		return err
+	}
+
+	for _, entry := range acked {
+		entry.segment.remove(entry)
+	}
+
+	return dq.compact()
+}
+
+// Empty returns a bool indicating if there are any items waiting to
+// be retrieved.
+func (dq *DurableQueue) Empty() bool {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return len(dq.pending) == 0
+}
+
+// Len returns the number of items waiting to be retrieved.
+func (dq *DurableQueue) Len() int64 {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return int64(len(dq.pending))
+}
+
+// Unacked returns the number of items that have been retrieved but not
+// yet acknowledged.
+func (dq *DurableQueue) Unacked() int64 {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return int64(len(dq.delivered))
+}
+
+// Disposed returns a bool indicating if this queue has been disposed.
+func (dq *DurableQueue) Disposed() bool {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	return dq.disposed
+}
+
+// Dispose closes the log and releases the queue's memory.  Any waiting
+// or subsequent calls to Get or Put will return an error.  The log is
+// left on disk, so opening the same directory again recovers every
+// item that was not acknowledged.
+func (dq *DurableQueue) Dispose() {
+	dq.lock.Lock()
+	defer dq.lock.Unlock()
+
+	if dq.disposed {
+		return
+	}
+
+	dq.disposed = true
+	dq.pushed.broadcast()
+	dq.file.Close()
+	dq.file = nil
+	dq.segments = nil
+	dq.pending = nil
+	dq.delivered = nil
+}
+
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+
+	return d.Sync()
+}
+
+// OpenDurableQueue opens the durable queue kept in the provided
+// directory, creating the directory if needed, and replays any items
+// that were not acknowledged.  Items are converted to and from bytes
+// with the provided codec.  A new log segment is started once the
+// current one reaches segmentSize bytes; a size less than one uses
+// DefaultSegmentSize.  Only one queue may have a directory open at a
+// time.
+func OpenDurableQueue(dir string, codec Codec, segmentSize int64) (*DurableQueue, error) {
+	if segmentSize < 1 {
+		segmentSize = DefaultSegmentSize
+	}
+
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	dq := &DurableQueue{
+		dir:         dir,
+		codec:       codec,
+		segmentSize: segmentSize,
+		nextID:      1,
+		delivered:   make(map[uint64]*durableEntry),
+	}
+	if err := dq.replay(); err != nil {
+		if dq.file != nil {
+			dq.file.Close()
+		}
+		return nil, err
+	}
+
+	return dq, nil
+}
@@ -0,0 +1,319 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func tempQueueDir(t *testing.T) string {
+	dir, err := os.MkdirTemp("", "queue")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+
+	return dir
+}
+
+func openDurable(t *testing.T, dir string, segmentSize int64) *DurableQueue {
+	dq, err := OpenDurableQueue(dir, BytesCodec{}, segmentSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dq
+}
+
+func durableStrings(items []DurableItem) []string {
+	result := make([]string, 0, len(items))
+	for _, item := range items {
+		result = append(result, string(item.Item.([]byte)))
+	}
+
+	return result
+}
+
+func segmentCount(t *testing.T, dir string) int {
+	paths, err := filepath.Glob(filepath.Join(dir, `*`+segmentSuffix))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return len(paths)
+}
+
+func TestDurableQueuePutGet(t *testing.T) {
+	dq := openDurable(t, tempQueueDir(t), 0)
+	defer dq.Dispose()
+
+	assert.Nil(t, dq.Put([]byte(`a`), []byte(`b`), []byte(`c`)))
+	assert.Equal(t, int64(3), dq.Len())
+
+	result, err := dq.Get(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`a`, `b`}, durableStrings(result))
+	assert.Equal(t, uint64(1), result[0].ID)
+	assert.Equal(t, uint64(2), result[1].ID)
+	assert.Equal(t, int64(1), dq.Len())
+	assert.Equal(t, int64(2), dq.Unacked())
+
+	assert.Nil(t, dq.Ack(result[0].ID, result[1].ID, 42))
+	assert.Equal(t, int64(0), dq.Unacked())
+}
+
+func TestDurableQueueReplaysUnacked(t *testing.T) {
+	dir := tempQueueDir(t)
+	dq := openDurable(t, dir, 0)
+
+	dq.Put([]byte(`a`), []byte(`b`), []byte(`c`), []byte(`d`))
+	result, _ := dq.Get(3)
+	dq.Ack(result[1].ID)
+	dq.Dispose()
+
+	dq = openDurable(t, dir, 0)
+	assert.Equal(t, int64(3), dq.Len())
+	result, err := dq.Get(10)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{`a`, `c`, `d`}, durableStrings(result))
+	assert.Equal(t, []uint64{1, 3, 4}, []uint64{result[0].ID, result[1].ID, result[2].ID})
+
+	// new items never reuse an ID
+	dq.Put([]byte(`e`))
+	dq.Ack(1, 3, 4)
+	result, _ = dq.Get(1)
+	assert.Equal(t, uint64(5), result[0].ID)
+	dq.Dispose()
+}
+
+func TestDurableQueueCompacts(t *testing.T) {
+	dir := tempQueueDir(t)
+	dq := openDurable(t, dir, 64)
+
+	for i := 0; i < 20; i++ {
+		assert.Nil(t, dq.Put([]byte(`0123456789`)))
+	}
+	assert.True(t, segmentCount(t, dir) > 5)
+
+	result, _ := dq.Get(19)
+	ids := make([]uint64, 0, len(result))
+	for _, item := range result {
+		ids = append(ids, item.ID)
+	}
+	assert.Nil(t, dq.Ack(ids...))
+	assert.True(t, segmentCount(t, dir) <= 2)
+	dq.Dispose()
+
+	dq = openDurable(t, dir, 64)
+	result, _ = dq.Get(10)
+	assert.Len(t, result, 1)
+	assert.Equal(t, uint64(20), result[0].ID)
+	dq.Ack(result[0].ID)
+	dq.Put([]byte(`x`))
+	assert.True(t, segmentCount(t, dir) <= 2)
+	dq.Dispose()
+
+	dq = openDurable(t, dir, 64)
+	result, _ = dq.Get(10)
+	assert.Equal(t, []string{`x`}, durableStrings(result))
+	assert.Equal(t, uint64(21), result[0].ID)
+	dq.Dispose()
+}
+
+func TestDurableQueueTornWrite(t *testing.T) {
+	dir := tempQueueDir(t)
+	dq := openDurable(t, dir, 0)
+	dq.Put([]byte(`a`), []byte(`b`))
+	dq.Dispose()
+
+	paths, _ := filepath.Glob(filepath.Join(dir, `*`+segmentSuffix))
+	info, _ := os.Stat(paths[0])
+	assert.Nil(t, os.Truncate(paths[0], info.Size()-1))
+
+	dq = openDurable(t, dir, 0)
+	result, _ := dq.Get(10)
+	assert.Equal(t, []string{`a`}, durableStrings(result))
+
+	dq.Put([]byte(`c`))
+	dq.Dispose()
+
+	dq = openDurable(t, dir, 0)
+	result, _ = dq.Get(10)
+	assert.Equal(t, []string{`a`, `c`}, durableStrings(result))
+	dq.Dispose()
+}
+
+func TestDurableQueueCorruptSegment(t *testing.T) {
+	dir := tempQueueDir(t)
+	dq := openDurable(t, dir, 32)
+	dq.Put([]byte(`0123456789`))
+	dq.Put([]byte(`0123456789`))
+	dq.Dispose()
+
+	paths, _ := filepath.Glob(filepath.Join(dir, `*`+segmentSuffix))
+	if !assert.True(t, len(paths) > 1) {
+		return
+	}
+	data, _ := os.ReadFile(paths[0])
+	data[len(data)-1] ^= 0xff
+	os.WriteFile(paths[0], data, 0644)
+
+	_, err := OpenDurableQueue(dir, BytesCodec{}, 32)
+	assert.IsType(t, CorruptLogError(``), err)
+}
+
+func TestDurableQueueCorruptNewestSegment(t *testing.T) {
+	dir := tempQueueDir(t)
+	dq := openDurable(t, dir, 0)
+	dq.Put([]byte(`a`), []byte(`b`), []byte(`c`))
+	dq.Dispose()
+
+	paths, _ := filepath.Glob(filepath.Join(dir, `*`+segmentSuffix))
+	data, _ := os.ReadFile(paths[0])
+
+	// damage to a record followed by other records is not a torn
+	// write, so nothing is truncated
+	damaged := append([]byte(nil), data...)
+	damaged[len(damaged)-recordHeaderSize-2] ^= 0xff
+	os.WriteFile(paths[0], damaged, 0644)
+	_, err := OpenDurableQueue(dir, BytesCodec{}, 0)
+	assert.IsType(t, CorruptLogError(``), err)
+	info, _ := os.Stat(paths[0])
+	assert.Equal(t, int64(len(data)), info.Size())
+
+	// damage to the final record is
+	damaged = append([]byte(nil), data...)
+	damaged[len(damaged)-1] ^= 0xff
+	os.WriteFile(paths[0], damaged, 0644)
+	dq = openDurable(t, dir, 0)
+	result, _ := dq.Get(10)
+	assert.Equal(t, []string{`a`, `b`}, durableStrings(result))
+	dq.Dispose()
+
+	// as is a zeroed tail
+	damaged = append(data[:len(data)-recordHeaderSize-1], make([]byte, 64)...)
+	os.WriteFile(paths[0], damaged, 0644)
+	dq = openDurable(t, dir, 0)
+	result, _ = dq.Get(10)
+	assert.Equal(t, []string{`a`, `b`}, durableStrings(result))
+	dq.Dispose()
+}
+
+func TestDurableQueueCompactsAroundUnacked(t *testing.T) {
+	dir := tempQueueDir(t)
+	dq := openDurable(t, dir, 256)
+
+	// an item that is never acknowledged
+	dq.Put([]byte(`stuck`))
+	stuck, _ := dq.Get(1)
+	dq.Put([]byte(`pending`))
+
+	for i := 0; i < 200; i++ {
+		assert.Nil(t, dq.Put([]byte(`0123456789`)))
+		result, _ := dq.Get(1)
+		if i == 0 {
+			assert.Equal(t, []string{`pending`}, durableStrings(result))
+			continue
+		}
+		assert.Nil(t, dq.Ack(result[0].ID))
+	}
+	assert.True(t, segmentCount(t, dir) <= 3, `%d segments`, segmentCount(t, dir))
+	assert.Equal(t, int64(2), dq.Unacked())
+	dq.Dispose()
+
+	// copied items are replayed in the order they were put
+	dq = openDurable(t, dir, 256)
+	dq.Put([]byte(`last`))
+	result, _ := dq.Get(4)
+	assert.Equal(t, []string{`stuck`, `pending`, `0123456789`, `last`}, durableStrings(result))
+	assert.Equal(t, stuck[0].ID, result[0].ID)
+	dq.Dispose()
+}
+
+func TestDurableQueueCodecError(t *testing.T) {
+	dq := openDurable(t, tempQueueDir(t), 0)
+	defer dq.Dispose()
+
+	assert.NotNil(t, dq.Put([]byte(`a`), `not bytes`))
+	assert.Equal(t, int64(0), dq.Len())
+}
+
+func TestDurableQueueBlockingGet(t *testing.T) {
+	dq := openDurable(t, tempQueueDir(t), 0)
+
+	done := make(chan []DurableItem)
+	go func() {
+		result, _ := dq.Get(1)
+		done <- result
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	dq.Put([]byte(`a`))
+	assert.Equal(t, []string{`a`}, durableStrings(<-done))
+
+	_, err := dq.Poll(1, time.Millisecond)
+	assert.IsType(t, TimeoutError{}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = dq.GetWithContext(ctx, 1)
+	assert.Equal(t, context.Canceled, err)
+
+	errs := make(chan error)
+	go func() {
+		_, err := dq.Get(1)
+		errs <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	dq.Dispose()
+	assert.IsType(t, DisposedError{}, <-errs)
+	assert.True(t, dq.Disposed())
+	assert.IsType(t, DisposedError{}, dq.Put([]byte(`b`)))
+	assert.IsType(t, DisposedError{}, dq.Ack(1))
+}
+
+func BenchmarkDurableQueue(b *testing.B) {
+	dir, err := os.MkdirTemp("", "queue")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	dq, err := OpenDurableQueue(dir, BytesCodec{}, 0)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer dq.Dispose()
+
+	item := make([]byte, 100)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		dq.Put(item)
+		result, _ := dq.Get(1)
+		dq.Ack(result[0].ID)
+	}
+}
@@ -16,8 +16,46 @@ limitations under the License.
 
 package queue
 
+import "fmt"
+
 type DisposedError struct{}
 
 func (de DisposedError) Error() string {
 	return `Queue has been disposed.`
 }
+
+// TimeoutError is returned by Poll when no items arrive before the
+// timeout elapses.
+type TimeoutError struct{}
+
+func (te TimeoutError) Error() string {
+	return `Queue poll timed out.`
+}
+
+// FullError is returned by Put on a bounded queue that cannot hold
+// the provided items when the queue fails when full, and by Insert on
+// a bounded priority queue that dropped the inserted item to make
+// room.
+type FullError struct{}
+
+func (fe FullError) Error() string {
+	return `Queue is full.`
+}
+
+// CorruptLogError is returned when opening a durable queue whose log
+// is damaged anywhere other than a partly written final record in its
+// newest segment.
+type CorruptLogError string
+
+func (cle CorruptLogError) Error() string {
+	return fmt.Sprintf(`Queue log segment %s is corrupt.`, string(cle))
+}
+
+// LeaseExpiredError is returned when acknowledging an item from a
+// reliable queue whose lease is no longer held, either because its
+// visibility timeout passed or because it was already acknowledged.
+type LeaseExpiredError struct{}
+
+func (lee LeaseExpiredError) Error() string {
+	return `Lease has expired.`
+}
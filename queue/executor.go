@@ -0,0 +1,275 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// task is an item of a batch waiting in a worker's deque.
+type task struct {
+	batch *batch
+	item  interface{}
+	// index is the position of the item in its batch.
+	index int
+}
+
+// batch tracks the items handed to a single call to Execute.
+type batch struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	fn     func(interface{}) error
+	wg     sync.WaitGroup
+	once   sync.Once
+	err    error
+	// skipped marks the items that were never started.  Every task
+	// writes only its own index.
+	skipped []bool
+}
+
+// fail records the first error of the batch and stops the rest of it.
+func (b *batch) fail(err error) {
+	b.once.Do(func() {
+		b.err = err
+		b.cancel()
+	})
+}
+
+// run calls the batch's function with the task's item unless the batch
+// has already stopped, in which case the item is marked as skipped.
+func (b *batch) run(t *task) {
+	defer b.wg.Done()
+
+	if err := b.ctx.Err(); err != nil {
+		b.fail(err)
+		b.skipped[t.index] = true
+		return
+	}
+
+	if err := b.fn(t.item); err != nil {
+		b.fail(err)
+	}
+}
+
+// Executor calls a function with each of a batch of items on a pool
+// of long-lived workers.  Each worker has its own deque.  A batch is
+// split into contiguous shares that are pushed to the back of the
+// workers' deques, every worker works from the front of its own deque,
+// and once its deque is empty it steals from the back of the other
+// workers' deques, so a worker that draws slow items does not hold up
+// the whole batch.  Several batches may run at once.  The workers run
+// until the executor is disposed.
+type Executor struct {
+	deques []*Deque
+	lock   sync.Mutex
+	// queued is the number of tasks in the deques.  It is raised under
+	// the lock and lowered atomically as tasks are popped.
+	queued  int64
+	arrived roomSignal
+	// share is the deque the next share of a batch is pushed to.
+	share    int
+	disposed bool
+}
+
+// Workers returns the number of workers used for each batch.
+func (e *Executor) Workers() int {
+	return len(e.deques)
+}
+
+// Execute calls fn with each of the provided items and waits for
+// every call to finish.  If fn returns an error or the provided
+// context is done before every item has been started, no further items
+// are started and the first such error is returned.  A DisposedError
+// is returned if the executor has been disposed.
+func (e *Executor) Execute(ctx context.Context, items []interface{}, fn func(interface{}) error) error {
+	_, err := e.execute(ctx, items, fn)
+	return err
+}
+
+// execute is Execute that also returns the items that were never
+// started, in the order they were provided.
+func (e *Executor) execute(ctx context.Context, items []interface{}, fn func(interface{}) error) ([]interface{}, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	b := &batch{
+		ctx:     ctx,
+		cancel:  cancel,
+		fn:      fn,
+		skipped: make([]bool, len(items)),
+	}
+	b.wg.Add(len(items))
+
+	e.lock.Lock()
+	if e.disposed {
+		e.lock.Unlock()
+		return items, DisposedError{}
+	}
+
+	shares := len(e.deques)
+	if shares > len(items) {
+		shares = len(items)
+	}
+
+	for i := 0; i < shares; i++ {
+		start, stop := i*len(items)/shares, (i+1)*len(items)/shares
+		tasks := make([]interface{}, 0, stop-start)
+		for j := start; j < stop; j++ {
+			tasks = append(tasks, &task{batch: b, item: items[j], index: j})
+		}
+
+		// spread small batches over all of the workers
+		e.deques[e.share].PushBack(tasks...)
+		e.share = (e.share + 1) % len(e.deques)
+	}
+
+	atomic.AddInt64(&e.queued, int64(len(items)))
+	e.arrived.broadcast()
+	e.lock.Unlock()
+
+	b.wg.Wait()
+	if b.err == nil {
+		return nil, nil
+	}
+
+	var unstarted []interface{}
+	for i, skipped := range b.skipped {
+		if skipped {
+			unstarted = append(unstarted, items[i])
+		}
+	}
+
+	return unstarted, b.err
+}
+
+// ExecuteQueue calls fn with each item currently in the provided
+// queue, as Execute does.  The items are taken from the queue but the
+// queue is not disposed, so it can continue to be used.  If fn returns
+// an error, the provided context is done or the executor has been
+// disposed, the items that were never started are put back at the
+// front of the queue, in their original order, unless the queue has
+// been disposed in the meantime.  A DisposedError is returned if the
+// queue has already been disposed.
+func (e *Executor) ExecuteQueue(ctx context.Context, q *Queue, fn func(interface{}) error) error {
+	items, err := q.TakeUntil(func(interface{}) bool {
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	unstarted, err := e.execute(ctx, items, fn)
+	q.requeue(unstarted)
+	return err
+}
+
+// take returns the next task for the worker with the provided id,
+// stealing from another worker if its own deque is empty.  The
+// returned bool is false if every deque is empty.
+func (e *Executor) take(id int) (*task, bool) {
+	if item, ok := e.deques[id].TryPopFront(); ok {
+		return item.(*task), true
+	}
+
+	for i := 1; i < len(e.deques); i++ {
+		victim := e.deques[(id+i)%len(e.deques)]
+		if item, ok := victim.TryPopBack(); ok {
+			return item.(*task), true
+		}
+	}
+
+	return nil, false
+}
+
+// work runs tasks for the worker with the provided id until the
+// executor is disposed and no tasks are left.
+func (e *Executor) work(id int) {
+	for {
+		if t, ok := e.take(id); ok {
+			atomic.AddInt64(&e.queued, -1)
+			t.batch.run(t)
+			continue
+		}
+
+		e.lock.Lock()
+		if atomic.LoadInt64(&e.queued) > 0 {
+			// a batch arrived after the deques were checked, or
+			// another worker has taken a task but not yet counted it
+			e.lock.Unlock()
+			runtime.Gosched()
+			continue
+		}
+
+		if e.disposed {
+			e.lock.Unlock()
+			return
+		}
+
+		wait := e.arrived.wait()
+		e.lock.Unlock()
+		<-wait
+	}
+}
+
+// Disposed returns a bool indicating if this executor has been
+// disposed.
+func (e *Executor) Disposed() bool {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	return e.disposed
+}
+
+// Dispose stops the workers once they have finished the batches that
+// are already running.  Batches executed afterwards return a
+// DisposedError without starting any items.
+func (e *Executor) Dispose() {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	e.disposed = true
+	e.arrived.broadcast()
+}
+
+// NewExecutor is the constructor for an executor that runs batches on
+// the provided number of workers, which are started right away.  A
+// number less than one uses one worker per CPU.  The executor should
+// be disposed once it is no longer needed to stop its workers.
+func NewExecutor(workers int) *Executor {
+	if workers < 1 {
+		workers = runtime.NumCPU()
+	}
+
+	e := &Executor{
+		deques: make([]*Deque, workers),
+	}
+	for i := range e.deques {
+		e.deques[i] = NewDeque(0)
+	}
+	for i := range e.deques {
+		go e.work(i)
+	}
+
+	return e
+}
@@ -0,0 +1,278 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"errors"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExecutorExecute(t *testing.T) {
+	e := NewExecutor(4)
+	assert.Equal(t, 4, e.Workers())
+
+	items := make([]interface{}, 0, 100)
+	for i := 0; i < 100; i++ {
+		items = append(items, i)
+	}
+
+	var lock sync.Mutex
+	seen := make(map[interface{}]int)
+	err := e.Execute(context.Background(), items, func(item interface{}) error {
+		lock.Lock()
+		defer lock.Unlock()
+		seen[item]++
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Len(t, seen, 100)
+	for _, count := range seen {
+		assert.Equal(t, 1, count)
+	}
+}
+
+func TestExecutorDefaultWorkers(t *testing.T) {
+	assert.True(t, NewExecutor(0).Workers() > 0)
+	assert.Nil(t, NewExecutor(0).Execute(context.Background(), nil, nil))
+}
+
+func TestExecutorSteals(t *testing.T) {
+	e := NewExecutor(2)
+	items := make([]interface{}, 0, 20)
+	for i := 0; i < 20; i++ {
+		items = append(items, i)
+	}
+
+	// the first worker's share starts with an item that blocks until
+	// the rest of the batch is done, so the second worker must steal
+	// every other item
+	var done int64
+	err := e.Execute(context.Background(), items, func(item interface{}) error {
+		if item == 0 {
+			for atomic.LoadInt64(&done) < 19 {
+				time.Sleep(time.Millisecond)
+			}
+			return nil
+		}
+
+		atomic.AddInt64(&done, 1)
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(19), done)
+}
+
+func TestExecutorError(t *testing.T) {
+	e := NewExecutor(2)
+	items := make([]interface{}, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		items = append(items, i)
+	}
+
+	expected := errors.New(`failed`)
+	var calls int64
+	err := e.Execute(context.Background(), items, func(item interface{}) error {
+		atomic.AddInt64(&calls, 1)
+		if item == 10 {
+			return expected
+		}
+		return nil
+	})
+
+	assert.Equal(t, expected, err)
+	assert.True(t, atomic.LoadInt64(&calls) < 1000)
+}
+
+func TestExecutorContext(t *testing.T) {
+	e := NewExecutor(2)
+	items := []interface{}{1, 2, 3, 4}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	err := e.Execute(ctx, items, func(item interface{}) error {
+		cancel()
+		return nil
+	})
+
+	assert.Equal(t, context.Canceled, err)
+}
+
+func TestExecutorContextAfterLastItem(t *testing.T) {
+	e := NewExecutor(1)
+	defer e.Dispose()
+
+	// a context done once every item has started is not an error
+	ctx, cancel := context.WithCancel(context.Background())
+	err := e.Execute(ctx, []interface{}{1, 2, 3, 4}, func(item interface{}) error {
+		if item == 4 {
+			cancel()
+		}
+		return nil
+	})
+
+	assert.Nil(t, err)
+}
+
+func TestExecutorReusesWorkers(t *testing.T) {
+	e := NewExecutor(4)
+	items := make([]interface{}, 0, 100)
+	for i := 0; i < 100; i++ {
+		items = append(items, i)
+	}
+
+	var calls int64
+	fn := func(interface{}) error {
+		atomic.AddInt64(&calls, 1)
+		return nil
+	}
+
+	// batches run on the workers started by the constructor
+	goroutines := runtime.NumGoroutine()
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, e.Execute(context.Background(), items, fn))
+	}
+	assert.True(t, runtime.NumGoroutine() <= goroutines)
+
+	// several batches can run at once
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.Nil(t, e.Execute(context.Background(), items, fn))
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int64(2000), calls)
+
+	e.Dispose()
+	assert.True(t, e.Disposed())
+	assert.IsType(t, DisposedError{}, e.Execute(context.Background(), items, nil))
+
+	q := New(3)
+	q.Put(1, 2, 3)
+	assert.IsType(t, DisposedError{}, e.ExecuteQueue(context.Background(), q, nil))
+	result, _ := q.Get(10)
+	assert.Equal(t, []interface{}{1, 2, 3}, result)
+}
+
+func TestExecutorExecuteQueue(t *testing.T) {
+	q := New(10)
+	for i := 0; i < 10; i++ {
+		q.Put(i)
+	}
+
+	var sum int64
+	err := NewExecutor(3).ExecuteQueue(context.Background(), q, func(item interface{}) error {
+		atomic.AddInt64(&sum, int64(item.(int)))
+		return nil
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, int64(45), sum)
+	assert.False(t, q.Disposed())
+	assert.True(t, q.Empty())
+
+	q.Dispose()
+	err = NewExecutor(3).ExecuteQueue(context.Background(), q, func(interface{}) error {
+		return nil
+	})
+	assert.IsType(t, DisposedError{}, err)
+}
+
+func TestExecutorExecuteQueueRequeues(t *testing.T) {
+	q := New(100)
+	for i := 0; i < 100; i++ {
+		q.Put(i)
+	}
+
+	expected := errors.New(`failed`)
+	var started int64
+	err := NewExecutor(4).ExecuteQueue(context.Background(), q, func(item interface{}) error {
+		atomic.AddInt64(&started, 1)
+		if item.(int)%25 == 5 {
+			return expected
+		}
+		return nil
+	})
+
+	// whatever was not started is back in the queue, in order
+	assert.Equal(t, expected, err)
+	assert.Equal(t, 100-atomic.LoadInt64(&started), q.Len())
+	result, _ := q.TakeUntil(func(interface{}) bool {
+		return true
+	})
+	for i := 1; i < len(result); i++ {
+		assert.True(t, result[i-1].(int) < result[i].(int))
+	}
+
+	// unstarted items go ahead of anything put since they were taken
+	q.Put(1, 2, 3)
+	err = NewExecutor(1).ExecuteQueue(context.Background(), q, func(item interface{}) error {
+		q.Put(4)
+		return expected
+	})
+	assert.Equal(t, expected, err)
+	result, _ = q.Get(10)
+	assert.Equal(t, []interface{}{2, 3, 4}, result)
+
+	// a done context starts nothing
+	q.Put(1, 2, 3)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err = NewExecutor(2).ExecuteQueue(ctx, q, func(interface{}) error {
+		return nil
+	})
+	assert.Equal(t, context.Canceled, err)
+	result, _ = q.Get(10)
+	assert.Equal(t, []interface{}{1, 2, 3}, result)
+}
+
+func TestExecutorExecuteQueueRequeuesPastCapacity(t *testing.T) {
+	// requeued items are not dropped, even by a queue that drops items
+	// to stay within its capacity
+	for _, policy := range []OverflowPolicy{DropOldest, DropLowest} {
+		q := NewBounded(3, policy)
+		q.Put(1, 2, 3)
+		err := NewExecutor(1).ExecuteQueue(context.Background(), q, func(item interface{}) error {
+			q.Put(4, 5, 6)
+			return errors.New(`failed`)
+		})
+		assert.NotNil(t, err)
+
+		result, _ := q.Get(10)
+		assert.Equal(t, []interface{}{2, 3, 4, 5, 6}, result)
+	}
+}
+
+func BenchmarkExecutor(b *testing.B) {
+	items := make([]interface{}, b.N)
+	e := NewExecutor(0)
+	b.ResetTimer()
+
+	e.Execute(context.Background(), items, func(interface{}) error {
+		return nil
+	})
+}
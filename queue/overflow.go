@@ -0,0 +1,68 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+// OverflowPolicy determines what a bounded queue does when items are
+// put to it while it is full.
+type OverflowPolicy int
+
+const (
+	// BlockWhenFull makes Put wait for items to be taken from the
+	// queue.  Items are added as room becomes available, so a put
+	// that gives up may have added some of its items.
+	BlockWhenFull OverflowPolicy = iota
+	// FailWhenFull makes Put return a FullError, without adding any
+	// items, if the queue cannot hold every item.
+	FailWhenFull
+	// DropOldest makes Put add every item and then discard the items
+	// that have been in the queue longest until it is back at
+	// capacity.  For a queue these are the items at its front.  For a
+	// priority queue they are the items put earliest, whatever their
+	// priority, and finding them takes a scan of the queue.
+	DropOldest
+	// DropLowest makes Put add every item and then discard the items
+	// that would be retrieved last until the queue is back at
+	// capacity.  For a priority queue these are the items with the
+	// lowest priority.  For a queue they are the items at its back, so
+	// the items that do not fit are not added.
+	DropLowest
+)
+
+// roomSignal wakes putters blocked on a full queue when items are
+// taken from it, getters of a delay queue when its earliest item
+// changes and idle executor workers when a batch arrives.  It is only
+// used under the lock of its owner.
+type roomSignal struct {
+	ch chan struct{}
+}
+
+// wait returns a channel that is closed the next time room is made.
+func (rs *roomSignal) wait() <-chan struct{} {
+	if rs.ch == nil {
+		rs.ch = make(chan struct{})
+	}
+
+	return rs.ch
+}
+
+// broadcast wakes every putter waiting for room.
+func (rs *roomSignal) broadcast() {
+	if rs.ch != nil {
+		close(rs.ch)
+		rs.ch = nil
+	}
+}
@@ -0,0 +1,245 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBoundedFailWhenFull(t *testing.T) {
+	q := NewBounded(2, FailWhenFull)
+
+	assert.Nil(t, q.Put(`a`, `b`))
+	assert.IsType(t, FullError{}, q.Put(`c`))
+	assert.Equal(t, int64(2), q.Len())
+
+	q.Get(1)
+	assert.IsType(t, FullError{}, q.Put(`c`, `d`))
+	assert.Nil(t, q.Put(`c`))
+
+	result, _ := q.Get(2)
+	assert.Equal(t, []interface{}{`b`, `c`}, result)
+}
+
+func TestBoundedDropOldest(t *testing.T) {
+	q := NewBounded(2, DropOldest)
+
+	assert.Nil(t, q.Put(`a`, `b`, `c`))
+	assert.Nil(t, q.Put(`d`))
+
+	result, _ := q.Get(5)
+	assert.Equal(t, []interface{}{`c`, `d`}, result)
+}
+
+func TestBoundedDropLowest(t *testing.T) {
+	q := NewBounded(2, DropLowest)
+
+	assert.Nil(t, q.Put(`a`, `b`, `c`))
+	assert.Nil(t, q.Put(`d`))
+
+	result, _ := q.Get(5)
+	assert.Equal(t, []interface{}{`a`, `b`}, result)
+}
+
+func TestBoundedPutFront(t *testing.T) {
+	// items put at the front are not the oldest, so DropOldest keeps
+	// them and discards the items that were already at the front
+	q := NewBounded(3, DropOldest)
+	q.Put(`c`, `d`, `e`)
+	assert.Nil(t, q.PutFront(`a`, `b`))
+	result, _ := q.Get(5)
+	assert.Equal(t, []interface{}{`a`, `b`, `e`}, result)
+
+	q = NewBounded(2, DropOldest)
+	q.Put(`d`)
+	assert.Nil(t, q.PutFront(`a`, `b`, `c`))
+	result, _ = q.Get(5)
+	assert.Equal(t, []interface{}{`a`, `b`}, result)
+
+	q = NewBounded(3, DropLowest)
+	q.Put(`c`, `d`, `e`)
+	assert.Nil(t, q.PutFront(`a`, `b`))
+	result, _ = q.Get(5)
+	assert.Equal(t, []interface{}{`a`, `b`, `c`}, result)
+
+	q = NewBounded(2, FailWhenFull)
+	q.Put(`c`)
+	assert.IsType(t, FullError{}, q.PutFront(`a`, `b`))
+	assert.Nil(t, q.PutFront(`b`))
+	result, _ = q.Get(5)
+	assert.Equal(t, []interface{}{`b`, `c`}, result)
+}
+
+func TestBoundedPutFrontBlocks(t *testing.T) {
+	q := NewBounded(2, BlockWhenFull)
+	q.Put(`x`)
+
+	done := make(chan error)
+	go func() {
+		done <- q.PutFront(`a`, `b`, `c`)
+	}()
+
+	// the items go in as room is made but keep their order
+	var result []interface{}
+	for len(result) < 4 {
+		items, err := q.GetBack(1)
+		assert.Nil(t, err)
+		result = append(result, items...)
+	}
+	assert.Nil(t, <-done)
+	assert.Equal(t, []interface{}{`x`, `c`, `b`, `a`}, result)
+}
+
+func TestBoundedBlockWhenFull(t *testing.T) {
+	q := NewBounded(2, BlockWhenFull)
+	q.Put(`a`, `b`)
+
+	done := make(chan error)
+	go func() {
+		done <- q.Put(`c`, `d`, `e`)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal(`put should block on a full queue`)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	result := make([]interface{}, 0, 5)
+	for len(result) < 5 {
+		items, err := q.Get(1)
+		assert.Nil(t, err)
+		result = append(result, items...)
+	}
+
+	assert.Nil(t, <-done)
+	assert.Equal(t, []interface{}{`a`, `b`, `c`, `d`, `e`}, result)
+}
+
+func TestBoundedPutWithContext(t *testing.T) {
+	q := NewBounded(1, BlockWhenFull)
+	q.Put(`a`)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.Equal(t, context.DeadlineExceeded, q.PutWithContext(ctx, `b`))
+	assert.Equal(t, int64(1), q.Len())
+}
+
+func TestBoundedPutWithDispose(t *testing.T) {
+	q := NewBounded(1, BlockWhenFull)
+	q.Put(`a`)
+
+	done := make(chan error)
+	go func() {
+		done <- q.Put(`b`)
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Dispose()
+	assert.IsType(t, DisposedError{}, <-done)
+}
+
+func TestBoundedManyProducers(t *testing.T) {
+	q := NewBounded(4, BlockWhenFull)
+	var wg sync.WaitGroup
+	wg.Add(4)
+	for i := 0; i < 4; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				q.Put(i*100 + j)
+				assert.True(t, q.Len() <= 4)
+			}
+		}(i)
+	}
+
+	seen := make(map[interface{}]bool)
+	for len(seen) < 400 {
+		items, err := q.Get(3)
+		assert.Nil(t, err)
+		for _, item := range items {
+			seen[item] = true
+		}
+	}
+	wg.Wait()
+
+	assert.Len(t, seen, 400)
+}
+
+func TestBoundedPriorityQueue(t *testing.T) {
+	pq := NewBoundedPriorityQueue(2, FailWhenFull)
+	assert.Nil(t, pq.Put(mockItem(3), mockItem(1)))
+	assert.IsType(t, FullError{}, pq.Put(mockItem(2)))
+
+	pq = NewBoundedPriorityQueue(2, DropLowest)
+	pq.Put(mockItem(3), mockItem(1), mockItem(2))
+	pq.Put(mockItem(4))
+	result, _ := pq.Get(5)
+	assert.Equal(t, []Item{mockItem(1), mockItem(2)}, result)
+
+	// the oldest items go whatever their priority
+	pq = NewBoundedPriorityQueue(2, DropOldest)
+	pq.Put(mockItem(3), mockItem(1), mockItem(2))
+	pq.Put(mockItem(4))
+	result, _ = pq.Get(5)
+	assert.Equal(t, []Item{mockItem(2), mockItem(4)}, result)
+
+	pq = NewBoundedPriorityQueue(1, BlockWhenFull)
+	pq.Put(mockItem(2))
+	done := make(chan error)
+	go func() {
+		done <- pq.Put(mockItem(1))
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	result, _ = pq.Get(1)
+	assert.Equal(t, []Item{mockItem(2)}, result)
+	assert.Nil(t, <-done)
+	result, _ = pq.Get(1)
+	assert.Equal(t, []Item{mockItem(1)}, result)
+
+	pq.Put(mockItem(1))
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, pq.PutWithContext(ctx, mockItem(3)))
+}
+
+func BenchmarkBoundedQueue(b *testing.B) {
+	q := NewBounded(100, BlockWhenFull)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			q.Get(1)
+		}
+		wg.Done()
+	}()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		q.Put(i)
+	}
+	wg.Wait()
+}
@@ -24,8 +24,9 @@ would be easier to solve.
 package queue
 
 import (
-	"sort"
+	"context"
 	"sync"
+	"time"
 )
 
 // Item is an item that can be added to the priority queue.
@@ -39,103 +40,386 @@ type Item interface {
 	Compare(other Item) int
 }
 
-type priorityItems []Item
+// Handle refers to an item that has been inserted into a priority
+// queue.  It can be used to change the item's priority or to remove
+// it from the queue while it has not yet been retrieved.
+type Handle struct {
+	item Item
+	// index is the position of this handle in the heap, or -1 once
+	// the item has left the queue.
+	index int
+	// sequence orders handles whose items compare as equal by when
+	// they were put.
+	sequence uint64
+	queue    *PriorityQueue
+}
 
-func (items *priorityItems) get(number int) []Item {
-	returnItems := make([]Item, 0, number)
-	index := 0
-	for i := 0; i < number; i++ {
-		if i >= len(*items) {
+// Item returns the item this handle refers to.
+func (h *Handle) Item() Item {
+	h.queue.lock.Lock()
+	defer h.queue.lock.Unlock()
+
+	return h.item
+}
+
+// DefaultArity is the number of children of each node in the heap
+// backing a priority queue unless another arity is requested.
+const DefaultArity = 2
+
+// priorityItems is an indexed d-ary min-heap.  Every handle records
+// its position in the heap so that it can be fixed or removed in
+// logarithmic time.  Items that compare as equal leave the heap in
+// the order they were pushed.
+type priorityItems struct {
+	handles  []*Handle
+	arity    int
+	sequence uint64
+}
+
+func (items *priorityItems) len() int {
+	return len(items.handles)
+}
+
+func (items *priorityItems) less(i, j int) bool {
+	hi, hj := items.handles[i], items.handles[j]
+	if result := hi.item.Compare(hj.item); result != 0 {
+		return result < 0
+	}
+
+	return hi.sequence < hj.sequence
+}
+
+func (items *priorityItems) swap(i, j int) {
+	items.handles[i], items.handles[j] = items.handles[j], items.handles[i]
+	items.handles[i].index = i
+	items.handles[j].index = j
+}
+
+func (items *priorityItems) up(i int) {
+	for i > 0 {
+		parent := (i - 1) / items.arity
+		if !items.less(i, parent) {
 			break
 		}
+		items.swap(i, parent)
+		i = parent
+	}
+}
+
+// down moves the item at i toward the leaves and returns a bool
+// indicating if it moved.
+func (items *priorityItems) down(i int) bool {
+	start := i
+	for {
+		first := items.arity*i + 1
+		if first >= len(items.handles) {
+			break
+		}
+
+		child := first
+		for c := first + 1; c < first+items.arity && c < len(items.handles); c++ {
+			if items.less(c, child) {
+				child = c
+			}
+		}
+		if !items.less(child, i) {
+			break
+		}
+		items.swap(i, child)
+		i = child
+	}
+
+	return i > start
+}
+
+// fix restores the heap after the priority of the item at i changed.
+func (items *priorityItems) fix(i int) {
+	if !items.down(i) {
+		items.up(i)
+	}
+}
+
+func (items *priorityItems) push(h *Handle) {
+	h.index = len(items.handles)
+	h.sequence = items.sequence
+	items.sequence++
+	items.handles = append(items.handles, h)
+	items.up(h.index)
+}
+
+func (items *priorityItems) remove(i int) *Handle {
+	last := len(items.handles) - 1
+	h := items.handles[i]
+	if i != last {
+		items.swap(i, last)
+	}
+
+	items.handles[last] = nil
+	items.handles = items.handles[:last]
+	if i != last {
+		items.fix(i)
+	}
+
+	h.index = -1
+	return h
+}
 
-		returnItems = append(returnItems, (*items)[i])
-		(*items)[i] = nil
-		index++
+func (items *priorityItems) get(number int) []Item {
+	returnItems := make([]Item, 0, number)
+	for i := 0; i < number && len(items.handles) > 0; i++ {
+		returnItems = append(returnItems, items.remove(0).item)
 	}
 
-	*items = (*items)[index:]
 	return returnItems
 }
 
-func (items *priorityItems) insert(item Item) {
-	if len(*items) == 0 {
-		*items = append(*items, item)
-		return
+// removeLowest removes and returns the handle of the item with the
+// lowest priority, which is always one of the leaves.
+func (items *priorityItems) removeLowest() *Handle {
+	lowest := 0
+	if n := len(items.handles); n > 1 {
+		// the first leaf follows the parent of the last item
+		lowest = (n-2)/items.arity + 1
 	}
 
-	equalFound := false
-	i := sort.Search(len(*items), func(i int) bool {
-		result := (*items)[i].Compare(item)
-		if result == 0 {
-			equalFound = true
+	for i := lowest + 1; i < len(items.handles); i++ {
+		if items.less(lowest, i) {
+			lowest = i
 		}
-		return result >= 0
-	})
+	}
 
-	if equalFound {
-		return
+	return items.remove(lowest)
+}
+
+// removeOldest removes and returns the handle of the item that was
+// pushed earliest.  This scans the whole heap.
+func (items *priorityItems) removeOldest() *Handle {
+	oldest := 0
+	for i, h := range items.handles {
+		if h.sequence < items.handles[oldest].sequence {
+			oldest = i
+		}
 	}
 
-	if i == len(*items) {
-		*items = append(*items, item)
-		return
+	return items.remove(oldest)
+}
+
+func newPriorityItems(hint, arity int) priorityItems {
+	if arity < 2 {
+		arity = DefaultArity
 	}
 
-	*items = append(*items, nil)
-	copy((*items)[i+1:], (*items)[i:])
-	(*items)[i] = item
+	return priorityItems{
+		handles: make([]*Handle, 0, hint),
+		arity:   arity,
+	}
 }
 
 // PriorityQueue is similar to queue except that it takes
 // items that implement the Item interface and adds them
-// to the queue in priority order.
+// to the queue in priority order.  Items that compare as equal
+// are retrieved in the order they were put.
 type PriorityQueue struct {
 	waiters     waiters
 	items       priorityItems
 	lock        sync.Mutex
 	disposeLock sync.Mutex
 	disposed    bool
+	// capacity is the most items a bounded queue holds, zero means
+	// the queue is unbounded.
+	capacity int
+	policy   OverflowPolicy
+	room     roomSignal
 }
 
-// Put adds items to the queue.
+// Put adds items to the queue.  Every item is kept, including items
+// that compare as equal to items already in the queue, and equal
+// items are retrieved in the order they were put.  Before the queue
+// was a heap, an item equal to one already in the queue was discarded.
+// If the queue is bounded and full, what happens depends on its
+// overflow policy.
 func (pq *PriorityQueue) Put(items ...Item) error {
+	return pq.PutWithContext(context.Background(), items...)
+}
+
+// PutWithContext is like Put except that a put blocked on a full
+// queue gives up when the provided context is done, in which case the
+// context's error is returned.
+func (pq *PriorityQueue) PutWithContext(ctx context.Context, items ...Item) error {
+	_, err := pq.put(ctx, pq.newHandles(items))
+	return err
+}
+
+// Insert adds an item to the queue like Put and returns a handle
+// that can be used to update or remove the item later.  If the queue
+// drops items when full and the inserted item is the one dropped, a
+// FullError is returned instead of a handle.
+func (pq *PriorityQueue) Insert(item Item) (*Handle, error) {
+	return pq.InsertWithContext(context.Background(), item)
+}
+
+// InsertWithContext is like Insert except that an insert blocked on
+// a full queue gives up when the provided context is done, in which
+// case the context's error is returned.
+func (pq *PriorityQueue) InsertWithContext(ctx context.Context, item Item) (*Handle, error) {
+	handles := pq.newHandles([]Item{item})
+	dropped, err := pq.put(ctx, handles)
+	if err != nil {
+		return nil, err
+	}
+
+	if dropped {
+		return nil, FullError{}
+	}
+
+	return handles[0], nil
+}
+
+func (pq *PriorityQueue) newHandles(items []Item) []*Handle {
+	handles := make([]*Handle, 0, len(items))
+	for _, item := range items {
+		handles = append(handles, &Handle{item: item, index: -1, queue: pq})
+	}
+
+	return handles
+}
+
+// put adds the provided items to the queue and returns a bool
+// indicating if any of them were dropped to make room.
+func (pq *PriorityQueue) put(ctx context.Context, items []*Handle) (bool, error) {
 	if len(items) == 0 {
-		return nil
+		return false, nil
 	}
 
 	pq.lock.Lock()
-	if pq.disposed {
-		pq.lock.Unlock()
-		return DisposedError{}
+
+	dropped := false
+	for len(items) > 0 {
+		if pq.disposed {
+			pq.lock.Unlock()
+			return false, DisposedError{}
+		}
+
+		number := len(items)
+		if pq.capacity > 0 {
+			room := pq.capacity - pq.items.len()
+			switch pq.policy {
+			case FailWhenFull:
+				if number > room {
+					pq.lock.Unlock()
+					return false, FullError{}
+				}
+			case BlockWhenFull:
+				if room <= 0 {
+					roomMade := pq.room.wait()
+					pq.lock.Unlock()
+					select {
+					case <-roomMade:
+					case <-ctx.Done():
+						return false, ctx.Err()
+					}
+					pq.lock.Lock()
+					continue
+				}
+				if number > room {
+					number = room
+				}
+			}
+		}
+
+		first := pq.items.sequence
+		for _, item := range items[:number] {
+			pq.items.push(item)
+		}
+		items = items[number:]
+		if pq.capacity > 0 && pq.drop(first) {
+			dropped = true
+		}
+		pq.handOff()
 	}
 
-	for _, item := range items {
-		pq.items.insert(item)
+	pq.lock.Unlock()
+	return dropped, nil
+}
+
+// drop discards items according to the overflow policy until the
+// queue is back at capacity and returns a bool indicating if any of
+// the items pushed at or after sequence first were discarded.
+func (pq *PriorityQueue) drop(first uint64) bool {
+	var remove func() *Handle
+	switch pq.policy {
+	case DropOldest:
+		remove = pq.items.removeOldest
+	case DropLowest:
+		remove = pq.items.removeLowest
+	default:
+		return false
+	}
+
+	dropped := false
+	for pq.items.len() > pq.capacity {
+		if remove().sequence >= first {
+			dropped = true
+		}
 	}
 
+	return dropped
+}
+
+// handOff passes items to waiting getters until either runs out.
+func (pq *PriorityQueue) handOff() {
 	for {
 		sema := pq.waiters.get()
 		if sema == nil {
 			break
 		}
 
+		if !sema.claim() {
+			continue
+		}
+
 		sema.response.Add(1)
-		sema.wg.Done()
+		sema.ready <- true
 		sema.response.Wait()
-		if len(pq.items) == 0 {
+		if pq.items.len() == 0 {
 			break
 		}
 	}
+}
 
-	pq.lock.Unlock()
-	return nil
+// take removes up to number items from the queue, waking any putters
+// waiting for room.
+func (pq *PriorityQueue) take(number int) []Item {
+	pq.room.broadcast()
+	return pq.items.get(number)
 }
 
 // Get retrieves items from the queue.  If the queue is empty,
 // this call blocks until the next item is added to the queue.  This
 // will attempt to retrieve number of items.
 func (pq *PriorityQueue) Get(number int) ([]Item, error) {
+	return pq.GetWithContext(context.Background(), number)
+}
+
+// Poll is like Get except that it gives up if no items are added to
+// the queue within the provided timeout, in which case a TimeoutError
+// is returned.
+func (pq *PriorityQueue) Poll(number int, timeout time.Duration) ([]Item, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	items, err := pq.GetWithContext(ctx, number)
+	if err == context.DeadlineExceeded {
+		return nil, TimeoutError{}
+	}
+
+	return items, err
+}
+
+// GetWithContext is like Get except that it gives up if the provided
+// context is done before any items are added to the queue, in which
+// case the context's error is returned.
+func (pq *PriorityQueue) GetWithContext(ctx context.Context, number int) ([]Item, error) {
 	if number < 1 {
 		return nil, nil
 	}
@@ -149,13 +433,23 @@ func (pq *PriorityQueue) Get(number int) ([]Item, error) {
 
 	var items []Item
 
-	if len(pq.items) == 0 {
+	if pq.items.len() == 0 {
+		if err := ctx.Err(); err != nil {
+			pq.lock.Unlock()
+			return nil, err
+		}
+
 		sema := newSema()
 		pq.waiters.put(sema)
-		sema.wg.Add(1)
 		pq.lock.Unlock()
 
-		sema.wg.Wait()
+		if !sema.wait(ctx) {
+			pq.lock.Lock()
+			pq.waiters.remove(sema)
+			pq.lock.Unlock()
+			return nil, ctx.Err()
+		}
+
 		pq.disposeLock.Lock()
 		if pq.disposed {
 			pq.disposeLock.Unlock()
@@ -163,12 +457,12 @@ func (pq *PriorityQueue) Get(number int) ([]Item, error) {
 		}
 		pq.disposeLock.Unlock()
 
-		items = pq.items.get(number)
+		items = pq.take(number)
 		sema.response.Done()
 		return items, nil
 	}
 
-	items = pq.items.get(number)
+	items = pq.take(number)
 	pq.lock.Unlock()
 	return items, nil
 }
@@ -177,19 +471,51 @@ func (pq *PriorityQueue) Get(number int) ([]Item, error) {
 func (pq *PriorityQueue) Peek() Item {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
-	if len(pq.items) > 0 {
-		return pq.items[0]
+	if pq.items.len() > 0 {
+		return pq.items.handles[0].item
 	}
 	return nil
 }
 
+// Update replaces the item the provided handle refers to and moves it
+// to its new position in the queue.  The returned bool is false, and
+// nothing is changed, if the item is no longer in this queue.
+func (pq *PriorityQueue) Update(handle *Handle, item Item) bool {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed || handle.queue != pq || handle.index < 0 {
+		return false
+	}
+
+	handle.item = item
+	pq.items.fix(handle.index)
+	return true
+}
+
+// Remove removes the item the provided handle refers to from the
+// queue.  The returned bool is false if the item is no longer in this
+// queue.
+func (pq *PriorityQueue) Remove(handle *Handle) bool {
+	pq.lock.Lock()
+	defer pq.lock.Unlock()
+
+	if pq.disposed || handle.queue != pq || handle.index < 0 {
+		return false
+	}
+
+	pq.items.remove(handle.index)
+	pq.room.broadcast()
+	return true
+}
+
 // Empty returns a bool indicating if there are any items left
 // in the queue.
 func (pq *PriorityQueue) Empty() bool {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
-	return len(pq.items) == 0
+	return pq.items.len() == 0
 }
 
 // Len returns a number indicating how many items are in the queue.
@@ -197,7 +523,7 @@ func (pq *PriorityQueue) Len() int {
 	pq.lock.Lock()
 	defer pq.lock.Unlock()
 
-	return len(pq.items)
+	return pq.items.len()
 }
 
 // Disposed returns a bool indicating if this queue has been disposed.
@@ -218,18 +544,45 @@ func (pq *PriorityQueue) Dispose() {
 	defer pq.disposeLock.Unlock()
 
 	pq.disposed = true
+	pq.room.broadcast()
 	for _, waiter := range pq.waiters {
-		waiter.response.Add(1)
-		waiter.wg.Done()
+		if waiter.claim() {
+			waiter.ready <- true
+		}
 	}
 
-	pq.items = nil
+	pq.items.handles = nil
 	pq.waiters = nil
 }
 
 // NewPriorityQueue is the constructor for a priority queue.
 func NewPriorityQueue(hint int) *PriorityQueue {
+	return NewDaryPriorityQueue(hint, DefaultArity)
+}
+
+// NewDaryPriorityQueue is the constructor for a priority queue backed
+// by a heap in which every node has arity children.  A wider heap is
+// shallower, making puts cheaper and gets more expensive, and keeps
+// more of each get's comparisons within a cache line.  An arity less
+// than two uses the default.
+func NewDaryPriorityQueue(hint, arity int) *PriorityQueue {
+	return &PriorityQueue{
+		items: newPriorityItems(hint, arity),
+	}
+}
+
+// NewBoundedPriorityQueue is the constructor for a priority queue that
+// holds at most capacity items.  Putting to a full queue blocks, fails
+// or drops items according to the provided policy.  A capacity less
+// than one makes the queue unbounded.
+func NewBoundedPriorityQueue(capacity int, policy OverflowPolicy) *PriorityQueue {
+	if capacity < 0 {
+		capacity = 0
+	}
+
 	return &PriorityQueue{
-		items: make(priorityItems, 0, hint),
+		items:    newPriorityItems(capacity, DefaultArity),
+		capacity: capacity,
+		policy:   policy,
 	}
 }
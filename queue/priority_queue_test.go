@@ -17,8 +17,10 @@ limitations under the License.
 package queue
 
 import (
+	"context"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -28,16 +30,19 @@ func TestPriorityPut(t *testing.T) {
 
 	q.Put(mockItem(2))
 
-	assert.Len(t, q.items, 1)
-	assert.Equal(t, mockItem(2), q.items[0])
+	assert.Equal(t, 1, q.Len())
+	assert.Equal(t, mockItem(2), q.Peek())
 
 	q.Put(mockItem(1))
 
-	if !assert.Len(t, q.items, 2) {
+	if !assert.Equal(t, 2, q.Len()) {
 		return
 	}
-	assert.Equal(t, mockItem(1), q.items[0])
-	assert.Equal(t, mockItem(2), q.items[1])
+	assert.Equal(t, mockItem(1), q.Peek())
+
+	result, err := q.Get(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{mockItem(1), mockItem(2)}, result)
 }
 
 func TestPriorityGet(t *testing.T) {
@@ -54,7 +59,7 @@ func TestPriorityGet(t *testing.T) {
 	}
 
 	assert.Equal(t, mockItem(2), result[0])
-	assert.Len(t, q.items, 0)
+	assert.Equal(t, 0, q.Len())
 
 	q.Put(mockItem(2))
 	q.Put(mockItem(1))
@@ -69,7 +74,7 @@ func TestPriorityGet(t *testing.T) {
 	}
 
 	assert.Equal(t, mockItem(1), result[0])
-	assert.Len(t, q.items, 1)
+	assert.Equal(t, 1, q.Len())
 
 	result, err = q.Get(2)
 	if !assert.Nil(t, err) {
@@ -88,7 +93,7 @@ func TestAddEmptyPriorityPut(t *testing.T) {
 
 	q.Put()
 
-	assert.Len(t, q.items, 0)
+	assert.Equal(t, 0, q.Len())
 }
 
 func TestPriorityGetNonPositiveNumber(t *testing.T) {
@@ -243,5 +248,277 @@ func TestInsertDuplicate(t *testing.T) {
 	q.Put(mockItem(1))
 	q.Put(mockItem(1))
 
+	// equal items are kept, and retrieved in the order they were put,
+	// rather than deduplicated
+	assert.Equal(t, 2, q.Len())
+}
+
+func TestPriorityPollTimeout(t *testing.T) {
+	q := NewPriorityQueue(1)
+
+	result, err := q.Poll(1, time.Millisecond)
+	assert.IsType(t, TimeoutError{}, err)
+	assert.Nil(t, result)
+	assert.Len(t, q.waiters, 0)
+
+	q.Put(mockItem(2), mockItem(1))
+	result, err = q.Poll(1, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{mockItem(1)}, result)
+}
+
+func TestPriorityPollReceivesPut(t *testing.T) {
+	q := NewPriorityQueue(1)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Put(mockItem(1))
+	}()
+
+	result, err := q.Poll(1, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []Item{mockItem(1)}, result)
+}
+
+func TestPriorityGetWithContextCancel(t *testing.T) {
+	q := NewPriorityQueue(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var err error
+	go func() {
+		_, err = q.GetWithContext(ctx, 1)
+		wg.Done()
+	}()
+
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, q.waiters, 0)
+
+	q.Put(mockItem(1))
+	assert.Equal(t, 1, q.Len())
+}
+
+func TestPriorityPollWithDispose(t *testing.T) {
+	q := NewPriorityQueue(1)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var err error
+	go func() {
+		_, err = q.Poll(1, time.Second)
+		wg.Done()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Dispose()
+	wg.Wait()
+
+	assert.IsType(t, DisposedError{}, err)
+}
+
+func TestPriorityInsertUpdate(t *testing.T) {
+	q := NewPriorityQueue(3)
+	q.Put(mockItem(2), mockItem(3))
+	handle, err := q.Insert(mockItem(4))
+	assert.Nil(t, err)
+	assert.Equal(t, mockItem(4), handle.Item())
+
+	assert.True(t, q.Update(handle, mockItem(1)))
+	assert.Equal(t, mockItem(1), q.Peek())
+	assert.Equal(t, mockItem(1), handle.Item())
+
+	assert.True(t, q.Update(handle, mockItem(5)))
+	result, _ := q.Get(3)
+	assert.Equal(t, []Item{mockItem(2), mockItem(3), mockItem(5)}, result)
+
+	assert.False(t, q.Update(handle, mockItem(1)))
+	assert.Equal(t, 0, q.Len())
+}
+
+func TestPriorityRemove(t *testing.T) {
+	q := NewPriorityQueue(3)
+	h1, _ := q.Insert(mockItem(1))
+	h2, _ := q.Insert(mockItem(2))
+	h3, _ := q.Insert(mockItem(3))
+
+	assert.True(t, q.Remove(h1))
+	assert.False(t, q.Remove(h1))
+	assert.True(t, q.Remove(h3))
+
+	result, _ := q.Get(3)
+	assert.Equal(t, []Item{mockItem(2)}, result)
+	assert.False(t, q.Remove(h2))
+
+	other := NewPriorityQueue(1)
+	h4, _ := q.Insert(mockItem(4))
+	assert.False(t, other.Remove(h4))
+	assert.False(t, other.Update(h4, mockItem(0)))
+
+	q.Dispose()
+	assert.False(t, q.Remove(h4))
+	_, err := q.Insert(mockItem(5))
+	assert.IsType(t, DisposedError{}, err)
+}
+
+func TestPriorityInsertDuplicate(t *testing.T) {
+	q := NewPriorityQueue(2)
+	h1, err := q.Insert(mockItem(1))
+	assert.Nil(t, err)
+
+	// an equal item is added with its own handle
+	h2, err := q.Insert(mockItem(1))
+	assert.Nil(t, err)
+	assert.False(t, h1 == h2)
+	assert.Equal(t, 2, q.Len())
+
+	assert.True(t, q.Remove(h2))
 	assert.Equal(t, 1, q.Len())
+	assert.True(t, q.Remove(h1))
+	assert.True(t, q.Empty())
+}
+
+func TestPriorityHandlesKeepHeapOrder(t *testing.T) {
+	q := NewPriorityQueue(100)
+	handles := make([]*Handle, 0, 100)
+	for i := 0; i < 100; i++ {
+		handle, _ := q.Insert(mockItem((i * 37) % 100))
+		handles = append(handles, handle)
+	}
+
+	for i := 0; i < 100; i += 3 {
+		q.Remove(handles[i])
+	}
+	for i := 1; i < 100; i += 3 {
+		q.Update(handles[i], mockItem(200+i))
+	}
+
+	result, _ := q.Get(100)
+	assert.Len(t, result, 100-34)
+	for i := 1; i < len(result); i++ {
+		assert.True(t, result[i-1].Compare(result[i]) <= 0)
+	}
+}
+
+func BenchmarkPriorityQueueUpdate(b *testing.B) {
+	q := NewPriorityQueue(1000)
+	handles := make([]*Handle, 0, 1000)
+	for i := 0; i < 1000; i++ {
+		handle, _ := q.Insert(mockItem(i))
+		handles = append(handles, handle)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		q.Update(handles[i%1000], mockItem(i%2000))
+	}
+}
+
+type tiedItem struct {
+	priority int
+	name     string
+}
+
+func (ti tiedItem) Compare(other Item) int {
+	return mockItem(ti.priority).Compare(mockItem(other.(tiedItem).priority))
+}
+
+func TestPriorityFIFOTies(t *testing.T) {
+	for _, arity := range []int{2, 3, 4, 8} {
+		q := NewDaryPriorityQueue(10, arity)
+		q.Put(tiedItem{2, `a`}, tiedItem{1, `b`}, tiedItem{2, `c`})
+		q.Put(tiedItem{1, `d`}, tiedItem{2, `e`}, tiedItem{1, `f`})
+
+		result, _ := q.Get(6)
+		assert.Equal(t, []Item{
+			tiedItem{1, `b`}, tiedItem{1, `d`}, tiedItem{1, `f`},
+			tiedItem{2, `a`}, tiedItem{2, `c`}, tiedItem{2, `e`},
+		}, result)
+	}
+}
+
+func TestDaryPriorityQueue(t *testing.T) {
+	for _, arity := range []int{0, 2, 3, 4, 16} {
+		q := NewDaryPriorityQueue(1000, arity)
+		for i := 0; i < 1000; i++ {
+			q.Put(mockItem((i * 7919) % 1000))
+		}
+
+		handle, _ := q.Insert(mockItem(-1))
+		assert.Equal(t, mockItem(-1), q.Peek())
+		assert.True(t, q.Update(handle, mockItem(500)))
+
+		for i := 0; i < 1000; i++ {
+			result, _ := q.Get(1)
+			if !assert.Equal(t, []Item{mockItem(i)}, result) {
+				return
+			}
+			if i == 500 {
+				result, _ = q.Get(1)
+				assert.Equal(t, []Item{mockItem(500)}, result)
+			}
+		}
+		assert.True(t, q.Empty())
+	}
+}
+
+func TestBoundedPriorityQueueDropsNewestTie(t *testing.T) {
+	q := NewBoundedPriorityQueue(2, DropLowest)
+	q.Put(tiedItem{1, `a`}, tiedItem{1, `b`}, tiedItem{1, `c`})
+
+	result, _ := q.Get(2)
+	assert.Equal(t, []Item{tiedItem{1, `a`}, tiedItem{1, `b`}}, result)
+}
+
+func TestBoundedPriorityQueueInsertDropped(t *testing.T) {
+	q := NewBoundedPriorityQueue(2, DropLowest)
+	q.Put(mockItem(1), mockItem(2))
+
+	handle, err := q.Insert(mockItem(3))
+	assert.IsType(t, FullError{}, err)
+	assert.Nil(t, handle)
+	assert.Equal(t, 2, q.Len())
+
+	// an equal item is newer so it is the one dropped
+	handle, err = q.Insert(mockItem(2))
+	assert.IsType(t, FullError{}, err)
+	assert.Nil(t, handle)
+
+	handle, err = q.Insert(mockItem(0))
+	assert.Nil(t, err)
+	assert.True(t, q.Update(handle, mockItem(5)))
+
+	result, _ := q.Get(2)
+	assert.Equal(t, []Item{mockItem(1), mockItem(5)}, result)
+
+	// a plain put drops silently
+	assert.Nil(t, q.Put(mockItem(1), mockItem(2), mockItem(3)))
+	assert.Equal(t, 2, q.Len())
+}
+
+func benchmarkDaryPriorityQueue(b *testing.B, arity int) {
+	q := NewDaryPriorityQueue(b.N, arity)
+	for i := 0; i < b.N; i++ {
+		q.Put(mockItem((i * 7919) % b.N))
+	}
+
+	for i := 0; i < b.N; i++ {
+		q.Get(1)
+	}
+}
+
+func BenchmarkBinaryPriorityQueue(b *testing.B) {
+	benchmarkDaryPriorityQueue(b, 2)
+}
+
+func BenchmarkQuaternaryPriorityQueue(b *testing.B) {
+	benchmarkDaryPriorityQueue(b, 4)
+}
+
+func BenchmarkOctonaryPriorityQueue(b *testing.B) {
+	benchmarkDaryPriorityQueue(b, 8)
 }
@@ -16,24 +16,33 @@ limitations under the License.
 
 /*
 Package queue includes a regular queue and a priority queue.
-These queues rely on waitgroups to pause listening threads
-on empty queues until a message is received.  If any thread
+These queues pause listening threads on empty queues until a
+message is received or, for the context-aware and polling variants
+of Get, until the listener gives up.  If any thread
 calls Dispose on the queue, any listeners are immediately returned
 with an error.  Any subsequent put to the queue will return an error
 as opposed to panicking as with channels.  Queues will grow with unbounded
 behavior as opposed to channels which can be buffered but will pause
 while a thread attempts to put to a full channel.
 
+The package also includes a lock-free ring buffer for producers and
+consumers that need a fixed size queue without contending on a mutex,
+a delay queue whose items cannot be taken until their ready time and
+a deque that can be pushed to and popped from either end, a durable
+queue that keeps its items in a write-ahead log on disk and a
+reliable queue that leases items until consumers acknowledge them.
+
 TODO: Unify the two types of queue to the same interface.
-TODO: Implement an even faster lockless circular buffer.
 */
 
 package queue
 
 import (
+	"context"
 	"runtime"
 	"sync"
 	"sync/atomic"
+	"time"
 )
 
 type waiters []*sema
@@ -54,6 +63,17 @@ func (w *waiters) put(sema *sema) {
 	*w = append(*w, sema)
 }
 
+func (w *waiters) remove(sema *sema) {
+	for i, waiter := range *w {
+		if waiter == sema {
+			copy((*w)[i:], (*w)[i+1:])
+			(*w)[len(*w)-1] = nil
+			*w = (*w)[:len(*w)-1]
+			return
+		}
+	}
+}
+
 type items []interface{}
 
 func (items *items) get(number int64) []interface{} {
@@ -73,6 +93,24 @@ func (items *items) get(number int64) []interface{} {
 	return returnItems
 }
 
+// getBack removes up to number items from the back, returning the
+// last item first.
+func (items *items) getBack(number int64) []interface{} {
+	if number > int64(len(*items)) {
+		number = int64(len(*items))
+	}
+
+	returnItems := make([]interface{}, 0, number)
+	for i := int64(0); i < number; i++ {
+		last := len(*items) - 1
+		returnItems = append(returnItems, (*items)[last])
+		(*items)[last] = nil
+		*items = (*items)[:last]
+	}
+
+	return returnItems
+}
+
 func (items *items) getUntil(checker func(item interface{}) bool) []interface{} {
 	length := len(*items)
 
@@ -90,21 +128,61 @@ func (items *items) getUntil(checker func(item interface{}) bool) []interface{}
 		}
 
 		returnItems = append(returnItems, item)
-		index = i
+		(*items)[i] = nil
+		index = i + 1
 	}
 
 	*items = (*items)[index:]
 	return returnItems
 }
 
+const (
+	semaWaiting int32 = iota
+	semaClaimed
+	semaAbandoned
+)
+
+// sema is how a waiting getter is handed items by a put.  Whoever
+// first moves it out of the waiting state, a put claiming it or the
+// getter abandoning it, decides its fate.
 type sema struct {
-	wg       *sync.WaitGroup
+	ready    chan bool
 	response *sync.WaitGroup
+	state    int32
+}
+
+// claim returns a bool indicating if the waiter was claimed.  Once
+// claimed the waiter must be sent on ready.
+func (s *sema) claim() bool {
+	return atomic.CompareAndSwapInt32(&s.state, semaWaiting, semaClaimed)
+}
+
+// abandon returns a bool indicating if the waiter gave up before it
+// was claimed.
+func (s *sema) abandon() bool {
+	return atomic.CompareAndSwapInt32(&s.state, semaWaiting, semaAbandoned)
+}
+
+// wait blocks until the waiter is claimed and sent on ready or the
+// context is done.  The returned bool is false if the waiter gave up,
+// in which case the caller must remove it from the waiters.
+func (s *sema) wait(ctx context.Context) bool {
+	select {
+	case <-s.ready:
+		return true
+	case <-ctx.Done():
+		if s.abandon() {
+			return false
+		}
+		// a put claimed us first and is waiting for a response
+		<-s.ready
+		return true
+	}
 }
 
 func newSema() *sema {
 	return &sema{
-		wg:       &sync.WaitGroup{},
+		ready:    make(chan bool, 1),
 		response: &sync.WaitGroup{},
 	}
 }
@@ -116,37 +194,200 @@ type Queue struct {
 	items    items
 	lock     sync.Mutex
 	disposed bool
+	// capacity is the most items a bounded queue holds, zero means
+	// the queue is unbounded.
+	capacity int64
+	policy   OverflowPolicy
+	room     roomSignal
 }
 
-// Put will add the specified items to the queue.
+// Put will add the specified items to the queue.  If the queue is
+// bounded and full, what happens depends on its overflow policy.
 func (q *Queue) Put(items ...interface{}) error {
+	return q.PutWithContext(context.Background(), items...)
+}
+
+// PutWithContext is like Put except that a put blocked on a full
+// queue gives up when the provided context is done, in which case the
+// context's error is returned.
+func (q *Queue) PutWithContext(ctx context.Context, items ...interface{}) error {
+	return q.put(ctx, false, items)
+}
+
+// PutFront is like Put except that the items are added to the front of
+// the queue, in the order provided, so they are retrieved before
+// anything already in the queue.  This is how a failed item is put
+// back at the head of the queue.  If the queue drops items when full,
+// DropOldest discards the items that were already at the front rather
+// than the ones just put there.
+func (q *Queue) PutFront(items ...interface{}) error {
+	return q.put(context.Background(), true, items)
+}
+
+// put adds the provided items to the back of the queue, or to its
+// front if front is true.
+func (q *Queue) put(ctx context.Context, front bool, items []interface{}) error {
 	if len(items) == 0 {
 		return nil
 	}
 
 	q.lock.Lock()
 
+	for len(items) > 0 {
+		if q.disposed {
+			q.lock.Unlock()
+			return DisposedError{}
+		}
+
+		number := int64(len(items))
+		if q.capacity > 0 {
+			room := q.capacity - int64(len(q.items))
+			switch q.policy {
+			case FailWhenFull:
+				if number > room {
+					q.lock.Unlock()
+					return FullError{}
+				}
+			case BlockWhenFull:
+				if room <= 0 {
+					roomMade := q.room.wait()
+					q.lock.Unlock()
+					select {
+					case <-roomMade:
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+					q.lock.Lock()
+					continue
+				}
+				if number > room {
+					number = room
+				}
+			}
+		}
+
+		var from int64
+		if front {
+			// the last items go in first so the items keep their
+			// order if they have to wait for room in several parts
+			put := make([]interface{}, 0, number+int64(len(q.items)))
+			put = append(put, items[int64(len(items))-number:]...)
+			q.items = append(put, q.items...)
+			items = items[:int64(len(items))-number]
+			from = number
+		} else {
+			q.items = append(q.items, items[:number]...)
+			items = items[number:]
+		}
+		if q.capacity > 0 {
+			switch q.policy {
+			case DropOldest:
+				q.dropOldest(from)
+			case DropLowest:
+				q.dropNewest()
+			}
+		}
+		q.handOff()
+	}
+
+	q.lock.Unlock()
+	return nil
+}
+
+// dropOldest discards the items that were put longest ago until the
+// queue is back at capacity.  Those are the items starting at the
+// provided index, which is past any items just put at the front, and
+// if there are not enough of them, the last of the items just put.
+func (q *Queue) dropOldest(from int64) {
+	over := int64(len(q.items)) - q.capacity
+	if over <= 0 {
+		return
+	}
+
+	if from+over > int64(len(q.items)) {
+		from = int64(len(q.items)) - over
+	}
+	if from == 0 {
+		for i := int64(0); i < over; i++ {
+			q.items[i] = nil
+		}
+		q.items = q.items[over:]
+		return
+	}
+
+	copy(q.items[from:], q.items[from+over:])
+	for i := int64(len(q.items)) - over; i < int64(len(q.items)); i++ {
+		q.items[i] = nil
+	}
+	q.items = q.items[:int64(len(q.items))-over]
+}
+
+// dropNewest discards items from the back of the queue until it is
+// back at capacity.
+func (q *Queue) dropNewest() {
+	if int64(len(q.items)) <= q.capacity {
+		return
+	}
+
+	for i := q.capacity; i < int64(len(q.items)); i++ {
+		q.items[i] = nil
+	}
+	q.items = q.items[:q.capacity]
+}
+
+// requeue puts items that were taken from the queue back at its
+// front, ahead of anything put since, so they are retrieved next.  As
+// they already had room when they were put, the overflow policy is not
+// applied to them and a bounded queue may hold more than its capacity
+// until they are taken again.
+func (q *Queue) requeue(taken []interface{}) error {
+	if len(taken) == 0 {
+		return nil
+	}
+
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
 	if q.disposed {
-		q.lock.Unlock()
 		return DisposedError{}
 	}
 
-	q.items = append(q.items, items...)
+	requeued := make(items, 0, len(taken)+len(q.items))
+	requeued = append(requeued, taken...)
+	q.items = append(requeued, q.items...)
+	q.handOff()
+
+	return nil
+}
+
+// handOff passes items to waiting getters until either runs out.
+func (q *Queue) handOff() {
 	for {
 		sema := q.waiters.get()
 		if sema == nil {
 			break
 		}
+		if !sema.claim() {
+			// this waiter gave up
+			continue
+		}
 		sema.response.Add(1)
-		sema.wg.Done()
+		sema.ready <- true
 		sema.response.Wait()
 		if len(q.items) == 0 {
 			break
 		}
 	}
+}
 
-	q.lock.Unlock()
-	return nil
+// take removes up to number items from the front of the queue, or
+// from its back if back is true, waking any putters waiting for room.
+func (q *Queue) take(number int64, back bool) []interface{} {
+	q.room.broadcast()
+	if back {
+		return q.items.getBack(number)
+	}
+	return q.items.get(number)
 }
 
 // Get will add an item to the queue.  If there are some items in the
@@ -154,6 +395,42 @@ func (q *Queue) Put(items ...interface{}) error {
 // parameter.  If no items are in the queue, this method will pause
 // until items are added to the queue.
 func (q *Queue) Get(number int64) ([]interface{}, error) {
+	return q.GetWithContext(context.Background(), number)
+}
+
+// Poll is like Get except that it gives up if no items are added to
+// the queue within the provided timeout, in which case a TimeoutError
+// is returned.
+func (q *Queue) Poll(number int64, timeout time.Duration) ([]interface{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	items, err := q.GetWithContext(ctx, number)
+	if err == context.DeadlineExceeded {
+		return nil, TimeoutError{}
+	}
+
+	return items, err
+}
+
+// GetWithContext is like Get except that it gives up if the provided
+// context is done before any items are added to the queue, in which
+// case the context's error is returned.
+func (q *Queue) GetWithContext(ctx context.Context, number int64) ([]interface{}, error) {
+	return q.get(ctx, number, false)
+}
+
+// GetBack is like Get except that the items are taken from the back of
+// the queue, the most recently put item first.  This is how work is
+// taken last in, first out, for instance by a worker stealing from
+// another's queue.
+func (q *Queue) GetBack(number int64) ([]interface{}, error) {
+	return q.get(context.Background(), number, true)
+}
+
+// get takes up to number items from the front of the queue, or from
+// its back if back is true, waiting for items if there are none.
+func (q *Queue) get(ctx context.Context, number int64, back bool) ([]interface{}, error) {
 	if number < 1 {
 		// thanks again go
 		return []interface{}{}, nil
@@ -169,22 +446,31 @@ func (q *Queue) Get(number int64) ([]interface{}, error) {
 	var items []interface{}
 
 	if len(q.items) == 0 {
+		if err := ctx.Err(); err != nil {
+			q.lock.Unlock()
+			return nil, err
+		}
+
 		sema := newSema()
 		q.waiters.put(sema)
-		sema.wg.Add(1)
 		q.lock.Unlock()
 
-		sema.wg.Wait()
+		if !sema.wait(ctx) {
+			q.lock.Lock()
+			q.waiters.remove(sema)
+			q.lock.Unlock()
+			return nil, ctx.Err()
+		}
 		// we are now inside the put's lock
 		if q.disposed {
 			return nil, DisposedError{}
 		}
-		items = q.items.get(number)
+		items = q.take(number, back)
 		sema.response.Done()
 		return items, nil
 	}
 
-	items = q.items.get(number)
+	items = q.take(number, back)
 	q.lock.Unlock()
 	return items, nil
 }
@@ -205,6 +491,7 @@ func (q *Queue) TakeUntil(checker func(item interface{}) bool) ([]interface{}, e
 	}
 
 	result := q.items.getUntil(checker)
+	q.room.broadcast()
 	q.lock.Unlock()
 	return result, nil
 }
@@ -241,9 +528,11 @@ func (q *Queue) Dispose() {
 	defer q.lock.Unlock()
 
 	q.disposed = true
+	q.room.broadcast()
 	for _, waiter := range q.waiters {
-		waiter.response.Add(1)
-		waiter.wg.Done()
+		if waiter.claim() {
+			waiter.ready <- true
+		}
 	}
 
 	q.items = nil
@@ -257,43 +546,44 @@ func New(hint int64) *Queue {
 	}
 }
 
+// NewBounded is a constructor for a threadsafe queue that holds at
+// most capacity items.  Putting to a full queue blocks, fails or drops
+// items according to the provided policy.  A capacity less than one
+// makes the queue unbounded.
+func NewBounded(capacity int64, policy OverflowPolicy) *Queue {
+	if capacity < 0 {
+		capacity = 0
+	}
+
+	return &Queue{
+		items:    make([]interface{}, 0, capacity),
+		capacity: capacity,
+		policy:   policy,
+	}
+}
+
 // ExecuteInParallel will (in parallel) call the provided function
 // with each item in the queue until the queue is exhausted.  When the queue
 // is exhausted execution is complete and all goroutines will be killed.
 // This means that the queue will be disposed so cannot be used again.
+//
+// Deprecated: use an Executor, which also reports errors from the
+// provided function, honors a context and leaves the queue usable.
 func ExecuteInParallel(q *Queue, fn func(interface{})) {
-	todo, done := uint64(q.Len()), uint64(0)
-	// this is important or we might face an infinite loop
-	if todo == 0 {
+	if q.Len() == 0 {
 		return
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(1)
-
 	numCPU := 1
 	if runtime.NumCPU() > 1 {
 		numCPU = runtime.NumCPU() - 1
 	}
 
-	for i := 0; i < numCPU; i++ {
-		go func() {
-			for {
-				items, err := q.Get(1)
-				if err != nil {
-					break
-				}
-
-				fn(items[0])
-
-				if atomic.AddUint64(&done, 1) == todo {
-					wg.Done()
-					break
-				}
-			}
-		}()
-	}
-
-	wg.Wait()
+	e := NewExecutor(numCPU)
+	e.ExecuteQueue(context.Background(), q, func(item interface{}) error {
+		fn(item)
+		return nil
+	})
+	e.Dispose()
 	q.Dispose()
 }
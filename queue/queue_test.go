@@ -17,9 +17,11 @@ limitations under the License.
 package queue
 
 import (
+	"context"
 	"sync"
 	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -97,6 +99,63 @@ func TestGet(t *testing.T) {
 	}
 }
 
+func TestPutFront(t *testing.T) {
+	q := New(10)
+
+	q.Put(`c`, `d`)
+	assert.Nil(t, q.PutFront(`a`, `b`))
+	assert.Nil(t, q.PutFront())
+
+	result, err := q.Get(10)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`a`, `b`, `c`, `d`}, result)
+
+	q.Dispose()
+	assert.IsType(t, DisposedError{}, q.PutFront(`a`))
+}
+
+func TestGetBack(t *testing.T) {
+	q := New(10)
+
+	q.Put(`a`, `b`, `c`)
+	result, err := q.GetBack(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`c`, `b`}, result)
+
+	result, err = q.GetBack(2)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`a`}, result)
+	assert.Equal(t, int64(0), q.Len())
+}
+
+func TestGetBackWaits(t *testing.T) {
+	q := New(10)
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		result, err := q.GetBack(2)
+		assert.Nil(t, err)
+		assert.Equal(t, []interface{}{`b`, `a`}, result)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	q.Put(`a`, `b`)
+	wg.Wait()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		_, err := q.GetBack(1)
+		assert.IsType(t, DisposedError{}, err)
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	q.Dispose()
+	wg.Wait()
+}
+
 func TestAddEmptyPut(t *testing.T) {
 	q := &Queue{}
 
@@ -283,6 +342,24 @@ func TestTakeUntil(t *testing.T) {
 	assert.Equal(t, expected, result)
 }
 
+func TestTakeUntilRemovesTakenItems(t *testing.T) {
+	q := &Queue{}
+	q.Put(`a`, `b`, `c`)
+	result, err := q.TakeUntil(func(item interface{}) bool {
+		return item == `a`
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`a`}, result)
+	assert.Equal(t, int64(2), q.Len())
+
+	result, err = q.TakeUntil(func(item interface{}) bool {
+		return true
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`b`, `c`}, result)
+	assert.True(t, q.Empty())
+}
+
 func TestTakeUntilEmptyQueue(t *testing.T) {
 	q := &Queue{}
 	result, err := q.TakeUntil(func(item interface{}) bool {
@@ -332,3 +409,113 @@ func TestExecuteInParallelEmptyQueue(t *testing.T) {
 		t.Fail()
 	})
 }
+
+func TestPollTimeout(t *testing.T) {
+	q := New(10)
+
+	result, err := q.Poll(1, time.Millisecond)
+	assert.IsType(t, TimeoutError{}, err)
+	assert.Nil(t, result)
+	assert.Len(t, q.waiters, 0)
+
+	q.Put(`a`)
+	result, err = q.Poll(1, time.Millisecond)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`a`}, result)
+}
+
+func TestPollReceivesPut(t *testing.T) {
+	q := New(10)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		q.Put(`a`)
+	}()
+
+	result, err := q.Poll(1, time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`a`}, result)
+}
+
+func TestGetWithContextCancel(t *testing.T) {
+	q := New(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var err error
+	go func() {
+		_, err = q.GetWithContext(ctx, 1)
+		wg.Done()
+	}()
+
+	cancel()
+	wg.Wait()
+
+	assert.Equal(t, context.Canceled, err)
+	assert.Len(t, q.waiters, 0)
+
+	// an abandoned waiter must not swallow items
+	q.Put(`a`)
+	assert.Equal(t, int64(1), q.Len())
+}
+
+func TestGetWithContextDone(t *testing.T) {
+	q := New(10)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	_, err := q.GetWithContext(ctx, 1)
+	assert.Equal(t, context.Canceled, err)
+
+	q.Put(`a`)
+	result, err := q.GetWithContext(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []interface{}{`a`}, result)
+}
+
+func TestPollWithDispose(t *testing.T) {
+	q := New(10)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	var err error
+	go func() {
+		_, err = q.Poll(1, time.Second)
+		wg.Done()
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	q.Dispose()
+	wg.Wait()
+
+	assert.IsType(t, DisposedError{}, err)
+}
+
+func TestPollRacesWithPut(t *testing.T) {
+	q := New(10)
+	numItems := int64(1000)
+	var received int64
+	var wg sync.WaitGroup
+	wg.Add(4)
+
+	for i := 0; i < 4; i++ {
+		go func() {
+			defer wg.Done()
+			for atomic.LoadInt64(&received) < numItems {
+				items, err := q.Poll(1, time.Microsecond)
+				if err == nil {
+					atomic.AddInt64(&received, int64(len(items)))
+				}
+			}
+		}()
+	}
+
+	for i := int64(0); i < numItems; i++ {
+		q.Put(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, numItems, received)
+	assert.Equal(t, int64(0), q.Len())
+}
@@ -0,0 +1,411 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"container/heap"
+	"context"
+	"sync"
+	"time"
+)
+
+// Lease is an item retrieved from a reliable queue.  The item stays
+// leased to the consumer until it is acknowledged or its deadline
+// passes, after which it is delivered again.
+type Lease struct {
+	// ID identifies this delivery of the item and is used to
+	// acknowledge it.  Every delivery of an item gets a new ID.
+	ID   uint64
+	Item interface{}
+	// Deliveries is the number of times the item has been delivered,
+	// including this one.
+	Deliveries int
+	// Deadline is when the lease expires if the item has not been
+	// acknowledged.
+	Deadline time.Time
+}
+
+type reliableEntry struct {
+	item       interface{}
+	deliveries int
+	// lease is the ID of the current lease on this item, or zero if
+	// it is not leased.
+	lease uint64
+}
+
+// leaseExpiry records when a lease on an entry runs out.  It is
+// ignored if the entry has been acknowledged or leased again since.
+type leaseExpiry struct {
+	entry    *reliableEntry
+	lease    uint64
+	deadline time.Time
+}
+
+func (le leaseExpiry) ReadyAt() time.Time {
+	return le.deadline
+}
+
+// ReliableQueue is a queue that does not lose items taken by a
+// consumer that fails.  Get leases items for a visibility timeout and
+// each item must be acknowledged with Ack before the timeout passes,
+// otherwise it is put back in the queue to be delivered again.  A
+// consumer that cannot process an item can return it straight away
+// with Nack.  Once an item has been delivered the maximum number of
+// times without being acknowledged, it is moved to the dead letter
+// queue instead.
+type ReliableQueue struct {
+	lock          sync.Mutex
+	clock         Clock
+	visibility    time.Duration
+	maxDeliveries int
+	ready         []*reliableEntry
+	leased        map[uint64]*reliableEntry
+	expiries      delayedItems
+	// stale is the number of expiries whose lease has already been
+	// ended by Ack or Nack.
+	stale       int
+	sequence    uint64
+	nextLease   uint64
+	deadLetters *Queue
+	// dead holds the items released to the dead letter queue while
+	// the lock is held.  They are put there once it is released.
+	dead     []interface{}
+	disposed bool
+	// pushed wakes getters waiting on an empty queue when items are
+	// put or returned, or the queue is disposed.
+	pushed roomSignal
+}
+
+// unlock releases the lock and then puts any items released to the
+// dead letter queue there.  Putting them while holding the lock would
+// hold up this queue until any getters waiting on the dead letter
+// queue had taken them.
+func (rq *ReliableQueue) unlock() {
+	dead := rq.dead
+	rq.dead = nil
+	rq.lock.Unlock()
+
+	if len(dead) > 0 {
+		rq.deadLetters.Put(dead...)
+	}
+}
+
+// release returns an entry whose lease has ended to the back of the
+// queue, or to the dead letter queue if it has been delivered too many
+// times.
+func (rq *ReliableQueue) release(entry *reliableEntry) {
+	entry.lease = 0
+	if rq.maxDeliveries > 0 && entry.deliveries >= rq.maxDeliveries {
+		rq.dead = append(rq.dead, entry.item)
+		return
+	}
+
+	rq.ready = append(rq.ready, entry)
+	rq.pushed.broadcast()
+}
+
+// expire releases every entry whose lease has run out.
+func (rq *ReliableQueue) expire(now time.Time) {
+	for len(rq.expiries) > 0 && !rq.expiries[0].readyAt.After(now) {
+		expiry := heap.Pop(&rq.expiries).(delayedEntry).item.(leaseExpiry)
+		if expiry.entry.lease != expiry.lease {
+			rq.stale--
+			continue
+		}
+
+		delete(rq.leased, expiry.lease)
+		rq.release(expiry.entry)
+	}
+}
+
+// compact removes the expiries of leases that have already ended once
+// they make up most of the heap, so acknowledged leases do not pile up
+// until their deadlines.
+func (rq *ReliableQueue) compact() {
+	if rq.stale <= len(rq.expiries)/2 {
+		return
+	}
+
+	live := rq.expiries[:0]
+	for _, expiry := range rq.expiries {
+		le := expiry.item.(leaseExpiry)
+		if le.entry.lease == le.lease {
+			live = append(live, expiry)
+		}
+	}
+	for i := len(live); i < len(rq.expiries); i++ {
+		rq.expiries[i] = delayedEntry{}
+	}
+
+	rq.expiries = live
+	heap.Init(&rq.expiries)
+	rq.stale = 0
+}
+
+// take leases up to number items from the front of the queue.
+func (rq *ReliableQueue) take(now time.Time, number int) []Lease {
+	if number > len(rq.ready) {
+		number = len(rq.ready)
+	}
+
+	deadline := now.Add(rq.visibility)
+	leases := make([]Lease, 0, number)
+	for i, entry := range rq.ready[:number] {
+		rq.nextLease++
+		entry.lease = rq.nextLease
+		entry.deliveries++
+		rq.leased[entry.lease] = entry
+
+		heap.Push(&rq.expiries, delayedEntry{
+			item:     leaseExpiry{entry: entry, lease: entry.lease, deadline: deadline},
+			readyAt:  deadline,
+			sequence: rq.sequence,
+		})
+		rq.sequence++
+
+		leases = append(leases, Lease{
+			ID:         entry.lease,
+			Item:       entry.item,
+			Deliveries: entry.deliveries,
+			Deadline:   deadline,
+		})
+		rq.ready[i] = nil
+	}
+	rq.ready = rq.ready[number:]
+
+	return leases
+}
+
+// Put adds items to the back of the queue.  This only returns an
+// error if the queue has been disposed.
+func (rq *ReliableQueue) Put(items ...interface{}) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+
+	if rq.disposed {
+		return DisposedError{}
+	}
+
+	for _, item := range items {
+		rq.ready = append(rq.ready, &reliableEntry{item: item})
+	}
+
+	rq.pushed.broadcast()
+	return nil
+}
+
+// Get leases up to number items from the queue.  If the queue is
+// empty, this call blocks until an item is put or an unacknowledged
+// item is returned to the queue.
+func (rq *ReliableQueue) Get(number int) ([]Lease, error) {
+	return rq.get(context.Background(), nil, number)
+}
+
+// Poll is like Get except that it gives up if no item is available
+// within the provided timeout, as measured by the queue's clock, in
+// which case a TimeoutError is returned.
+func (rq *ReliableQueue) Poll(number int, timeout time.Duration) ([]Lease, error) {
+	timer := rq.clock.NewTimer(timeout)
+	defer timer.Stop()
+
+	return rq.get(context.Background(), timer.C(), number)
+}
+
+// GetWithContext is like Get except that it gives up if the provided
+// context is done before any item is available, in which case the
+// context's error is returned.
+func (rq *ReliableQueue) GetWithContext(ctx context.Context, number int) ([]Lease, error) {
+	return rq.get(ctx, nil, number)
+}
+
+func (rq *ReliableQueue) get(ctx context.Context, expired <-chan time.Time, number int) ([]Lease, error) {
+	if number < 1 {
+		return nil, nil
+	}
+
+	rq.lock.Lock()
+
+	for {
+		if rq.disposed {
+			rq.unlock()
+			return nil, DisposedError{}
+		}
+
+		now := rq.clock.Now()
+		rq.expire(now)
+		if len(rq.ready) > 0 {
+			leases := rq.take(now, number)
+			rq.unlock()
+			return leases, nil
+		}
+
+		if err := ctx.Err(); err != nil {
+			rq.unlock()
+			return nil, err
+		}
+
+		// wake up when the earliest lease runs out as its item may
+		// come back to the queue
+		var due <-chan time.Time
+		var timer Timer
+		if len(rq.expiries) > 0 {
+			timer = rq.clock.NewTimer(rq.expiries[0].readyAt.Sub(now))
+			due = timer.C()
+		}
+		pushed := rq.pushed.wait()
+		rq.unlock()
+
+		var err error
+		select {
+		case <-pushed:
+		case <-due:
+		case <-ctx.Done():
+			err = ctx.Err()
+		case <-expired:
+			err = TimeoutError{}
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		rq.lock.Lock()
+	}
+}
+
+// end ends the lease with the provided ID and returns its entry.
+func (rq *ReliableQueue) end(id uint64) (*reliableEntry, error) {
+	if rq.disposed {
+		return nil, DisposedError{}
+	}
+
+	rq.expire(rq.clock.Now())
+	entry, ok := rq.leased[id]
+	if !ok {
+		return nil, LeaseExpiredError{}
+	}
+
+	delete(rq.leased, id)
+	entry.lease = 0
+	rq.stale++
+	rq.compact()
+	return entry, nil
+}
+
+// Ack acknowledges the leased item with the provided lease ID, which
+// removes it from the queue for good.  A LeaseExpiredError is
+// returned if the lease is no longer held, in which case the item may
+// be delivered again.
+func (rq *ReliableQueue) Ack(id uint64) error {
+	rq.lock.Lock()
+	defer rq.unlock()
+
+	_, err := rq.end(id)
+	return err
+}
+
+// Nack gives up the lease with the provided ID and returns the item
+// to the back of the queue straight away, or to the dead letter queue
+// if it has been delivered the maximum number of times.  A
+// LeaseExpiredError is returned if the lease is no longer held.
+func (rq *ReliableQueue) Nack(id uint64) error {
+	rq.lock.Lock()
+	defer rq.unlock()
+
+	entry, err := rq.end(id)
+	if err != nil {
+		return err
+	}
+
+	rq.release(entry)
+	return nil
+}
+
+// DeadLetters returns the queue that items are moved to once they
+// have been delivered the maximum number of times without being
+// acknowledged.  It is not disposed along with this queue.
+func (rq *ReliableQueue) DeadLetters() *Queue {
+	return rq.deadLetters
+}
+
+// Len returns the number of items waiting to be leased, including any
+// whose lease has run out.
+func (rq *ReliableQueue) Len() int {
+	rq.lock.Lock()
+	defer rq.unlock()
+
+	rq.expire(rq.clock.Now())
+	return len(rq.ready)
+}
+
+// Leased returns the number of items that are currently leased.
+func (rq *ReliableQueue) Leased() int {
+	rq.lock.Lock()
+	defer rq.unlock()
+
+	rq.expire(rq.clock.Now())
+	return len(rq.leased)
+}
+
+// Disposed returns a bool indicating if this queue has been disposed.
+func (rq *ReliableQueue) Disposed() bool {
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+
+	return rq.disposed
+}
+
+// Dispose will dispose of this queue.  Any waiting or subsequent calls
+// to Get, Put, Ack or Nack will return an error.
+func (rq *ReliableQueue) Dispose() {
+	rq.lock.Lock()
+	defer rq.lock.Unlock()
+
+	rq.disposed = true
+	rq.pushed.broadcast()
+	rq.ready = nil
+	rq.leased = nil
+	rq.expiries = nil
+	rq.stale = 0
+}
+
+// NewReliableQueue is the constructor for a reliable queue that leases
+// items for the provided visibility timeout and moves an item to the
+// dead letter queue after maxDeliveries unacknowledged deliveries.  A
+// maxDeliveries less than one redelivers items forever.
+func NewReliableQueue(visibility time.Duration, maxDeliveries int) *ReliableQueue {
+	return NewReliableQueueWithClock(visibility, maxDeliveries, RealClock)
+}
+
+// NewReliableQueueWithClock is like NewReliableQueue except that
+// leases are timed with the provided clock.
+func NewReliableQueueWithClock(visibility time.Duration, maxDeliveries int, clock Clock) *ReliableQueue {
+	return &ReliableQueue{
+		clock:         clock,
+		visibility:    visibility,
+		maxDeliveries: maxDeliveries,
+		leased:        make(map[uint64]*reliableEntry),
+		deadLetters:   New(0),
+	}
+}
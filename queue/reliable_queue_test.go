@@ -0,0 +1,240 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReliableQueueAck(t *testing.T) {
+	clock := NewManualClock(epoch)
+	rq := NewReliableQueueWithClock(time.Minute, 3, clock)
+	rq.Put(`a`, `b`)
+
+	leases, err := rq.Get(1)
+	assert.Nil(t, err)
+	assert.Len(t, leases, 1)
+	assert.Equal(t, `a`, leases[0].Item)
+	assert.Equal(t, 1, leases[0].Deliveries)
+	assert.Equal(t, epoch.Add(time.Minute), leases[0].Deadline)
+	assert.Equal(t, 1, rq.Len())
+	assert.Equal(t, 1, rq.Leased())
+
+	assert.Nil(t, rq.Ack(leases[0].ID))
+	assert.IsType(t, LeaseExpiredError{}, rq.Ack(leases[0].ID))
+	assert.Equal(t, 0, rq.Leased())
+
+	clock.Advance(time.Hour)
+	assert.Equal(t, 1, rq.Len())
+}
+
+func TestReliableQueueRedeliversAfterTimeout(t *testing.T) {
+	clock := NewManualClock(epoch)
+	rq := NewReliableQueueWithClock(time.Minute, 0, clock)
+	rq.Put(`a`, `b`)
+
+	first, _ := rq.Get(1)
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 1, rq.Leased())
+
+	clock.Advance(30 * time.Second)
+	assert.Equal(t, 0, rq.Leased())
+	assert.IsType(t, LeaseExpiredError{}, rq.Ack(first[0].ID))
+
+	// the expired item goes to the back of the queue
+	leases, _ := rq.Get(2)
+	assert.Equal(t, `b`, leases[0].Item)
+	assert.Equal(t, 1, leases[0].Deliveries)
+	assert.Equal(t, `a`, leases[1].Item)
+	assert.Equal(t, 2, leases[1].Deliveries)
+	assert.NotEqual(t, first[0].ID, leases[1].ID)
+}
+
+func TestReliableQueueNack(t *testing.T) {
+	rq := NewReliableQueueWithClock(time.Minute, 0, NewManualClock(epoch))
+	rq.Put(`a`)
+
+	leases, _ := rq.Get(1)
+	assert.Nil(t, rq.Nack(leases[0].ID))
+	assert.IsType(t, LeaseExpiredError{}, rq.Nack(leases[0].ID))
+
+	leases, _ = rq.Get(1)
+	assert.Equal(t, `a`, leases[0].Item)
+	assert.Equal(t, 2, leases[0].Deliveries)
+}
+
+func TestReliableQueueDeadLetters(t *testing.T) {
+	clock := NewManualClock(epoch)
+	rq := NewReliableQueueWithClock(time.Minute, 2, clock)
+	rq.Put(`a`, `b`)
+
+	leases, _ := rq.Get(2)
+	rq.Nack(leases[0].ID)
+	rq.Nack(leases[1].ID)
+
+	leases, _ = rq.Get(2)
+	assert.Equal(t, 2, leases[0].Deliveries)
+	rq.Nack(leases[0].ID)
+	clock.Advance(time.Minute)
+
+	assert.Equal(t, 0, rq.Len())
+	assert.Equal(t, int64(2), rq.DeadLetters().Len())
+	dead, _ := rq.DeadLetters().Get(2)
+	assert.Equal(t, []interface{}{`a`, `b`}, dead)
+}
+
+func TestReliableQueueDeadLetterGetter(t *testing.T) {
+	rq := NewReliableQueueWithClock(time.Minute, 1, NewManualClock(epoch))
+	rq.Put(`a`)
+
+	done := make(chan []interface{})
+	go func() {
+		dead, _ := rq.DeadLetters().Get(1)
+		done <- dead
+	}()
+
+	time.Sleep(5 * time.Millisecond)
+	leases, _ := rq.Get(1)
+	assert.Nil(t, rq.Nack(leases[0].ID))
+	assert.Equal(t, []interface{}{`a`}, <-done)
+	assert.Equal(t, 0, rq.Len())
+}
+
+func TestReliableQueueCompactsExpiries(t *testing.T) {
+	clock := NewManualClock(epoch)
+	rq := NewReliableQueueWithClock(time.Minute, 0, clock)
+	rq.Put(`a`)
+	rq.Get(1)
+
+	// acknowledged leases do not keep their expiries until the
+	// deadline passes
+	for i := 0; i < 1000; i++ {
+		rq.Put(i)
+		leases, _ := rq.Get(1)
+		assert.Nil(t, rq.Ack(leases[0].ID))
+	}
+	assert.True(t, len(rq.expiries) < 10)
+	assert.Equal(t, 1, rq.Leased())
+
+	// the lease that was never acknowledged still runs out
+	clock.Advance(time.Minute)
+	assert.Equal(t, 0, rq.Leased())
+	leases, _ := rq.Get(1)
+	assert.Equal(t, `a`, leases[0].Item)
+	assert.Equal(t, 2, leases[0].Deliveries)
+}
+
+func TestReliableQueueGetWaitsForExpiry(t *testing.T) {
+	clock := NewManualClock(epoch)
+	rq := NewReliableQueueWithClock(time.Minute, 0, clock)
+	rq.Put(`a`)
+	rq.Get(1)
+
+	done := make(chan []Lease)
+	go func() {
+		leases, _ := rq.Get(1)
+		done <- leases
+	}()
+
+	select {
+	case <-done:
+		t.Fatal(`get returned a leased item`)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	clock.Advance(time.Minute)
+	leases := <-done
+	assert.Equal(t, `a`, leases[0].Item)
+	assert.Equal(t, 2, leases[0].Deliveries)
+}
+
+func TestReliableQueueStopsTimers(t *testing.T) {
+	clock := NewManualClock(epoch)
+	rq := NewReliableQueueWithClock(time.Minute, 0, clock)
+	rq.Put(`a`)
+	rq.Get(1)
+
+	done := make(chan []Lease)
+	go func() {
+		leases, _ := rq.Get(1)
+		done <- leases
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	rq.Put(`b`)
+	assert.Equal(t, `b`, (<-done)[0].Item)
+	assert.Len(t, clock.timers, 0)
+
+	rq.Put(`c`)
+	leases, err := rq.Poll(1, time.Hour)
+	assert.Nil(t, err)
+	assert.Equal(t, `c`, leases[0].Item)
+	assert.Len(t, clock.timers, 0)
+}
+
+func TestReliableQueuePollAndContext(t *testing.T) {
+	rq := NewReliableQueueWithClock(time.Minute, 0, NewManualClock(epoch))
+
+	_, err := rq.Poll(1, 0)
+	assert.IsType(t, TimeoutError{}, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err = rq.GetWithContext(ctx, 1)
+	assert.Equal(t, context.Canceled, err)
+
+	rq.Put(`a`)
+	leases, err := rq.Poll(1, 0)
+	assert.Nil(t, err)
+	assert.Equal(t, `a`, leases[0].Item)
+}
+
+func TestReliableQueueDispose(t *testing.T) {
+	rq := NewReliableQueue(time.Minute, 0)
+	rq.Put(`a`)
+	leases, _ := rq.Get(1)
+
+	done := make(chan error)
+	go func() {
+		_, err := rq.Get(1)
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	rq.Dispose()
+	assert.IsType(t, DisposedError{}, <-done)
+	assert.True(t, rq.Disposed())
+	assert.IsType(t, DisposedError{}, rq.Put(`b`))
+	assert.IsType(t, DisposedError{}, rq.Ack(leases[0].ID))
+	assert.IsType(t, DisposedError{}, rq.Nack(leases[0].ID))
+	assert.False(t, rq.DeadLetters().Disposed())
+}
+
+func BenchmarkReliableQueue(b *testing.B) {
+	rq := NewReliableQueue(time.Minute, 0)
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rq.Put(i)
+		leases, _ := rq.Get(1)
+		rq.Ack(leases[0].ID)
+	}
+}
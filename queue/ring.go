@@ -0,0 +1,227 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"runtime"
+	"sync/atomic"
+	"time"
+)
+
+// roundUp takes a uint64 greater than 0 and rounds it up to the next
+// power of 2.
+func roundUp(v uint64) uint64 {
+	v--
+	v |= v >> 1
+	v |= v >> 2
+	v |= v >> 4
+	v |= v >> 8
+	v |= v >> 16
+	v |= v >> 32
+	v++
+	return v
+}
+
+// node is a single slot in the ring buffer.  Its position is the
+// sequence number that tells producers and consumers whose turn it is
+// to use the slot.
+type node struct {
+	position uint64
+	data     interface{}
+}
+
+type nodes []node
+
+// RingBuffer is a lock-free, bounded, multiple producer and multiple
+// consumer queue.  Each slot carries a sequence number: a producer may
+// write a slot once its sequence equals the producer's position and a
+// consumer may read it once its sequence is one past the consumer's
+// position.  Producers and consumers claim positions with a compare
+// and swap, so no operation ever holds a lock.
+//
+// Put and Get spin, yielding the processor, while the buffer is full
+// or empty.  Offer and Poll give up instead.
+type RingBuffer struct {
+	// the padding keeps the hot counters on their own cache lines
+	_padding0 [8]uint64
+	queue     uint64
+	_padding1 [8]uint64
+	dequeue   uint64
+	_padding2 [8]uint64
+	mask      uint64
+	disposed  uint64
+	_padding3 [8]uint64
+	nodes     nodes
+}
+
+// put adds the item to the buffer.  If offer is true this returns
+// false instead of waiting for room.
+func (rb *RingBuffer) put(item interface{}, offer bool) (bool, error) {
+	var n *node
+	pos := atomic.LoadUint64(&rb.queue)
+L:
+	for {
+		if atomic.LoadUint64(&rb.disposed) == 1 {
+			return false, DisposedError{}
+		}
+
+		n = &rb.nodes[pos&rb.mask]
+		seq := atomic.LoadUint64(&n.position)
+		switch dif := int64(seq - pos); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&rb.queue, pos, pos+1) {
+				break L
+			}
+		case dif < 0:
+			// the slot still holds an item from the previous lap,
+			// so the buffer is full
+			if offer {
+				return false, nil
+			}
+			runtime.Gosched()
+		}
+		pos = atomic.LoadUint64(&rb.queue)
+	}
+
+	n.data = item
+	atomic.StoreUint64(&n.position, pos+1)
+	return true, nil
+}
+
+// get removes the next item from the buffer.  A negative timeout
+// waits forever, otherwise this gives up with a TimeoutError once the
+// timeout has elapsed.
+func (rb *RingBuffer) get(timeout time.Duration) (interface{}, error) {
+	var (
+		n     *node
+		start time.Time
+	)
+	if timeout > 0 {
+		start = time.Now()
+	}
+
+	pos := atomic.LoadUint64(&rb.dequeue)
+L:
+	for {
+		if atomic.LoadUint64(&rb.disposed) == 1 {
+			return nil, DisposedError{}
+		}
+
+		n = &rb.nodes[pos&rb.mask]
+		seq := atomic.LoadUint64(&n.position)
+		switch dif := int64(seq - (pos + 1)); {
+		case dif == 0:
+			if atomic.CompareAndSwapUint64(&rb.dequeue, pos, pos+1) {
+				break L
+			}
+		case dif < 0:
+			// the slot has not been written this lap, so the buffer
+			// is empty
+			if timeout == 0 || (timeout > 0 && time.Since(start) >= timeout) {
+				return nil, TimeoutError{}
+			}
+			runtime.Gosched()
+		}
+		pos = atomic.LoadUint64(&rb.dequeue)
+	}
+
+	data := n.data
+	n.data = nil
+	atomic.StoreUint64(&n.position, pos+rb.mask+1)
+	return data, nil
+}
+
+// Put adds the provided item to the buffer, waiting for room if the
+// buffer is full.  This returns an error if the buffer is disposed,
+// including while waiting.
+func (rb *RingBuffer) Put(item interface{}) error {
+	_, err := rb.put(item, false)
+	return err
+}
+
+// Offer adds the provided item to the buffer if there is room.  The
+// returned bool is false if the buffer was full and the item was not
+// added.
+func (rb *RingBuffer) Offer(item interface{}) (bool, error) {
+	return rb.put(item, true)
+}
+
+// Get removes and returns the next item in the buffer, waiting for an
+// item if the buffer is empty.  This returns an error if the buffer is
+// disposed, including while waiting.
+func (rb *RingBuffer) Get() (interface{}, error) {
+	return rb.get(-1)
+}
+
+// Poll removes and returns the next item in the buffer, waiting at
+// most the provided timeout for one to arrive.  A timeout of zero
+// does not wait at all.  If no item arrives in time a TimeoutError is
+// returned.
+func (rb *RingBuffer) Poll(timeout time.Duration) (interface{}, error) {
+	if timeout < 0 {
+		timeout = 0
+	}
+
+	return rb.get(timeout)
+}
+
+// Len returns the number of items in the buffer.  Items that are
+// still being written or read are counted.
+func (rb *RingBuffer) Len() uint64 {
+	// dequeue never passes queue, so loading it first keeps this from
+	// underflowing
+	dequeue := atomic.LoadUint64(&rb.dequeue)
+	return atomic.LoadUint64(&rb.queue) - dequeue
+}
+
+// Cap returns the number of items the buffer can hold.
+func (rb *RingBuffer) Cap() uint64 {
+	return uint64(len(rb.nodes))
+}
+
+// Dispose will dispose of this buffer.  Any waiting or subsequent
+// calls to Put, Offer, Get or Poll will return an error.
+func (rb *RingBuffer) Dispose() {
+	atomic.CompareAndSwapUint64(&rb.disposed, 0, 1)
+}
+
+// IsDisposed returns a bool indicating if this buffer has been
+// disposed.
+func (rb *RingBuffer) IsDisposed() bool {
+	return atomic.LoadUint64(&rb.disposed) == 1
+}
+
+// NewRingBuffer is a constructor for a ring buffer that holds at
+// least size items.  The size is rounded up to the next power of two
+// and is at least two, as with a single slot the sequence number of a
+// full slot cannot be told apart from an empty one.
+func NewRingBuffer(size uint64) *RingBuffer {
+	if size < 2 {
+		size = 2
+	}
+
+	size = roundUp(size)
+	rb := &RingBuffer{
+		mask:  size - 1,
+		nodes: make(nodes, size),
+	}
+	for i := uint64(0); i < size; i++ {
+		rb.nodes[i] = node{position: i}
+	}
+
+	return rb
+}
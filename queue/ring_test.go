@@ -0,0 +1,243 @@
+/*
+Copyright 2014 Workiva, LLC
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+ http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package queue
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRingBufferRoundsSize(t *testing.T) {
+	assert.Equal(t, uint64(2), NewRingBuffer(0).Cap())
+	assert.Equal(t, uint64(2), NewRingBuffer(1).Cap())
+	assert.Equal(t, uint64(4), NewRingBuffer(3).Cap())
+	assert.Equal(t, uint64(4), NewRingBuffer(4).Cap())
+	assert.Equal(t, uint64(8), NewRingBuffer(5).Cap())
+}
+
+func TestRingBufferPutGet(t *testing.T) {
+	rb := NewRingBuffer(4)
+
+	for i := 0; i < 3; i++ {
+		assert.Nil(t, rb.Put(i))
+	}
+	assert.Equal(t, uint64(3), rb.Len())
+
+	for i := 0; i < 3; i++ {
+		result, err := rb.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, i, result)
+	}
+	assert.Equal(t, uint64(0), rb.Len())
+}
+
+func TestRingBufferWrapsAround(t *testing.T) {
+	rb := NewRingBuffer(2)
+
+	for i := 0; i < 10; i++ {
+		assert.Nil(t, rb.Put(i))
+		result, err := rb.Get()
+		assert.Nil(t, err)
+		assert.Equal(t, i, result)
+	}
+}
+
+func TestRingBufferOffer(t *testing.T) {
+	rb := NewRingBuffer(2)
+
+	ok, err := rb.Offer(`a`)
+	assert.True(t, ok)
+	assert.Nil(t, err)
+	ok, _ = rb.Offer(`b`)
+	assert.True(t, ok)
+
+	ok, err = rb.Offer(`c`)
+	assert.False(t, ok)
+	assert.Nil(t, err)
+
+	rb.Get()
+	ok, _ = rb.Offer(`c`)
+	assert.True(t, ok)
+}
+
+func TestRingBufferPoll(t *testing.T) {
+	rb := NewRingBuffer(2)
+
+	_, err := rb.Poll(0)
+	assert.IsType(t, TimeoutError{}, err)
+
+	start := time.Now()
+	_, err = rb.Poll(10 * time.Millisecond)
+	assert.IsType(t, TimeoutError{}, err)
+	assert.True(t, time.Since(start) >= 10*time.Millisecond)
+
+	go func() {
+		time.Sleep(5 * time.Millisecond)
+		rb.Put(`a`)
+	}()
+
+	result, err := rb.Poll(time.Second)
+	assert.Nil(t, err)
+	assert.Equal(t, `a`, result)
+}
+
+func TestRingBufferBlockingPut(t *testing.T) {
+	rb := NewRingBuffer(2)
+	rb.Put(`a`)
+	rb.Put(`b`)
+
+	done := make(chan error)
+	go func() {
+		done <- rb.Put(`c`)
+	}()
+
+	select {
+	case <-done:
+		t.Fatal(`put should block on a full buffer`)
+	case <-time.After(10 * time.Millisecond):
+	}
+
+	result, _ := rb.Get()
+	assert.Equal(t, `a`, result)
+	assert.Nil(t, <-done)
+	result, _ = rb.Get()
+	assert.Equal(t, `b`, result)
+	result, _ = rb.Get()
+	assert.Equal(t, `c`, result)
+}
+
+func TestRingBufferDispose(t *testing.T) {
+	rb := NewRingBuffer(1)
+
+	done := make(chan error)
+	go func() {
+		_, err := rb.Get()
+		done <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	rb.Dispose()
+	assert.IsType(t, DisposedError{}, <-done)
+	assert.True(t, rb.IsDisposed())
+
+	assert.IsType(t, DisposedError{}, rb.Put(`a`))
+	_, err := rb.Offer(`a`)
+	assert.IsType(t, DisposedError{}, err)
+	_, err = rb.Poll(0)
+	assert.IsType(t, DisposedError{}, err)
+}
+
+func TestRingBufferManyProducersAndConsumers(t *testing.T) {
+	const (
+		producers   = 4
+		consumers   = 4
+		perProducer = 1000
+	)
+	rb := NewRingBuffer(16)
+
+	var wg sync.WaitGroup
+	wg.Add(producers)
+	for i := 0; i < producers; i++ {
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < perProducer; j++ {
+				assert.Nil(t, rb.Put(i*perProducer+j))
+			}
+		}(i)
+	}
+
+	var sum int64
+	var consumed sync.WaitGroup
+	consumed.Add(consumers)
+	for i := 0; i < consumers; i++ {
+		go func() {
+			defer consumed.Done()
+			for j := 0; j < producers*perProducer/consumers; j++ {
+				result, err := rb.Get()
+				assert.Nil(t, err)
+				atomic.AddInt64(&sum, int64(result.(int)))
+			}
+		}()
+	}
+
+	wg.Wait()
+	consumed.Wait()
+
+	total := producers * perProducer
+	assert.Equal(t, int64(total*(total-1)/2), sum)
+	assert.Equal(t, uint64(0), rb.Len())
+}
+
+func BenchmarkRingBuffer(b *testing.B) {
+	rb := NewRingBuffer(1024)
+	var wg sync.WaitGroup
+	wg.Add(1)
+
+	go func() {
+		for i := 0; i < b.N; i++ {
+			rb.Get()
+		}
+		wg.Done()
+	}()
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		rb.Put(`a`)
+	}
+	wg.Wait()
+}
+
+func BenchmarkRingBufferMPMC(b *testing.B) {
+	rb := NewRingBuffer(1024)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			rb.Put(`a`)
+			rb.Get()
+		}
+	})
+}
+
+func BenchmarkQueueMPMC(b *testing.B) {
+	q := New(1024)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			q.Put(`a`)
+			q.Get(1)
+		}
+	})
+}
+
+func BenchmarkChannelMPMC(b *testing.B) {
+	ch := make(chan interface{}, 1024)
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			ch <- `a`
+			<-ch
+		}
+	})
+}